@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	"github.com/fbigun/smartwaker/internal/controller"
+)
+
+// runDiscover 执行discover子命令：扫描局域网并输出候选的设备配置
+// 配置文件存在时使用其中的discover配置，并跳过已经配置过的设备
+func runDiscover(args []string) {
+	flags := flag.NewFlagSet("discover", flag.ExitOnError)
+	configPath := flags.String("c", "config.yml", "Path to configuration file (optional)")
+	subnet := flags.String("subnet", "", "Subnet to scan in CIDR notation, e.g. 192.168.1.0/24 (default: configured or local subnets)")
+	timeout := flags.Duration("timeout", 0, "Time to wait for each host to reply (default 500ms)")
+	output := flags.String("o", "", "Write candidate device entries to this file instead of stdout")
+	flags.Parse(args)
+
+	// 加载配置文件（可选）
+	var discoverCfg config.DiscoverConfig
+	var known []config.DeviceConfig
+	if _, err := os.Stat(*configPath); err == nil {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		discoverCfg = cfg.Discover
+		known = cfg.Devices
+	}
+
+	if *subnet != "" {
+		discoverCfg.Subnets = []string{*subnet}
+	}
+
+	opts, err := controller.NewDiscoverOptions(discoverCfg)
+	if err != nil {
+		log.Fatalf("Failed to discover devices: %v", err)
+	}
+	if *timeout > 0 {
+		opts.Timeout = *timeout
+	}
+
+	// 收到中断信号时停止扫描
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	hosts, err := controller.Discover(ctx, discoverCfg.Subnets, opts)
+	if err != nil {
+		log.Fatalf("Failed to discover devices: %v", err)
+	}
+
+	entries := controller.FormatDeviceEntries(hosts, known)
+	if *output == "" {
+		fmt.Print(entries)
+		return
+	}
+
+	if err := os.WriteFile(*output, []byte(entries), 0644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *output, err)
+	}
+	fmt.Printf("Discovered %d hosts, candidate device entries written to %s\n", len(hosts), *output)
+}
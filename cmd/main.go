@@ -21,6 +21,12 @@ var (
 )
 
 func main() {
+	// 子命令
+	if len(os.Args) > 1 && os.Args[1] == "discover" {
+		runDiscover(os.Args[2:])
+		return
+	}
+
 	// 解析命令行参数
 	configPath := flag.String("c", "config.yml", "Path to configuration file")
 	versionFlag := flag.Bool("v", false, "Show version information")
@@ -2,30 +2,127 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/robfig/cron/v3"
 	"gopkg.in/yaml.v3"
+
+	"github.com/fbigun/smartwaker/pkg/utils"
 )
 
 // Config 定义程序的全局配置结构
 type Config struct {
-	Mode       string         `yaml:"mode"`       // 程序模式：controller 或 controlled
-	MQTT       MQTTConfig     `yaml:"mqtt"`       // MQTT配置
-	Devices    []DeviceConfig `yaml:"devices"`    // 设备配置（控制端模式）
-	Controlled ControlledConfig `yaml:"controlled"` // 被控端配置
+	Mode       string              `yaml:"mode"`       // 程序模式：controller 或 controlled
+	MQTT       MQTTConfig          `yaml:"mqtt"`       // MQTT配置
+	Devices    []DeviceConfig      `yaml:"devices"`    // 设备配置（控制端模式）
+	Controlled ControlledConfig    `yaml:"controlled"` // 被控端配置
+	Wake       WakeConfig          `yaml:"wake"`       // 全局唤醒配置（控制端模式）
+	Groups     map[string][]string `yaml:"groups"`     // 设备组：组名 -> 设备名称列表（控制端模式）
+	Schedules  []ScheduleConfig    `yaml:"schedules"`  // 定时任务（控制端模式）
+	Monitor    MonitorConfig       `yaml:"monitor"`    // 设备在线状态监控（控制端模式）
+	Resolve    ResolveConfig       `yaml:"resolve"`    // 设备地址解析（控制端模式）
+	Discover   DiscoverConfig      `yaml:"discover"`   // 局域网设备发现
+}
+
+// MIN_DISCOVER_PREFIX 设备发现允许扫描的最短子网前缀（/20，即4096个地址）
+const MIN_DISCOVER_PREFIX = 20
+
+// DiscoverConfig 定义局域网设备发现配置
+type DiscoverConfig struct {
+	Subnets []string `yaml:"subnets"`  // 扫描的子网（CIDR格式），为空时扫描本地网卡所在的IPv4子网
+	Timeout int      `yaml:"timeout"`  // 等待每个主机应答的超时时间(毫秒)，默认500
+	OUIFile string   `yaml:"oui_file"` // OUI厂商数据库文件（IEEE oui.txt 或 Wireshark manuf 格式）
+}
+
+// ResolveConfig 定义设备IP地址的动态解析配置
+type ResolveConfig struct {
+	Leases       string `yaml:"leases"`        // DHCP租约文件路径，用于根据MAC地址查找IP地址
+	LeasesFormat string `yaml:"leases_format"` // 租约文件格式：dnsmasq 或 isc，为空时根据文件内容识别
+	TTL          int    `yaml:"ttl"`           // 解析结果的缓存时间(秒)，默认60秒
+}
+
+// MonitorConfig 定义设备在线状态监控配置
+type MonitorConfig struct {
+	Enabled          bool `yaml:"enabled"`           // 是否启用后台监控
+	Interval         int  `yaml:"interval"`          // 检测间隔(秒)，默认30秒
+	OnlineThreshold  int  `yaml:"online_threshold"`  // 连续检测成功多少次后视为上线，默认1
+	OfflineThreshold int  `yaml:"offline_threshold"` // 连续检测失败多少次后视为离线，默认3
+	HoldTime         int  `yaml:"hold_time"`         // 状态变化后至少保持的时间(秒)，用于抑制频繁切换，默认0
 }
 
 // MQTTConfig 定义MQTT相关配置
 type MQTTConfig struct {
-	Broker       string     `yaml:"broker"`
-	ClientID     string     `yaml:"client_id"`
-	Topic        string     `yaml:"topic"`
-	Auth         AuthConfig `yaml:"auth"`
-	Version      int        `yaml:"version"`
-	QoS          int        `yaml:"qos"`
-	CleanSession bool       `yaml:"clean_session"`
-	KeepAlive    int        `yaml:"keep_alive"`
-	TLS          TLSConfig  `yaml:"tls"`
+	Broker       string          `yaml:"broker"`
+	Brokers      []BrokerConfig  `yaml:"brokers"` // 按优先级排列的服务器列表，配置后忽略broker
+	ClientID     string          `yaml:"client_id"`
+	Topic        string          `yaml:"topic"`
+	Auth         AuthConfig      `yaml:"auth"`
+	Version      int             `yaml:"version"`
+	QoS          int             `yaml:"qos"`
+	CleanSession bool            `yaml:"clean_session"`
+	KeepAlive    int             `yaml:"keep_alive"`
+	TLS          TLSConfig       `yaml:"tls"`
+	WebSocket    WebSocketConfig `yaml:"websocket"` // broker使用ws://或wss://时的WebSocket配置
+	Queue        QueueConfig     `yaml:"queue"`     // 断线期间发布的消息队列
+	// 可用性主题，连接成功后发布上线消息，连接异常断开时由服务器发布下线消息
+	Availability AvailabilityConfig `yaml:"availability"`
+	// 连接断开后按指数退避自动重连
+	ReconnectInterval    int `yaml:"reconnect_interval"`     // 首次重连前的等待时间(秒)，默认1秒
+	MaxReconnectInterval int `yaml:"max_reconnect_interval"` // 重连等待时间的上限(秒)，默认60秒
+	FailbackInterval     int `yaml:"failback_interval"`      // 连接到备用服务器时检查优先级更高的服务器是否恢复的间隔(秒)，默认60秒
+	// 以下配置仅用于MQTT v5
+	SessionExpiry  int               `yaml:"session_expiry"`  // 会话过期时间(秒)，0表示断开连接时清除会话
+	MessageExpiry  int               `yaml:"message_expiry"`  // 发布消息的过期时间(秒)，0表示永不过期
+	UserProperties map[string]string `yaml:"user_properties"` // 附加到发布的每条消息的用户属性
+}
+
+// QueueConfig 定义断线期间发布消息的队列配置，重新连接后按原顺序发布
+type QueueConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Size       int    `yaml:"size"`        // 队列最多保存的消息数，默认1000
+	Dir        string `yaml:"dir"`         // 持久化目录，程序重启后继续发布，为空时只保存在内存中
+	DropPolicy string `yaml:"drop_policy"` // 队列满时丢弃的消息：oldest（默认，丢弃最早的消息）或 newest（丢弃新消息）
+	TTL        int    `yaml:"ttl"`         // 消息在队列中保存的最长时间(秒)，超时后丢弃，0表示不过期
+}
+
+// AvailabilityConfig 定义可用性主题配置
+// 连接成功后发布保留的上线消息，连接异常断开时由服务器发布遗嘱消息（下线消息）
+type AvailabilityConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Topic   string `yaml:"topic"`   // 可用性主题，为空时控制端使用 "<topic>/availability"，被控端使用 "<status_topic>/availability"
+	Online  string `yaml:"online"`  // 上线消息，默认 "online"
+	Offline string `yaml:"offline"` // 下线消息，默认 "offline"
+}
+
+// AvailabilityTopic 返回可用性主题，没有配置时根据程序模式生成
+func (c *Config) AvailabilityTopic() string {
+	if c.MQTT.Availability.Topic != "" {
+		return c.MQTT.Availability.Topic
+	}
+	if c.Mode == "controlled" {
+		return c.Controlled.StatusTopic + "/availability"
+	}
+	return c.MQTT.Topic + "/availability"
+}
+
+// BrokerConfig 定义MQTT服务器地址，auth和tls为空时使用mqtt中的全局配置
+type BrokerConfig struct {
+	URL  string      `yaml:"url"`
+	Auth *AuthConfig `yaml:"auth"` // 覆盖mqtt.auth
+	TLS  *TLSConfig  `yaml:"tls"`  // 覆盖mqtt.tls
+}
+
+// BrokerList 返回按优先级排列的服务器列表，没有配置brokers时返回broker
+func (m *MQTTConfig) BrokerList() []BrokerConfig {
+	if len(m.Brokers) > 0 {
+		return m.Brokers
+	}
+	return []BrokerConfig{{URL: m.Broker}}
 }
 
 // AuthConfig 定义MQTT认证配置
@@ -37,6 +134,7 @@ type AuthConfig struct {
 }
 
 // EnhancedAuth 定义MQTT v5增强认证配置
+// SCRAM-SHA-256和SCRAM-SHA-512使用auth.username和auth.password，其他认证方法在CONNECT报文中发送auth_data
 type EnhancedAuth struct {
 	Enabled    bool   `yaml:"enabled"`
 	AuthMethod string `yaml:"auth_method"`
@@ -52,12 +150,110 @@ type TLSConfig struct {
 	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
 }
 
+// WebSocketConfig 定义MQTT over WebSocket配置，wss://连接同时使用tls中的证书配置
+type WebSocketConfig struct {
+	Path    string            `yaml:"path"`    // WebSocket路径，如 "/mqtt"，为空时使用broker地址中的路径
+	Headers map[string]string `yaml:"headers"` // 握手请求附加的HTTP头
+	Proxy   string            `yaml:"proxy"`   // HTTP代理地址，如 "http://proxy.example.com:8080"，为空时使用HTTP_PROXY和HTTPS_PROXY环境变量
+}
+
 // DeviceConfig 定义需要唤醒的设备配置
 type DeviceConfig struct {
-	Name string `yaml:"name"`
-	MAC  string `yaml:"mac"`
-	IP   string `yaml:"ip"`
-	Port int    `yaml:"port"`
+	Name        string `yaml:"name"`
+	MAC         string `yaml:"mac"`
+	IP          string `yaml:"ip"`
+	Hostname    string `yaml:"hostname"` // 主机名，配置后在检测时通过DNS解析设备的IP地址
+	Port        int    `yaml:"port"`
+	Verify      bool   `yaml:"verify"`       // 发送唤醒包后是否等待设备上线
+	BootTimeout int    `yaml:"boot_timeout"` // 等待设备上线的超时时间(秒)
+	CheckPort   int    `yaml:"check_port"`   // 检测设备上线的TCP端口，为0时使用Ping
+	SecureOn    string `yaml:"secureon"`     // SecureOn密码（4或6字节，MAC地址格式或十六进制）
+	Transport   string `yaml:"transport"`    // 唤醒包发送方式：udp（默认）或 ethernet
+	Interface   string `yaml:"interface"`    // 发送唤醒包使用的网卡名称
+	Subnet      string `yaml:"subnet"`       // 目标子网（CIDR格式），用于计算定向广播地址
+	IPv6        bool   `yaml:"ipv6"`         // 未配置ip时通过IPv6组播地址ff02::1发送，需要指定interface
+
+	Repeat         int   `yaml:"repeat"`          // 每次唤醒发送的轮数，覆盖全局配置
+	RepeatInterval int   `yaml:"repeat_interval"` // 每轮发送之间的间隔(毫秒)，覆盖全局配置
+	Ports          []int `yaml:"ports"`           // 发送唤醒包的端口列表，覆盖port和全局配置
+
+	Tags      []string `yaml:"tags"`       // 设备标签，可以通过 "@标签" 选择设备
+	DependsOn []string `yaml:"depends_on"` // 依赖的设备，唤醒本设备前会先唤醒并等待这些设备上线
+
+	Waker string          `yaml:"waker"` // 唤醒方式：wol（默认）、http 或 exec
+	HTTP  HTTPWakerConfig `yaml:"http"`  // HTTP唤醒配置
+	Exec  ExecWakerConfig `yaml:"exec"`  // 命令唤醒配置
+
+	Shutdown ShutdownConfig `yaml:"shutdown"` // 关机配置
+
+	Ping   PingConfig    `yaml:"ping"`   // Ping检测配置
+	Checks []CheckConfig `yaml:"checks"` // 健康检查列表，配置后设备在所有检查都通过时才视为在线
+}
+
+// CheckConfig 定义设备的健康检查
+type CheckConfig struct {
+	Type               string `yaml:"type"`                 // 检查类型：icmp、tcp、http、tls、ssh 或 arp
+	Name               string `yaml:"name"`                 // 检查名称，默认由类型和端口组成
+	Host               string `yaml:"host"`                 // 检查的主机，默认使用设备的ip
+	Port               int    `yaml:"port"`                 // 端口，tcp必须指定，tls默认443，ssh默认22
+	URL                string `yaml:"url"`                  // 请求地址（仅http）
+	Status             int    `yaml:"status"`               // 期望的状态码（仅http），默认所有2xx
+	Contains           string `yaml:"contains"`             // 响应体需要包含的内容（仅http）
+	ExpiryDays         int    `yaml:"expiry_days"`          // 证书剩余有效天数少于该值时视为失败（仅tls）
+	ServerName         string `yaml:"server_name"`          // 验证证书和SNI使用的服务器名称（仅tls），默认为设备的hostname或检查的主机
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // 是否跳过证书验证（http和tls）
+	Timeout            int    `yaml:"timeout"`              // 检查超时时间(秒)，默认5秒
+}
+
+// PingConfig 定义ICMP Ping检测配置
+type PingConfig struct {
+	Count    int `yaml:"count"`    // 每次检测发送的回显请求数量，默认1
+	Interval int `yaml:"interval"` // 相邻两次请求之间的间隔(毫秒)，默认1000
+	Timeout  int `yaml:"timeout"`  // 等待每个回显应答的超时时间(秒)，默认3
+}
+
+// ShutdownConfig 定义关闭设备的方式
+type ShutdownConfig struct {
+	Method string          `yaml:"method"` // 关机方式：http 或 exec，为空时不支持关机
+	HTTP   HTTPWakerConfig `yaml:"http"`   // HTTP关机配置
+	Exec   ExecWakerConfig `yaml:"exec"`   // 命令关机配置
+}
+
+// ScheduleConfig 定义定时任务配置
+type ScheduleConfig struct {
+	Name         string `yaml:"name"`           // 任务名称
+	Cron         string `yaml:"cron"`           // cron表达式（分 时 日 月 周），如 "0 1 * * *"
+	Timezone     string `yaml:"timezone"`       // 时区，如 "Asia/Shanghai"，默认使用本地时区
+	Action       string `yaml:"action"`         // 动作：wake、ping 或 shutdown
+	Target       string `yaml:"target"`         // 目标：设备名称、"@组名" 或 "*"
+	Jitter       int    `yaml:"jitter"`         // 随机延迟的最大值(秒)，避免多个任务同时执行
+	SkipIfOnline bool   `yaml:"skip_if_online"` // 设备已在线时跳过唤醒（仅wake动作）
+}
+
+// HTTPWakerConfig 定义通过HTTP请求唤醒设备的配置
+// URL、请求头和请求体支持设备字段模板，如 {{.Name}}、{{.MAC}}、{{.IP}}
+type HTTPWakerConfig struct {
+	Method      string            `yaml:"method"`       // 请求方法，默认POST
+	URL         string            `yaml:"url"`          // 请求地址
+	Headers     map[string]string `yaml:"headers"`      // 请求头
+	Body        string            `yaml:"body"`         // 请求体
+	StatusCodes []int             `yaml:"status_codes"` // 视为成功的状态码，默认所有2xx
+	Timeout     int               `yaml:"timeout"`      // 请求超时时间(秒)，默认10秒
+}
+
+// ExecWakerConfig 定义通过执行命令唤醒设备的配置
+// 命令参数支持设备字段模板，如 {{.Name}}、{{.MAC}}、{{.IP}}
+type ExecWakerConfig struct {
+	Command string   `yaml:"command"` // 要执行的命令
+	Args    []string `yaml:"args"`    // 命令参数
+	Timeout int      `yaml:"timeout"` // 执行超时时间(秒)，默认10秒
+}
+
+// WakeConfig 定义全局唤醒配置，作为所有设备的默认值
+type WakeConfig struct {
+	Repeat         int   `yaml:"repeat"`          // 每次唤醒发送的轮数
+	RepeatInterval int   `yaml:"repeat_interval"` // 每轮发送之间的间隔(毫秒)
+	Ports          []int `yaml:"ports"`           // 发送唤醒包的端口列表，如 [7, 9]
 }
 
 // ControlledConfig 定义被控端配置
@@ -97,9 +293,14 @@ func validateConfig(config *Config) error {
 	}
 
 	// 验证MQTT配置
-	if config.MQTT.Broker == "" {
+	if config.MQTT.Broker == "" && len(config.MQTT.Brokers) == 0 {
 		return fmt.Errorf("MQTT broker cannot be empty")
 	}
+	for i, broker := range config.MQTT.Brokers {
+		if broker.URL == "" {
+			return fmt.Errorf("invalid mqtt configuration: brokers[%d].url cannot be empty", i)
+		}
+	}
 
 	// 如果是控制端模式，验证设备配置
 	if config.Mode == "controller" && len(config.Devices) == 0 {
@@ -110,11 +311,437 @@ func validateConfig(config *Config) error {
 	if config.MQTT.Version != 3 && config.MQTT.Version != 4 && config.MQTT.Version != 5 {
 		return fmt.Errorf("invalid MQTT version: %d, must be 3, 4, or 5", config.MQTT.Version)
 	}
+	if config.MQTT.ReconnectInterval < 0 || config.MQTT.MaxReconnectInterval < 0 || config.MQTT.FailbackInterval < 0 {
+		return fmt.Errorf("invalid mqtt configuration: reconnect and failback intervals must not be negative")
+	}
+	if err := validateWebSocket(&config.MQTT.WebSocket); err != nil {
+		return fmt.Errorf("invalid mqtt configuration: %w", err)
+	}
+	if err := validateMQTT5(&config.MQTT); err != nil {
+		return fmt.Errorf("invalid mqtt configuration: %w", err)
+	}
+	if err := validateQueue(&config.MQTT.Queue); err != nil {
+		return fmt.Errorf("invalid mqtt configuration: %w", err)
+	}
 
 	// 验证QoS
 	if config.MQTT.QoS < 0 || config.MQTT.QoS > 2 {
 		return fmt.Errorf("invalid QoS level: %d, must be 0, 1, or 2", config.MQTT.QoS)
 	}
 
+	// 验证全局唤醒配置
+	if err := validateRepeat(config.Wake.Repeat, config.Wake.RepeatInterval, config.Wake.Ports); err != nil {
+		return fmt.Errorf("invalid wake configuration: %w", err)
+	}
+
+	// 验证监控配置
+	if err := validateMonitor(&config.Monitor); err != nil {
+		return fmt.Errorf("invalid monitor configuration: %w", err)
+	}
+
+	// 验证地址解析配置
+	if err := validateResolve(&config.Resolve); err != nil {
+		return fmt.Errorf("invalid resolve configuration: %w", err)
+	}
+
+	// 验证设备发现配置
+	if err := validateDiscover(&config.Discover); err != nil {
+		return fmt.Errorf("invalid discover configuration: %w", err)
+	}
+
+	// 验证设备配置
+	for i := range config.Devices {
+		if err := validateDevice(&config.Devices[i]); err != nil {
+			return fmt.Errorf("invalid device %q: %w", config.Devices[i].Name, err)
+		}
+	}
+
+	// 验证设备组配置
+	if err := validateGroups(config); err != nil {
+		return err
+	}
+
+	// 验证设备依赖配置
+	if err := validateDependencies(config); err != nil {
+		return err
+	}
+
+	// 验证定时任务配置
+	for i := range config.Schedules {
+		if err := validateSchedule(config, &config.Schedules[i]); err != nil {
+			return fmt.Errorf("invalid schedule %q: %w", config.Schedules[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateDevice 验证单个设备配置的有效性
+func validateDevice(device *DeviceConfig) error {
+	if device.BootTimeout < 0 {
+		return fmt.Errorf("invalid boot timeout: %d, must not be negative", device.BootTimeout)
+	}
+
+	if device.CheckPort < 0 || device.CheckPort > 65535 {
+		return fmt.Errorf("invalid check port: %d, must be between 0 and 65535", device.CheckPort)
+	}
+
+	if err := validateRepeat(device.Repeat, device.RepeatInterval, device.Ports); err != nil {
+		return err
+	}
+
+	switch device.Transport {
+	case "", "udp":
+	case "ethernet":
+		if device.Interface == "" {
+			return fmt.Errorf("interface is required for ethernet transport")
+		}
+	default:
+		return fmt.Errorf("invalid transport: %s, must be 'udp' or 'ethernet'", device.Transport)
+	}
+
+	if device.Subnet != "" {
+		if _, subnet, err := net.ParseCIDR(device.Subnet); err != nil || subnet.IP.To4() == nil {
+			return fmt.Errorf("invalid subnet: %s, must be an IPv4 CIDR such as 192.168.10.0/24", device.Subnet)
+		}
+	}
+
+	if device.IPv6 && device.IP == "" {
+		if device.Interface == "" {
+			return fmt.Errorf("interface is required for IPv6 multicast")
+		}
+		if device.Subnet != "" {
+			return fmt.Errorf("subnet cannot be used with IPv6 multicast")
+		}
+	}
+
+	if err := validateWaker(device); err != nil {
+		return err
+	}
+
+	if err := validatePing(&device.Ping); err != nil {
+		return err
+	}
+
+	for i := range device.Checks {
+		if err := validateCheck(device, &device.Checks[i]); err != nil {
+			return fmt.Errorf("invalid check %d: %w", i+1, err)
+		}
+	}
+
+	if device.SecureOn != "" {
+		if _, err := utils.ParseSecureOnPassword(device.SecureOn); err != nil {
+			return fmt.Errorf("invalid secureon: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validateWebSocket 验证MQTT over WebSocket配置
+func validateWebSocket(ws *WebSocketConfig) error {
+	if ws.Path != "" && !strings.HasPrefix(ws.Path, "/") {
+		return fmt.Errorf("websocket path must start with '/': %s", ws.Path)
+	}
+	if ws.Proxy != "" {
+		u, err := url.Parse(ws.Proxy)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid websocket proxy: %s", ws.Proxy)
+		}
+	}
+	return nil
+}
+
+// validateQueue 验证消息队列配置的有效性
+func validateQueue(queue *QueueConfig) error {
+	switch queue.DropPolicy {
+	case "", "oldest", "newest":
+	default:
+		return fmt.Errorf("invalid queue drop policy: %s, must be 'oldest' or 'newest'", queue.DropPolicy)
+	}
+
+	if queue.Size < 0 || queue.TTL < 0 {
+		return fmt.Errorf("queue size and ttl must not be negative")
+	}
+
+	return nil
+}
+
+// validateMQTT5 验证仅用于MQTT v5的配置
+func validateMQTT5(mqtt *MQTTConfig) error {
+	if mqtt.SessionExpiry < 0 {
+		return fmt.Errorf("session_expiry must not be negative")
+	}
+	if mqtt.MessageExpiry < 0 {
+		return fmt.Errorf("message_expiry must not be negative")
+	}
+
+	if mqtt.Version != 5 && (mqtt.SessionExpiry > 0 || mqtt.MessageExpiry > 0 || len(mqtt.UserProperties) > 0 || mqtt.Auth.Enhanced.Enabled) {
+		return fmt.Errorf("session_expiry, message_expiry, user_properties and auth.enhanced require version 5")
+	}
+
+	if mqtt.Auth.Enhanced.Enabled && mqtt.Auth.Enhanced.AuthMethod == "" {
+		return fmt.Errorf("auth.enhanced.auth_method is required when enhanced authentication is enabled")
+	}
+
+	return nil
+}
+
+// validateMonitor 验证监控配置的有效性
+func validateMonitor(monitor *MonitorConfig) error {
+	if monitor.Interval < 0 {
+		return fmt.Errorf("invalid interval: %d, must not be negative", monitor.Interval)
+	}
+
+	if monitor.OnlineThreshold < 0 || monitor.OfflineThreshold < 0 {
+		return fmt.Errorf("invalid threshold: must not be negative")
+	}
+
+	if monitor.HoldTime < 0 {
+		return fmt.Errorf("invalid hold time: %d, must not be negative", monitor.HoldTime)
+	}
+
+	return nil
+}
+
+// validateResolve 验证地址解析配置的有效性
+func validateResolve(resolve *ResolveConfig) error {
+	switch resolve.LeasesFormat {
+	case "", "dnsmasq", "isc":
+	default:
+		return fmt.Errorf("invalid leases format: %s, must be 'dnsmasq' or 'isc'", resolve.LeasesFormat)
+	}
+
+	if resolve.TTL < 0 {
+		return fmt.Errorf("invalid ttl: %d, must not be negative", resolve.TTL)
+	}
+
+	return nil
+}
+
+// validateDiscover 验证设备发现配置的有效性
+func validateDiscover(discover *DiscoverConfig) error {
+	for _, subnet := range discover.Subnets {
+		if err := ValidateDiscoverSubnet(subnet); err != nil {
+			return err
+		}
+	}
+
+	if discover.Timeout < 0 {
+		return fmt.Errorf("invalid timeout: %d, must not be negative", discover.Timeout)
+	}
+
+	return nil
+}
+
+// ValidateDiscoverSubnet 验证扫描的子网，只支持IPv4且不能大于 /MIN_DISCOVER_PREFIX
+func ValidateDiscoverSubnet(subnet string) error {
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil || network.IP.To4() == nil {
+		return fmt.Errorf("invalid subnet: %s, must be an IPv4 CIDR such as 192.168.1.0/24", subnet)
+	}
+
+	if ones, _ := network.Mask.Size(); ones < MIN_DISCOVER_PREFIX {
+		return fmt.Errorf("subnet %s is too large to scan, prefix must be at least /%d", subnet, MIN_DISCOVER_PREFIX)
+	}
+
+	return nil
+}
+
+// validateRepeat 验证重复发送配置的有效性
+func validateRepeat(repeat, interval int, ports []int) error {
+	if repeat < 0 {
+		return fmt.Errorf("invalid repeat: %d, must not be negative", repeat)
+	}
+
+	if interval < 0 {
+		return fmt.Errorf("invalid repeat interval: %d, must not be negative", interval)
+	}
+
+	for _, port := range ports {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port: %d, must be between 1 and 65535", port)
+		}
+	}
+
+	return nil
+}
+
+// validatePing 验证Ping检测配置的有效性
+func validatePing(ping *PingConfig) error {
+	if ping.Count < 0 || ping.Count > 100 {
+		return fmt.Errorf("invalid ping count: %d, must be between 0 and 100", ping.Count)
+	}
+
+	if ping.Interval < 0 {
+		return fmt.Errorf("invalid ping interval: %d, must not be negative", ping.Interval)
+	}
+
+	if ping.Timeout < 0 {
+		return fmt.Errorf("invalid ping timeout: %d, must not be negative", ping.Timeout)
+	}
+
+	return nil
+}
+
+// validateCheck 验证健康检查配置的有效性
+func validateCheck(device *DeviceConfig, check *CheckConfig) error {
+	if check.Port < 0 || check.Port > 65535 {
+		return fmt.Errorf("invalid port: %d, must be between 0 and 65535", check.Port)
+	}
+
+	if check.Timeout < 0 {
+		return fmt.Errorf("invalid timeout: %d, must not be negative", check.Timeout)
+	}
+
+	switch check.Type {
+	case "icmp", "tls", "ssh", "arp":
+	case "tcp":
+		if check.Port == 0 {
+			return fmt.Errorf("port is required for tcp check")
+		}
+	case "http":
+		if check.URL == "" {
+			return fmt.Errorf("url is required for http check")
+		}
+		if check.Status != 0 && (check.Status < 100 || check.Status > 599) {
+			return fmt.Errorf("invalid HTTP status code: %d", check.Status)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid check type: %s, must be 'icmp', 'tcp', 'http', 'tls', 'ssh' or 'arp'", check.Type)
+	}
+
+	if check.Host == "" && device.IP == "" && device.Hostname == "" && device.MAC == "" {
+		return fmt.Errorf("host is required for %s check when device has no ip, hostname or mac", check.Type)
+	}
+
+	return nil
+}
+
+// validateWaker 验证设备唤醒方式和关机方式配置的有效性
+func validateWaker(device *DeviceConfig) error {
+	switch device.Waker {
+	case "", "wol":
+	case "http", "exec":
+		if err := validateBackend("waker", device.Waker, device.HTTP, device.Exec); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid waker: %s, must be 'wol', 'http' or 'exec'", device.Waker)
+	}
+
+	switch device.Shutdown.Method {
+	case "":
+	case "http", "exec":
+		if err := validateBackend("shutdown", device.Shutdown.Method, device.Shutdown.HTTP, device.Shutdown.Exec); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid shutdown method: %s, must be 'http' or 'exec'", device.Shutdown.Method)
+	}
+
+	return nil
+}
+
+// validateBackend 验证HTTP或命令方式的配置，kind为waker或shutdown
+func validateBackend(kind, method string, httpCfg HTTPWakerConfig, execCfg ExecWakerConfig) error {
+	var templates []string
+
+	if method == "http" {
+		if httpCfg.URL == "" {
+			return fmt.Errorf("url is required for http %s", kind)
+		}
+		for _, code := range httpCfg.StatusCodes {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("invalid HTTP status code: %d", code)
+			}
+		}
+		templates = append(templates, httpCfg.URL, httpCfg.Body)
+		for _, value := range httpCfg.Headers {
+			templates = append(templates, value)
+		}
+	} else {
+		if execCfg.Command == "" {
+			return fmt.Errorf("command is required for exec %s", kind)
+		}
+		templates = append(templates, execCfg.Args...)
+	}
+
+	// 检查模板语法
+	for _, text := range templates {
+		if _, err := template.New("waker").Parse(text); err != nil {
+			return fmt.Errorf("invalid template %q: %w", text, err)
+		}
+	}
+
+	return nil
+}
+
+// validateGroups 验证设备组配置的有效性
+func validateGroups(config *Config) error {
+	for group, members := range config.Groups {
+		if group == "" || group == "*" || strings.ContainsAny(group, "@: ") {
+			return fmt.Errorf("invalid group name: %q", group)
+		}
+
+		for _, member := range members {
+			if config.FindDevice(member) == nil {
+				return fmt.Errorf("group %s references unknown device: %s", group, member)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateDependencies 验证设备依赖配置的有效性，检查未知设备和循环依赖
+func validateDependencies(config *Config) error {
+	for _, device := range config.Devices {
+		for _, dep := range device.DependsOn {
+			if dep == device.Name {
+				return fmt.Errorf("device %s cannot depend on itself", device.Name)
+			}
+			if config.FindDevice(dep) == nil {
+				return fmt.Errorf("device %s depends on unknown device: %s", device.Name, dep)
+			}
+		}
+	}
+
+	for _, device := range config.Devices {
+		if _, err := config.WakeOrder(device.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateSchedule 验证定时任务配置的有效性
+func validateSchedule(config *Config, schedule *ScheduleConfig) error {
+	if _, err := cron.ParseStandard(schedule.Cron); err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", schedule.Cron, err)
+	}
+
+	if schedule.Timezone != "" {
+		if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", schedule.Timezone, err)
+		}
+	}
+
+	switch schedule.Action {
+	case "wake", "ping", "shutdown":
+	default:
+		return fmt.Errorf("invalid action: %s, must be 'wake', 'ping' or 'shutdown'", schedule.Action)
+	}
+
+	if _, err := config.ResolveDevices(schedule.Target); err != nil {
+		return fmt.Errorf("invalid target: %w", err)
+	}
+
+	if schedule.Jitter < 0 {
+		return fmt.Errorf("invalid jitter: %d, must not be negative", schedule.Jitter)
+	}
+
 	return nil
 }
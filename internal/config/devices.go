@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDeviceNotFound 表示没有找到指定名称的设备
+var ErrDeviceNotFound = errors.New("device not found")
+
+// FindDevice 根据名称查找设备，找不到时返回nil
+func (c *Config) FindDevice(name string) *DeviceConfig {
+	for i := range c.Devices {
+		if c.Devices[i].Name == name {
+			return &c.Devices[i]
+		}
+	}
+	return nil
+}
+
+// IsMultiTarget 判断目标是否可能匹配多个设备（"*" 或 "@组名"）
+func IsMultiTarget(target string) bool {
+	return target == "*" || strings.HasPrefix(target, "@")
+}
+
+// ResolveDevices 将目标解析为设备列表
+// 目标可以是：
+//   - 设备名称，如 "NAS1"
+//   - "*"，表示所有设备
+//   - "@名称"，表示groups中同名组的成员以及带有同名标签的设备
+func (c *Config) ResolveDevices(target string) ([]*DeviceConfig, error) {
+	// 所有设备
+	if target == "*" {
+		devices := make([]*DeviceConfig, 0, len(c.Devices))
+		for i := range c.Devices {
+			devices = append(devices, &c.Devices[i])
+		}
+		return devices, nil
+	}
+
+	// 设备组或标签
+	if name, ok := strings.CutPrefix(target, "@"); ok {
+		var devices []*DeviceConfig
+		seen := make(map[string]bool)
+		add := func(device *DeviceConfig) {
+			if device != nil && !seen[device.Name] {
+				seen[device.Name] = true
+				devices = append(devices, device)
+			}
+		}
+
+		// 先按组中定义的顺序添加成员，再添加带有该标签的设备
+		for _, member := range c.Groups[name] {
+			add(c.FindDevice(member))
+		}
+		for i := range c.Devices {
+			for _, tag := range c.Devices[i].Tags {
+				if tag == name {
+					add(&c.Devices[i])
+					break
+				}
+			}
+		}
+
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("no devices in group or tag: %s", name)
+		}
+		return devices, nil
+	}
+
+	// 单个设备
+	device := c.FindDevice(target)
+	if device == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, target)
+	}
+	return []*DeviceConfig{device}, nil
+}
+
+// WakeOrder 返回唤醒指定设备时的设备顺序
+// 依赖的设备排在前面，指定的设备排在最后
+// 如果存在循环依赖则返回错误
+func (c *Config) WakeOrder(name string) ([]*DeviceConfig, error) {
+	const (
+		visiting = 1 // 正在访问，在当前依赖路径上
+		visited  = 2 // 已访问完成
+	)
+
+	state := make(map[string]int)
+	var order []*DeviceConfig
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// 从路径中找到环的起点
+			start := 0
+			for i, n := range path {
+				if n == name {
+					start = i
+					break
+				}
+			}
+			cycle := append(append([]string{}, path[start:]...), name)
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+
+		device := c.FindDevice(name)
+		if device == nil {
+			return fmt.Errorf("%w: %s", ErrDeviceNotFound, name)
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range device.DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		order = append(order, device)
+		return nil
+	}
+
+	if err := visit(name); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
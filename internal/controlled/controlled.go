@@ -65,14 +65,26 @@ func Start(cfg *config.Config) (func(), error) {
 
 	// 创建并连接MQTT客户端
 	client := mqttClient.NewClient(&cfg.MQTT, c.handleMessage)
+	client.SetOnConnect(c.onConnect)
+	if cfg.MQTT.Availability.Enabled {
+		client.SetAvailability(cfg.AvailabilityTopic())
+	}
 	if err := client.Connect(); err != nil {
 		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
 	}
 	c.mqtt = client
 
+	// 断开连接前发布下线消息
+	disconnect := func() {
+		if err := client.PublishOffline(); err != nil {
+			log.Printf("Failed to publish offline status: %v", err)
+		}
+		client.Disconnect()
+	}
+
 	// 订阅控制主题
 	if err := client.Subscribe(cfg.MQTT.Topic, byte(cfg.MQTT.QoS), c.handleMessage); err != nil {
-		client.Disconnect()
+		disconnect()
 		return nil, fmt.Errorf("failed to subscribe to topic: %w", err)
 	}
 
@@ -85,29 +97,40 @@ func Start(cfg *config.Config) (func(), error) {
 	cleanup := func() {
 		// 发送停止信号
 		close(c.stopChan)
-		// 断开MQTT连接
-		if client != nil {
-			client.Disconnect()
-		}
+		// 发布下线消息并断开MQTT连接
+		disconnect()
 	}
 
 	return cleanup, nil
 }
 
+// onConnect MQTT连接成功回调，重新连接后立即发布设备信息和状态，不等待下一个上报周期
+func (c *Controlled) onConnect(reconnected bool) {
+	if !reconnected {
+		return
+	}
+	go func() {
+		c.sendDeviceInfo(nil)
+		c.sendStatusReport(nil)
+	}()
+}
+
 // handleMessage 处理接收到的MQTT消息
+// MQTT v5消息带有响应主题时，状态和设备信息只发布给请求方
 func (c *Controlled) handleMessage(client mqtt.Client, msg mqtt.Message) {
 	log.Printf("Received message on topic %s: %s", msg.Topic(), string(msg.Payload()))
 
 	// 处理命令消息
 	command := string(msg.Payload())
+	replyTo := mqttClient.PropertiesOf(msg)
 	
 	switch command {
 	case "status":
 		// 发送一次状态报告
-		c.sendStatusReport()
+		c.sendStatusReport(replyTo)
 	case "info":
 		// 发送设备信息
-		c.sendDeviceInfo()
+		c.sendDeviceInfo(replyTo)
 	default:
 		log.Printf("Unknown command: %s", command)
 	}
@@ -126,15 +149,15 @@ func (c *Controlled) statusReportLoop() {
 	defer ticker.Stop()
 
 	// 立即发送一次初始状态
-	c.sendStatusReport()
-	c.sendDeviceInfo()
+	c.sendStatusReport(nil)
+	c.sendDeviceInfo(nil)
 
 	// 定时循环
 	for {
 		select {
 		case <-ticker.C:
 			// 发送状态报告
-			c.sendStatusReport()
+			c.sendStatusReport(nil)
 		case <-c.stopChan:
 			// 收到停止信号
 			return
@@ -282,8 +305,8 @@ func (c *Controlled) collectStatusInfo() (*StatusInfo, error) {
 	return status, nil
 }
 
-// sendStatusReport 发送状态报告
-func (c *Controlled) sendStatusReport() {
+// sendStatusReport 发送状态报告，replyTo带有响应主题时发布到该主题
+func (c *Controlled) sendStatusReport(replyTo *mqttClient.Properties) {
 	status, err := c.collectStatusInfo()
 	if err != nil {
 		log.Printf("Failed to collect status info: %v", err)
@@ -298,16 +321,16 @@ func (c *Controlled) sendStatusReport() {
 	}
 	
 	// 发布状态
-	topic := c.config.Controlled.StatusTopic
-	if err := c.mqtt.Publish(topic, byte(c.config.MQTT.QoS), false, statusJSON); err != nil {
+	topic, err := c.publish(c.config.Controlled.StatusTopic, false, statusJSON, replyTo)
+	if err != nil {
 		log.Printf("Failed to publish status: %v", err)
 	} else {
 		log.Printf("Status published to %s", topic)
 	}
 }
 
-// sendDeviceInfo 发送设备信息
-func (c *Controlled) sendDeviceInfo() {
+// sendDeviceInfo 发送设备信息，replyTo带有响应主题时发布到该主题
+func (c *Controlled) sendDeviceInfo(replyTo *mqttClient.Properties) {
 	// 转换为JSON
 	infoJSON, err := json.Marshal(c.deviceInfo)
 	if err != nil {
@@ -316,14 +339,25 @@ func (c *Controlled) sendDeviceInfo() {
 	}
 	
 	// 发布设备信息
-	topic := c.config.Controlled.StatusTopic + "/info"
-	if err := c.mqtt.Publish(topic, byte(c.config.MQTT.QoS), true, infoJSON); err != nil {
+	topic, err := c.publish(c.config.Controlled.StatusTopic+"/info", true, infoJSON, replyTo)
+	if err != nil {
 		log.Printf("Failed to publish device info: %v", err)
 	} else {
 		log.Printf("Device info published to %s", topic)
 	}
 }
 
+// publish 发布消息并返回实际发布的主题
+// replyTo带有响应主题时不保留消息，发布到响应主题并附带请求的关联数据
+func (c *Controlled) publish(topic string, retained bool, payload []byte, replyTo *mqttClient.Properties) (string, error) {
+	if replyTo == nil || replyTo.ResponseTopic == "" {
+		return topic, c.mqtt.Publish(topic, byte(c.config.MQTT.QoS), retained, payload)
+	}
+
+	props := &mqttClient.Properties{CorrelationData: replyTo.CorrelationData}
+	return replyTo.ResponseTopic, c.mqtt.PublishWithProperties(replyTo.ResponseTopic, byte(c.config.MQTT.QoS), false, payload, props)
+}
+
 // getLocalIPAddress 获取本地IP地址
 func getLocalIPAddress() ([]string, error) {
 	var addresses []string
@@ -0,0 +1,271 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+const (
+	// ETHERTYPE_ARP ARP以太网帧的EtherType
+	ETHERTYPE_ARP = 0x0806
+	// ARP_REQUEST ARP请求操作码
+	ARP_REQUEST = 1
+	// ARP_REPLY ARP应答操作码
+	ARP_REPLY = 2
+	// ARP_FLAG_COMPLETE 邻居表中已完成解析的条目标志（ATF_COM）
+	ARP_FLAG_COMPLETE = 0x2
+
+	// DEFAULT_ARP_TIMEOUT 等待ARP应答的默认超时时间
+	DEFAULT_ARP_TIMEOUT = 2 * time.Second
+	// MAC_LEARN_TIMEOUT 启动时获取设备MAC地址的超时时间
+	MAC_LEARN_TIMEOUT = time.Second
+	// PROC_NET_ARP Linux邻居表文件
+	PROC_NET_ARP = "/proc/net/arp"
+)
+
+// ErrNoARPReply 表示在超时时间内没有收到ARP应答
+var ErrNoARPReply = errors.New("no ARP reply")
+
+// ErrNotOnLink 表示目标地址不在任何本地网卡的子网内，无法使用ARP
+var ErrNotOnLink = errors.New("address is not on a directly connected IPv4 network")
+
+// ErrARPUnsupported 表示当前平台不支持ARP探测
+var ErrARPUnsupported = errors.New("ARP probing is only supported on linux")
+
+// NeighborEntry 定义邻居表（ARP缓存）中的一个条目
+type NeighborEntry struct {
+	IP        net.IP           // IP地址
+	MAC       net.HardwareAddr // MAC地址
+	Interface string           // 网卡名称
+	Complete  bool             // 是否已完成解析
+}
+
+// ParseNeighborTable 解析/proc/net/arp格式的邻居表
+// 格式示例: "192.168.1.100  0x1  0x2  00:11:22:33:44:55  *  eth0"
+func ParseNeighborTable(r io.Reader) ([]NeighborEntry, error) {
+	var entries []NeighborEntry
+
+	scanner := bufio.NewScanner(r)
+	first := true
+	for scanner.Scan() {
+		// 跳过表头
+		if first {
+			first = false
+			continue
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+
+		ip := net.ParseIP(fields[0])
+		mac, err := net.ParseMAC(fields[3])
+		if ip == nil || err != nil {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, NeighborEntry{
+			IP:        ip,
+			MAC:       mac,
+			Interface: fields[5],
+			Complete:  flags&ARP_FLAG_COMPLETE != 0 && !isZeroMAC(mac),
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read neighbor table: %w", err)
+	}
+	return entries, nil
+}
+
+// ResolveMAC 获取IP地址对应的MAC地址
+// 优先发送ARP请求，无法发送（如缺少权限）时先触发内核的地址解析再查询邻居表
+func ResolveMAC(ip, ifaceName string, timeout time.Duration) (net.HardwareAddr, error) {
+	mac, _, err := ARPPing(ip, ifaceName, timeout)
+	if err == nil {
+		return mac, nil
+	}
+	if !errors.Is(err, ErrRawSocketPermission) && !errors.Is(err, ErrARPUnsupported) {
+		return nil, err
+	}
+
+	return resolveFromNeighborTable(ip, timeout)
+}
+
+// resolveFromNeighborTable 发送UDP数据报触发内核的地址解析，然后查询邻居表
+func resolveFromNeighborTable(ip string, timeout time.Duration) (net.HardwareAddr, error) {
+	target := net.ParseIP(ip).To4()
+	if target == nil {
+		return nil, fmt.Errorf("invalid IPv4 address: %s", ip)
+	}
+
+	mac, err := LookupNeighbor(target)
+	if err == nil {
+		return mac, nil
+	}
+	if errors.Is(err, ErrARPUnsupported) {
+		return nil, err
+	}
+
+	// 向discard端口发送数据报，内核会先解析目标的MAC地址
+	if conn, err := net.Dial("udp4", net.JoinHostPort(ip, "9")); err == nil {
+		conn.Write([]byte{0})
+		conn.Close()
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		mac, err := LookupNeighbor(target)
+		if err == nil || !time.Now().Before(deadline) {
+			return mac, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// learnMACs 通过ARP获取配置了IPv4地址的设备的MAC地址
+// 没有配置mac的设备自动填充，已配置mac但与实际不一致的设备输出警告
+// 不在本地网段的设备会被跳过
+func learnMACs(devices []config.DeviceConfig) {
+	var wg sync.WaitGroup
+	for i := range devices {
+		device := &devices[i]
+		if net.ParseIP(device.IP).To4() == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			mac, err := ResolveMAC(device.IP, device.Interface, MAC_LEARN_TIMEOUT)
+			if err != nil {
+				if device.MAC == "" && !errors.Is(err, ErrNotOnLink) {
+					log.Printf("Warning: Failed to learn MAC address of device %s: %v", device.Name, err)
+				}
+				return
+			}
+
+			if device.MAC == "" {
+				device.MAC = mac.String()
+				log.Printf("Learned MAC address of device %s: %s", device.Name, device.MAC)
+			} else if !sameMAC(device.MAC, mac.String()) {
+				log.Printf("Warning: Device %s is configured with MAC %s but %s answers with %s", device.Name, device.MAC, device.IP, mac)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// arpTarget 查找目标地址所在的本地网卡，返回网卡、本机在该网卡上的IPv4地址和目标地址
+func arpTarget(ip, ifaceName string) (*net.Interface, net.IP, net.IP, error) {
+	target := net.ParseIP(ip).To4()
+	if target == nil {
+		return nil, nil, nil, fmt.Errorf("invalid IPv4 address: %s", ip)
+	}
+
+	var ifaces []net.Interface
+	if ifaceName != "" {
+		iface, err := net.InterfaceByName(ifaceName)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to find interface %s: %w", ifaceName, err)
+		}
+		ifaces = []net.Interface{*iface}
+	} else {
+		all, err := net.Interfaces()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to list interfaces: %w", err)
+		}
+		ifaces = all
+	}
+
+	for i := range ifaces {
+		iface := &ifaces[i]
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) != 6 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			if ipNet.Contains(target) {
+				return iface, ipNet.IP.To4(), target, nil
+			}
+		}
+	}
+
+	return nil, nil, nil, fmt.Errorf("%s: %w", ip, ErrNotOnLink)
+}
+
+// buildARPRequest 构造广播的ARP请求以太网帧
+func buildARPRequest(srcMAC net.HardwareAddr, srcIP, targetIP net.IP) []byte {
+	packet := make([]byte, 28)
+	binary.BigEndian.PutUint16(packet[0:2], 1)      // 硬件类型：以太网
+	binary.BigEndian.PutUint16(packet[2:4], 0x0800) // 协议类型：IPv4
+	packet[4] = 6                                   // 硬件地址长度
+	packet[5] = 4                                   // 协议地址长度
+	binary.BigEndian.PutUint16(packet[6:8], ARP_REQUEST)
+	copy(packet[8:14], srcMAC)
+	copy(packet[14:18], srcIP.To4())
+	// 目标MAC地址未知，保持为0
+	copy(packet[24:28], targetIP.To4())
+
+	broadcast := net.HardwareAddr{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	return buildEthernetFrame(broadcast, srcMAC, ETHERTYPE_ARP, packet)
+}
+
+// parseARPReply 解析ARP应答以太网帧，返回发送方的IP和MAC地址
+func parseARPReply(frame []byte) (net.IP, net.HardwareAddr, bool) {
+	if len(frame) < 42 || binary.BigEndian.Uint16(frame[12:14]) != ETHERTYPE_ARP {
+		return nil, nil, false
+	}
+
+	packet := frame[14:]
+	if binary.BigEndian.Uint16(packet[6:8]) != ARP_REPLY || packet[4] != 6 || packet[5] != 4 {
+		return nil, nil, false
+	}
+
+	mac := make(net.HardwareAddr, 6)
+	copy(mac, packet[8:14])
+	ip := net.IPv4(packet[14], packet[15], packet[16], packet[17])
+	return ip, mac, true
+}
+
+// isZeroMAC 判断MAC地址是否全为0（未完成解析的条目）
+func isZeroMAC(mac net.HardwareAddr) bool {
+	for _, b := range mac {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sameMAC 判断两个MAC地址字符串是否表示同一个地址（忽略大小写和分隔符）
+func sameMAC(a, b string) bool {
+	x, errX := parseMACAddress(a)
+	y, errY := parseMACAddress(b)
+	return errX == nil && errY == nil && net.HardwareAddr(x).String() == net.HardwareAddr(y).String()
+}
@@ -0,0 +1,103 @@
+//go:build linux
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ARPPing 从目标所在的网卡发送ARP请求，返回目标的MAC地址和往返时间
+// ifaceName为空时自动选择子网包含目标地址的网卡
+// 需要root权限或CAP_NET_RAW能力，超时未收到应答时返回ErrNoARPReply
+func ARPPing(ip, ifaceName string, timeout time.Duration) (net.HardwareAddr, time.Duration, error) {
+	iface, srcIP, target, err := arpTarget(ip, ifaceName)
+	if err != nil {
+		return nil, 0, err
+	}
+	if timeout <= 0 {
+		timeout = DEFAULT_ARP_TIMEOUT
+	}
+
+	// 创建原始套接字，需要CAP_NET_RAW权限
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(ETHERTYPE_ARP)))
+	if err != nil {
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+			return nil, 0, fmt.Errorf("failed to open raw socket on %s: %w", iface.Name, ErrRawSocketPermission)
+		}
+		return nil, 0, fmt.Errorf("failed to open raw socket on %s: %w", iface.Name, err)
+	}
+	defer syscall.Close(fd)
+
+	addr := &syscall.SockaddrLinklayer{
+		Protocol: htons(ETHERTYPE_ARP),
+		Ifindex:  iface.Index,
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		return nil, 0, fmt.Errorf("failed to bind raw socket to %s: %w", iface.Name, err)
+	}
+
+	// 设置较短的接收超时，以便定期检查是否已经超过总超时时间
+	tv := syscall.NsecToTimeval((100 * time.Millisecond).Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return nil, 0, fmt.Errorf("failed to set receive timeout: %w", err)
+	}
+
+	frame := buildARPRequest(iface.HardwareAddr, srcIP, target)
+	addr.Halen = 6
+	copy(addr.Addr[:], []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+
+	start := time.Now()
+	if err := syscall.Sendto(fd, frame, 0, addr); err != nil {
+		return nil, 0, fmt.Errorf("failed to send ARP request on %s: %w", iface.Name, err)
+	}
+
+	buf := make([]byte, 1500)
+	deadline := start.Add(timeout)
+	for time.Now().Before(deadline) {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			return nil, 0, fmt.Errorf("failed to receive ARP reply on %s: %w", iface.Name, err)
+		}
+
+		senderIP, senderMAC, ok := parseARPReply(buf[:n])
+		if ok && senderIP.Equal(target) {
+			return senderMAC, time.Since(start), nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("%s: %w within %v", ip, ErrNoARPReply, timeout)
+}
+
+// ReadNeighborTable 读取内核邻居表
+func ReadNeighborTable() ([]NeighborEntry, error) {
+	file, err := os.Open(PROC_NET_ARP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open neighbor table: %w", err)
+	}
+	defer file.Close()
+
+	return ParseNeighborTable(file)
+}
+
+// LookupNeighbor 在内核邻居表中查找IP地址对应的MAC地址
+func LookupNeighbor(ip net.IP) (net.HardwareAddr, error) {
+	entries, err := ReadNeighborTable()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.Complete && entry.IP.Equal(ip) {
+			return entry.MAC, nil
+		}
+	}
+	return nil, fmt.Errorf("%s not found in neighbor table", ip)
+}
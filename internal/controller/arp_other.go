@@ -0,0 +1,24 @@
+//go:build !linux
+
+package controller
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// ARPPing 非Linux平台不支持发送ARP请求
+func ARPPing(ip, ifaceName string, timeout time.Duration) (net.HardwareAddr, time.Duration, error) {
+	return nil, 0, fmt.Errorf("failed to send ARP request to %s: %w", ip, ErrARPUnsupported)
+}
+
+// LookupNeighbor 非Linux平台不支持查询邻居表
+func LookupNeighbor(ip net.IP) (net.HardwareAddr, error) {
+	return nil, fmt.Errorf("failed to look up %s: %w", ip, ErrARPUnsupported)
+}
+
+// ReadNeighborTable 非Linux平台不支持读取邻居表
+func ReadNeighborTable() ([]NeighborEntry, error) {
+	return nil, fmt.Errorf("failed to read neighbor table: %w", ErrARPUnsupported)
+}
@@ -0,0 +1,341 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+const (
+	// CHECK_ICMP 通过ICMP回显请求检查
+	CHECK_ICMP = "icmp"
+	// CHECK_TCP 检查TCP端口是否开放
+	CHECK_TCP = "tcp"
+	// CHECK_HTTP 检查HTTP接口的状态码和响应内容
+	CHECK_HTTP = "http"
+	// CHECK_TLS 检查TLS握手和证书有效期
+	CHECK_TLS = "tls"
+	// CHECK_SSH 检查SSH服务的版本标识
+	CHECK_SSH = "ssh"
+	// CHECK_ARP 通过ARP请求检查同一网段的主机（适用于屏蔽了ICMP的主机）
+	CHECK_ARP = "arp"
+
+	// DEFAULT_CHECK_TIMEOUT 健康检查的默认超时时间
+	DEFAULT_CHECK_TIMEOUT = 5 * time.Second
+	// DEFAULT_TLS_PORT TLS检查的默认端口
+	DEFAULT_TLS_PORT = 443
+	// DEFAULT_SSH_PORT SSH检查的默认端口
+	DEFAULT_SSH_PORT = 22
+	// MAX_CHECK_BODY_SIZE HTTP检查读取响应体的最大长度
+	MAX_CHECK_BODY_SIZE = 1 << 20
+)
+
+// CheckResult 定义单个健康检查的结果
+type CheckResult struct {
+	Name     string        // 检查名称
+	Passed   bool          // 是否通过
+	Message  string        // 结果描述
+	Duration time.Duration // 检查耗时
+}
+
+// RunChecks 并发执行设备配置的所有健康检查，按配置顺序返回结果
+func RunChecks(ctx context.Context, device *config.DeviceConfig) []CheckResult {
+	results := make([]CheckResult, len(device.Checks))
+
+	var wg sync.WaitGroup
+	for i := range device.Checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = RunCheck(ctx, device, &device.Checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// RunCheck 执行单个健康检查
+func RunCheck(ctx context.Context, device *config.DeviceConfig, check *config.CheckConfig) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout(check.Timeout))
+	defer cancel()
+
+	host := check.Host
+	if host == "" {
+		host = device.IP
+	}
+
+	start := time.Now()
+	var message string
+	var err error
+
+	switch check.Type {
+	case CHECK_ICMP:
+		message, err = checkICMP(ctx, host, device.Ping, check)
+	case CHECK_TCP:
+		message, err = checkTCP(ctx, host, check.Port)
+	case CHECK_HTTP:
+		message, err = checkHTTP(ctx, check)
+	case CHECK_TLS:
+		message, err = checkTLS(ctx, host, tlsServerName(device, check, host), check)
+	case CHECK_SSH:
+		message, err = checkSSH(ctx, host, check)
+	case CHECK_ARP:
+		message, err = checkARP(ctx, host, device.Interface)
+	default:
+		err = fmt.Errorf("unknown check type: %s", check.Type)
+	}
+
+	result := CheckResult{
+		Name:     checkName(check),
+		Passed:   err == nil,
+		Message:  message,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		result.Message = err.Error()
+	}
+	return result
+}
+
+// checkName 返回检查的显示名称
+func checkName(check *config.CheckConfig) string {
+	if check.Name != "" {
+		return check.Name
+	}
+
+	switch check.Type {
+	case CHECK_TCP:
+		return fmt.Sprintf("%s:%d", check.Type, check.Port)
+	case CHECK_TLS:
+		return fmt.Sprintf("%s:%d", check.Type, portOrDefault(check.Port, DEFAULT_TLS_PORT))
+	case CHECK_SSH:
+		return fmt.Sprintf("%s:%d", check.Type, portOrDefault(check.Port, DEFAULT_SSH_PORT))
+	}
+	return check.Type
+}
+
+// checkICMP 通过ICMP回显请求检查主机是否可达
+// 等待每个应答的时间不超过ctx的截止时间
+func checkICMP(ctx context.Context, host string, ping config.PingConfig, check *config.CheckConfig) (string, error) {
+	opts := pingOptions(ping).withDefaults()
+	if check.Timeout > 0 {
+		opts.Timeout = checkTimeout(check.Timeout)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < opts.Timeout {
+			opts.Timeout = remaining
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	stats, err := Ping(host, opts)
+	if err != nil {
+		return "", err
+	}
+	if !stats.Reachable() {
+		return "", fmt.Errorf("host unreachable (%s)", stats)
+	}
+	return stats.String(), nil
+}
+
+// checkTCP 检查TCP端口是否开放
+func checkTCP(ctx context.Context, host string, port int) (string, error) {
+	start := time.Now()
+	conn, err := dialCheck(ctx, host, port)
+	if err != nil {
+		return "", err
+	}
+	conn.Close()
+
+	return fmt.Sprintf("port %d open (%v)", port, time.Since(start).Round(time.Microsecond)), nil
+}
+
+// checkHTTP 检查HTTP接口的状态码以及响应体是否包含指定内容
+func checkHTTP(ctx context.Context, check *config.CheckConfig) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: check.InsecureSkipVerify},
+			DisableKeepAlives: true,
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if check.Status != 0 && resp.StatusCode != check.Status {
+		return "", fmt.Errorf("unexpected HTTP status %d, expected %d", resp.StatusCode, check.Status)
+	}
+	if check.Status == 0 && !isSuccessStatus(resp.StatusCode, nil) {
+		return "", fmt.Errorf("unexpected HTTP status %d", resp.StatusCode)
+	}
+
+	if check.Contains != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, MAX_CHECK_BODY_SIZE))
+		if err != nil {
+			return "", fmt.Errorf("failed to read HTTP response: %w", err)
+		}
+		if !strings.Contains(string(body), check.Contains) {
+			return "", fmt.Errorf("response body does not contain %q", check.Contains)
+		}
+		return fmt.Sprintf("status %d, body contains %q", resp.StatusCode, check.Contains), nil
+	}
+
+	return fmt.Sprintf("status %d", resp.StatusCode), nil
+}
+
+// checkTLS 检查TLS握手是否成功以及证书的剩余有效期，serverName用于SNI和证书验证
+func checkTLS(ctx context.Context, host, serverName string, check *config.CheckConfig) (string, error) {
+	port := portOrDefault(check.Port, DEFAULT_TLS_PORT)
+
+	dialer := &tls.Dialer{
+		Config: &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: check.InsecureSkipVerify,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return "", fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", fmt.Errorf("no certificate presented")
+	}
+
+	expiry := certs[0].NotAfter
+	remaining := time.Until(expiry)
+	days := int(remaining.Hours() / 24)
+	if remaining <= 0 {
+		return "", fmt.Errorf("certificate expired at %s", expiry.Format(time.RFC3339))
+	}
+	if days < check.ExpiryDays {
+		return "", fmt.Errorf("certificate expires in %d days (at %s), less than %d days", days, expiry.Format(time.RFC3339), check.ExpiryDays)
+	}
+
+	return fmt.Sprintf("certificate valid until %s (%d days left)", expiry.Format(time.RFC3339), days), nil
+}
+
+// tlsServerName 返回TLS检查使用的服务器名称
+// 依次使用检查的server_name、设备的hostname（检查未指定host时）和检查的主机
+func tlsServerName(device *config.DeviceConfig, check *config.CheckConfig, host string) string {
+	if check.ServerName != "" {
+		return check.ServerName
+	}
+	if check.Host == "" && device.Hostname != "" {
+		return device.Hostname
+	}
+	return host
+}
+
+// checkSSH 检查SSH服务是否返回版本标识，如 "SSH-2.0-OpenSSH_9.6"
+func checkSSH(ctx context.Context, host string, check *config.CheckConfig) (string, error) {
+	port := portOrDefault(check.Port, DEFAULT_SSH_PORT)
+
+	conn, err := dialCheck(ctx, host, port)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+
+	// 服务端在发送版本标识之前可能先发送其他文本行
+	reader := bufio.NewReader(io.LimitReader(conn, 8192))
+	for {
+		line, err := reader.ReadString('\n')
+		if strings.HasPrefix(line, "SSH-") {
+			return strings.TrimSpace(line), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("no SSH banner received: %w", err)
+		}
+	}
+}
+
+// checkARP 发送ARP请求检查主机是否在线
+func checkARP(ctx context.Context, host, ifaceName string) (string, error) {
+	timeout := DEFAULT_CHECK_TIMEOUT
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	mac, rtt, err := ARPPing(host, ifaceName, timeout)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("reply from %s in %v", mac, rtt.Round(time.Microsecond)), nil
+}
+
+// dialCheck 建立TCP连接
+func dialCheck(ctx context.Context, host string, port int) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to port %d: %w", port, err)
+	}
+	return conn, nil
+}
+
+// checksPassed 判断所有检查是否都已通过
+func checksPassed(results []CheckResult) bool {
+	for _, result := range results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// formatCheckResults 将检查结果格式化为每行一个检查的表格
+func formatCheckResults(results []CheckResult) string {
+	var lines []string
+	for _, result := range results {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		lines = append(lines, fmt.Sprintf("[%s] %s: %s", status, result.Name, result.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkTimeout 返回健康检查的超时时间
+func checkTimeout(seconds int) time.Duration {
+	if seconds <= 0 {
+		return DEFAULT_CHECK_TIMEOUT
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// portOrDefault 端口未配置时返回默认端口
+func portOrDefault(port, defaultPort int) int {
+	if port <= 0 {
+		return defaultPort
+	}
+	return port
+}
@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	mqttClient "github.com/fbigun/smartwaker/internal/mqtt"
+)
+
+const (
+	// STATUS_PROGRESS 命令仍在执行，这是一条中间进度消息
+	STATUS_PROGRESS = 102
+	// STATUS_OK 命令执行成功
+	STATUS_OK = 200
+	// STATUS_PARTIAL 对多个设备执行命令时部分设备失败
+	STATUS_PARTIAL = 207
+	// STATUS_BAD_REQUEST 命令格式错误或参数无效
+	STATUS_BAD_REQUEST = 400
+	// STATUS_NOT_FOUND 目标设备不存在
+	STATUS_NOT_FOUND = 404
+	// STATUS_CONFLICT 设备正在唤醒或关机，不能执行命令
+	STATUS_CONFLICT = 409
+	// STATUS_FAILED 命令执行失败
+	STATUS_FAILED = 500
+)
+
+// ErrUnknownCommand 表示无法识别的命令
+var ErrUnknownCommand = errors.New("unknown command")
+
+// targetActions 需要指定目标设备的动作
+var targetActions = map[string]bool{
+	"wake":     true,
+	"ping":     true,
+	"shutdown": true,
+	"state":    true,
+}
+
+// globalActions 不需要指定目标设备的动作
+var globalActions = map[string]bool{
+	"list":      true,
+	"schedules": true,
+	"broker":    true,
+	"discover":  true,
+}
+
+// Command 定义控制端命令
+// JSON格式示例: {"id":"42","action":"wake","target":"nas1","args":{}}
+type Command struct {
+	ID     string                 `json:"id,omitempty"`     // 请求ID，响应中原样返回
+	Action string                 `json:"action"`           // 动作：list、schedules、discover、wake、ping、shutdown 或 state
+	Target string                 `json:"target,omitempty"` // 目标：设备名称、"@组名或标签" 或 "*"
+	Args   map[string]interface{} `json:"args,omitempty"`   // 动作参数，如discover的subnet
+}
+
+// Response 定义JSON格式命令的响应
+type Response struct {
+	ID      string      `json:"id,omitempty"`     // 请求ID
+	Action  string      `json:"action"`           // 动作
+	Target  string      `json:"target,omitempty"` // 目标
+	Status  int         `json:"status"`           // 状态码，102表示中间进度，其他为最终结果
+	Message string      `json:"message"`          // 结果描述
+	Data    interface{} `json:"data,omitempty"`   // 结构化结果
+}
+
+// ParseCommand 解析命令消息，返回命令以及消息是否为JSON格式
+// 以 "{" 开头的消息按JSON格式解析，否则按 "wake:nas1" 这样的字符串格式解析
+func ParseCommand(payload []byte) (Command, bool, error) {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		cmd, err := parseJSONCommand(trimmed)
+		return cmd, true, err
+	}
+
+	cmd, err := parseLegacyCommand(string(payload))
+	return cmd, false, err
+}
+
+// parseJSONCommand 解析JSON格式的命令
+func parseJSONCommand(payload []byte) (Command, error) {
+	var cmd Command
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return cmd, fmt.Errorf("invalid JSON command: %w", err)
+	}
+
+	if cmd.Action == "" {
+		return cmd, fmt.Errorf("action is required")
+	}
+	if !targetActions[cmd.Action] && !globalActions[cmd.Action] {
+		return cmd, fmt.Errorf("%w: %s", ErrUnknownCommand, cmd.Action)
+	}
+	if targetActions[cmd.Action] && cmd.Target == "" {
+		return cmd, fmt.Errorf("target is required for %s", cmd.Action)
+	}
+
+	return cmd, nil
+}
+
+// parseLegacyCommand 解析字符串格式的命令
+// 格式示例: "list"、"wake:nas1"、"ping:@backup"、"shutdown:*" 或 "discover:192.168.1.0/24"
+func parseLegacyCommand(command string) (Command, error) {
+	action, target, hasTarget := strings.Cut(command, ":")
+
+	switch {
+	case globalActions[action] && !hasTarget:
+		return Command{Action: action}, nil
+	case action == "discover":
+		return Command{Action: action, Args: map[string]interface{}{"subnet": target}}, nil
+	case targetActions[action] && hasTarget:
+		return Command{Action: action, Target: target}, nil
+	}
+
+	return Command{}, fmt.Errorf("%w: %s", ErrUnknownCommand, command)
+}
+
+// StringArg 返回字符串类型的参数，不存在或类型不是字符串时返回空字符串
+func (c Command) StringArg(name string) string {
+	value, _ := c.Args[name].(string)
+	return value
+}
+
+// request 定义正在处理的命令，用于将响应和进度消息关联到命令
+type request struct {
+	Command
+	json            bool            // 命令是否为JSON格式，JSON格式命令的响应也使用JSON格式
+	responseTopic   string          // MQTT v5请求的响应主题，为空时发布到 "<topic>/response"
+	correlationData []byte          // MQTT v5请求的关联数据，响应中原样返回
+	ctx             context.Context // 定时任务的上下文，调度器停止时取消，为nil时不会被取消
+}
+
+// context 返回命令的上下文，唤醒和等待设备上线在上下文取消时提前结束
+func (r *request) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// DeviceInfo 定义list命令返回的设备信息
+type DeviceInfo struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac"`
+	IP    string   `json:"ip"`
+	State string   `json:"state"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// ScheduleInfo 定义schedules命令返回的定时任务信息
+type ScheduleInfo struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Next   int64  `json:"next"` // 下一次执行的Unix时间戳
+}
+
+// BrokerData 定义broker命令返回的MQTT服务器信息
+type BrokerData struct {
+	Active    string   `json:"active"`    // 当前连接的服务器地址
+	Preferred bool     `json:"preferred"` // 当前连接的是否为优先级最高的服务器
+	Brokers   []string `json:"brokers"`   // 按优先级排列的服务器地址
+}
+
+// StateData 定义设备电源状态的结构化结果
+type StateData struct {
+	State   string `json:"state"`
+	Since   int64  `json:"since"` // 进入当前状态的Unix时间戳
+	Reason  string `json:"reason,omitempty"`
+	Address string `json:"address,omitempty"` // 动态解析到的地址
+}
+
+// PingData 定义ping命令的结构化结果
+type PingData struct {
+	Address    string  `json:"address"`
+	Reachable  bool    `json:"reachable"`
+	Sent       int     `json:"sent"`
+	Received   int     `json:"received"`
+	PacketLoss float64 `json:"packet_loss"` // 丢包率(百分比)
+	MinRTT     float64 `json:"min_rtt_ms"`
+	AvgRTT     float64 `json:"avg_rtt_ms"`
+	MaxRTT     float64 `json:"max_rtt_ms"`
+}
+
+// CheckData 定义健康检查的结构化结果
+type CheckData struct {
+	Address string            `json:"address,omitempty"`
+	Passed  bool              `json:"passed"`
+	Checks  []CheckResultData `json:"checks"`
+}
+
+// CheckResultData 定义单个健康检查的结构化结果
+type CheckResultData struct {
+	Name     string  `json:"name"`
+	Passed   bool    `json:"passed"`
+	Message  string  `json:"message"`
+	Duration float64 `json:"duration_ms"`
+}
+
+// DiscoverData 定义discover命令的结构化结果
+type DiscoverData struct {
+	Hosts   []DiscoveredHost `json:"hosts"`
+	Entries string           `json:"entries"` // 候选的devices配置
+}
+
+// DeviceResult 定义对多个设备执行命令时单个设备的结果
+type DeviceResult struct {
+	Device  string      `json:"device"`
+	OK      bool        `json:"ok"`
+	Status  int         `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// TargetSummary 定义对多个设备执行命令的汇总结果
+type TargetSummary struct {
+	Succeeded int            `json:"succeeded"`
+	Total     int            `json:"total"`
+	Results   []DeviceResult `json:"results"`
+}
+
+// newPingData 根据Ping统计结果创建结构化结果
+func newPingData(stats *PingStats) PingData {
+	return PingData{
+		Address:    stats.Address,
+		Reachable:  stats.Reachable(),
+		Sent:       stats.Sent,
+		Received:   stats.Received,
+		PacketLoss: stats.PacketLoss,
+		MinRTT:     milliseconds(stats.MinRTT),
+		AvgRTT:     milliseconds(stats.AvgRTT),
+		MaxRTT:     milliseconds(stats.MaxRTT),
+	}
+}
+
+// newCheckData 根据健康检查结果创建结构化结果
+func newCheckData(device *config.DeviceConfig, results []CheckResult) CheckData {
+	data := CheckData{
+		Address: device.IP,
+		Passed:  checksPassed(results),
+		Checks:  make([]CheckResultData, 0, len(results)),
+	}
+	for _, result := range results {
+		data.Checks = append(data.Checks, CheckResultData{
+			Name:     result.Name,
+			Passed:   result.Passed,
+			Message:  result.Message,
+			Duration: milliseconds(result.Duration),
+		})
+	}
+	return data
+}
+
+// milliseconds 将时长转换为毫秒
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// reply 发布命令的响应
+// JSON格式的命令发布包含请求ID、状态码和结构化结果的JSON响应，字符串命令只发布消息文本
+func (c *Controller) reply(req *request, status int, message string, data interface{}) {
+	if !req.json {
+		c.publishResponse(req, message)
+		return
+	}
+
+	payload, err := json.Marshal(Response{
+		ID:      req.ID,
+		Action:  req.Action,
+		Target:  req.Target,
+		Status:  status,
+		Message: message,
+		Data:    data,
+	})
+	if err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		return
+	}
+	c.publishResponse(req, string(payload))
+}
+
+// progress 发布命令的中间进度
+func (c *Controller) progress(req *request, message string) {
+	c.reply(req, STATUS_PROGRESS, message, nil)
+}
+
+// publishResponse 发布响应消息
+// 请求指定了响应主题时只发布给请求方，否则发布到 "<topic>/response"
+// 断线期间启用了消息队列时，响应在重新连接后发布
+func (c *Controller) publishResponse(req *request, message string) {
+	var err error
+	if req.responseTopic != "" {
+		props := &mqttClient.Properties{CorrelationData: req.correlationData}
+		err = c.mqtt.PublishWithProperties(req.responseTopic, byte(c.config.MQTT.QoS), false, message, props)
+	} else {
+		err = c.mqtt.Publish(c.config.MQTT.Topic+"/response", byte(c.config.MQTT.QoS), false, message)
+	}
+	if err != nil {
+		log.Printf("Failed to publish response: %v", err)
+	}
+}
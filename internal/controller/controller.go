@@ -1,169 +1,330 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/fbigun/smartwaker/internal/config"
 	mqttClient "github.com/fbigun/smartwaker/internal/mqtt"
 )
 
+// MQTTClient 定义控制端使用的MQTT客户端接口
+type MQTTClient interface {
+	Connect() error
+	Subscribe(topic string, qos byte, callback mqtt.MessageHandler) error
+	Publish(topic string, qos byte, retained bool, payload interface{}) error
+	PublishWithProperties(topic string, qos byte, retained bool, payload interface{}, props *mqttClient.Properties) error
+	Disconnect()
+	IsConnected() bool
+	BrokerStatus() mqttClient.BrokerStatus
+}
+
 // Controller 控制端实现
 type Controller struct {
-	config *config.Config
-	mqtt   *mqttClient.Client
+	config    *config.Config
+	mqtt      MQTTClient
+	scheduler *Scheduler
+	monitor   *Monitor
+	power     *PowerTracker
+	resolver  *Resolver
+}
+
+// NewController 创建控制端，client用于订阅命令和发布响应
+func NewController(cfg *config.Config, client MQTTClient) *Controller {
+	return &Controller{
+		config:   cfg,
+		mqtt:     client,
+		power:    NewPowerTracker(cfg.Devices),
+		resolver: NewResolver(cfg.Resolve),
+	}
 }
 
 // Start 启动控制端
 func Start(cfg *config.Config) (func(), error) {
-	ctrl := &Controller{
-		config: cfg,
-	}
+	ctrl := NewController(cfg, nil)
+
+	// 获取或核对设备的MAC地址
+	learnMACs(cfg.Devices)
 
 	// 创建并连接MQTT客户端
-	client := mqttClient.NewClient(&cfg.MQTT, ctrl.handleMessage)
+	client := mqttClient.NewClient(&cfg.MQTT, ctrl.HandleMessage)
+	client.SetOnConnect(ctrl.onConnect)
+	if cfg.MQTT.Availability.Enabled {
+		client.SetAvailability(cfg.AvailabilityTopic())
+	}
 	if err := client.Connect(); err != nil {
 		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
 	}
 	ctrl.mqtt = client
 
-	// 订阅控制主题
-	if err := client.Subscribe(cfg.MQTT.Topic, byte(cfg.MQTT.QoS), ctrl.handleMessage); err != nil {
+	// 断开连接前发布下线消息
+	disconnect := func() {
+		if err := client.PublishOffline(); err != nil {
+			log.Printf("Failed to publish offline status: %v", err)
+		}
 		client.Disconnect()
+	}
+
+	// 订阅控制主题
+	if err := client.Subscribe(cfg.MQTT.Topic, byte(cfg.MQTT.QoS), ctrl.HandleMessage); err != nil {
+		disconnect()
 		return nil, fmt.Errorf("failed to subscribe to topic: %w", err)
 	}
 
+	// 启动定时任务
+	if len(cfg.Schedules) > 0 {
+		scheduler, err := NewScheduler(cfg.Schedules, ctrl.runSchedule)
+		if err != nil {
+			disconnect()
+			return nil, fmt.Errorf("failed to create scheduler: %w", err)
+		}
+		scheduler.Start()
+		ctrl.scheduler = scheduler
+		log.Printf("Scheduler started with %d schedules", len(cfg.Schedules))
+	}
+
+	// 启动设备在线状态监控
+	if cfg.Monitor.Enabled {
+		ctrl.monitor = NewMonitor(cfg, client)
+		ctrl.monitor.Probe = ctrl.isUp
+		ctrl.monitor.OnCheck = func(device *config.DeviceConfig, up bool) {
+			ctrl.power.Observe(device.Name, up)
+		}
+		ctrl.monitor.Start()
+		log.Printf("Presence monitor started. Publishing device states to topic: %s/devices/+/state", cfg.MQTT.Topic)
+	}
+
 	log.Printf("Controller started. Listening on topic: %s", cfg.MQTT.Topic)
 
 	// 返回清理函数
 	cleanup := func() {
-		if client != nil {
-			client.Disconnect()
+		if ctrl.scheduler != nil {
+			ctrl.scheduler.Stop()
+		}
+		if ctrl.monitor != nil {
+			ctrl.monitor.Stop()
 		}
+		ctrl.power.Stop()
+		disconnect()
 	}
 
 	return cleanup, nil
 }
 
-// handleMessage 处理接收到的MQTT消息
-func (c *Controller) handleMessage(client mqtt.Client, msg mqtt.Message) {
+// onConnect MQTT连接成功回调，重新连接后补发断线期间无法发布的设备状态
+func (c *Controller) onConnect(reconnected bool) {
+	if reconnected && c.monitor != nil {
+		c.monitor.PublishStates()
+	}
+}
+
+// HandleMessage 处理接收到的MQTT消息
+// 支持JSON格式的命令（响应也使用JSON格式并返回请求ID）和 "wake:nas1" 这样的字符串命令
+// MQTT v5消息带有响应主题时，响应发布到该主题并附带请求的关联数据
+func (c *Controller) HandleMessage(client mqtt.Client, msg mqtt.Message) {
 	log.Printf("Received message on topic %s: %s", msg.Topic(), string(msg.Payload()))
 
-	// 处理命令消息
-	command := string(msg.Payload())
-	
 	// 解析命令和参数
-	// 格式示例: "wake:nas1" 或 "ping:nas1"
-	switch {
-	case command == "list":
-		go c.listDevices()
-	case len(command) >= 5 && command[:5] == "wake:":
-		deviceName := command[5:]
-		go c.wakeDevice(deviceName)
-	case len(command) >= 5 && command[:5] == "ping:":
-		deviceName := command[5:]
-		go c.pingDevice(deviceName)
-	default:
-		log.Printf("Unknown command: %s", command)
+	// 格式示例: "wake:nas1"、"ping:nas1"、"wake:@backup"、"wake:*"
+	// 或 {"id":"42","action":"wake","target":"nas1"}
+	cmd, isJSON, err := ParseCommand(msg.Payload())
+	req := &request{Command: cmd, json: isJSON}
+	if props := mqttClient.PropertiesOf(msg); props != nil {
+		req.responseTopic = props.ResponseTopic
+		req.correlationData = props.CorrelationData
 	}
-	
+	if err != nil {
+		log.Printf("Invalid command: %v", err)
+		if isJSON {
+			c.reply(req, STATUS_BAD_REQUEST, fmt.Sprintf("Error: %v", err), nil)
+		}
+	} else {
+		c.dispatch(req)
+	}
+
 	// 确保消息被标记为已处理
 	msg.Ack()
 }
 
-// listDevices 列出所有已配置的设备
-func (c *Controller) listDevices() {
-	log.Println("Listing all configured devices:")
-	
-	for i, device := range c.config.Devices {
-		log.Printf("[%d] %s (MAC: %s, IP: %s)", i+1, device.Name, device.MAC, device.IP)
-	}
-	
-	// 发布设备列表回应
-	if c.mqtt.IsConnected() {
-		var response string
-		for i, device := range c.config.Devices {
-			response += fmt.Sprintf("[%d] %s (IP: %s)\n", i+1, device.Name, device.IP)
-		}
-		
-		if err := c.mqtt.Publish(c.config.MQTT.Topic+"/response", byte(c.config.MQTT.QoS), false, response); err != nil {
-			log.Printf("Failed to publish device list: %v", err)
-		}
+// dispatch 根据命令的动作在后台执行命令
+func (c *Controller) dispatch(req *request) {
+	switch req.Action {
+	case "list":
+		go c.listDevices(req)
+	case "schedules":
+		go c.listSchedules(req)
+	case "broker":
+		go c.brokerStatus(req)
+	case "discover":
+		go c.discover(req)
+	case "wake":
+		go c.runOnTargets(req, c.wakeDevice)
+	case "ping":
+		go c.runOnTargets(req, c.pingDevice)
+	case "shutdown":
+		go c.runOnTargets(req, c.shutdownDevice)
+	case "state":
+		go c.runOnTargets(req, c.deviceState)
+	default:
+		log.Printf("Unknown command: %s", req.Action)
+		c.reply(req, STATUS_BAD_REQUEST, fmt.Sprintf("Error: %v: %s", ErrUnknownCommand, req.Action), nil)
 	}
 }
 
-// wakeDevice 唤醒指定的设备
-func (c *Controller) wakeDevice(deviceName string) {
-	var targetDevice *config.DeviceConfig
-	
-	// 查找目标设备
-	for _, device := range c.config.Devices {
-		if device.Name == deviceName {
-			targetDevice = &device
-			break
+// operationResult 定义对单个设备执行操作的结果
+type operationResult struct {
+	device  string      // 设备名称
+	message string      // 结果消息
+	ok      bool        // 操作是否成功
+	status  int         // 状态码，为0时根据ok确定
+	data    interface{} // 结构化结果
+}
+
+// statusCode 返回结果的状态码
+func (r operationResult) statusCode() int {
+	switch {
+	case r.status != 0:
+		return r.status
+	case r.ok:
+		return STATUS_OK
+	default:
+		return STATUS_FAILED
+	}
+}
+
+// operation 定义对单个设备执行的操作
+type operation func(req *request, device *config.DeviceConfig) operationResult
+
+// runOnTargets 对命令的目标设备执行操作并发布结果
+// 目标可以是单个设备名称、"@组名或标签"或"*"（所有设备）
+// 单个设备时直接发布结果，多个设备时并发执行并在全部完成后发布汇总结果
+func (c *Controller) runOnTargets(req *request, op operation) {
+	devices, err := c.config.ResolveDevices(req.Target)
+	if err != nil {
+		log.Printf("Failed to resolve target %s: %v", req.Target, err)
+		if errors.Is(err, config.ErrDeviceNotFound) {
+			c.reply(req, STATUS_NOT_FOUND, fmt.Sprintf("Error: Device not found: %s", req.Target), nil)
+		} else {
+			c.reply(req, STATUS_BAD_REQUEST, fmt.Sprintf("Error: %v", err), nil)
 		}
+		return
 	}
-	
-	if targetDevice == nil {
-		log.Printf("Device not found: %s", deviceName)
-		c.publishResponse(fmt.Sprintf("Error: Device not found: %s", deviceName))
+
+	// 单个设备直接发布结果
+	if !config.IsMultiTarget(req.Target) {
+		result := op(req, devices[0])
+		c.reply(req, result.statusCode(), result.message, result.data)
 		return
 	}
-	
-	// 执行唤醒
-	log.Printf("Waking up device: %s (MAC: %s)", targetDevice.Name, targetDevice.MAC)
-	err := WakeOnLAN(targetDevice.MAC, targetDevice.IP, targetDevice.Port)
-	
-	if err != nil {
-		log.Printf("Failed to wake device %s: %v", targetDevice.Name, err)
-		c.publishResponse(fmt.Sprintf("Error waking device %s: %v", targetDevice.Name, err))
-	} else {
-		log.Printf("Wake-on-LAN packet sent to %s", targetDevice.Name)
-		c.publishResponse(fmt.Sprintf("Wake-on-LAN packet sent to %s", targetDevice.Name))
+
+	// 多个设备并发执行
+	results := make([]operationResult, len(devices))
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		wg.Add(1)
+		go func(i int, device *config.DeviceConfig) {
+			defer wg.Done()
+			results[i] = op(req, device)
+		}(i, device)
+	}
+	wg.Wait()
+
+	// 汇总每个设备的结果
+	summary := TargetSummary{Total: len(results)}
+	var lines []string
+	for _, result := range results {
+		status := "FAILED"
+		if result.ok {
+			status = "OK"
+			summary.Succeeded++
+		}
+		lines = append(lines, fmt.Sprintf("[%s] %s: %s", status, result.device, result.message))
+		summary.Results = append(summary.Results, DeviceResult{
+			Device:  result.device,
+			OK:      result.ok,
+			Status:  result.statusCode(),
+			Message: result.message,
+			Data:    result.data,
+		})
+	}
+
+	message := fmt.Sprintf("%s %s: %d/%d succeeded\n%s", req.Action, req.Target, summary.Succeeded, summary.Total, strings.Join(lines, "\n"))
+	log.Print(message)
+
+	code := STATUS_OK
+	if summary.Succeeded == 0 && summary.Total > 0 {
+		code = STATUS_FAILED
+	} else if summary.Succeeded < summary.Total {
+		code = STATUS_PARTIAL
 	}
+	c.reply(req, code, message, summary)
 }
 
-// pingDevice ping指定的设备
-func (c *Controller) pingDevice(deviceName string) {
-	var targetDevice *config.DeviceConfig
-	
-	// 查找目标设备
-	for _, device := range c.config.Devices {
-		if device.Name == deviceName {
-			targetDevice = &device
-			break
+// runSchedule 执行定时任务，结果以字符串格式发布
+// 调度器停止时取消ctx，正在进行的唤醒和等待提前结束
+func (c *Controller) runSchedule(ctx context.Context, schedule config.ScheduleConfig) {
+	req := &request{Command: Command{Action: schedule.Action, Target: schedule.Target}, ctx: ctx}
+
+	switch schedule.Action {
+	case "wake":
+		op := c.wakeDevice
+		if schedule.SkipIfOnline {
+			op = c.skipIfOnline(c.wakeDevice)
 		}
+		c.runOnTargets(req, op)
+	case "ping":
+		c.runOnTargets(req, c.pingDevice)
+	case "shutdown":
+		c.runOnTargets(req, c.shutdownDevice)
+	default:
+		log.Printf("Unknown schedule action: %s", schedule.Action)
 	}
-	
-	if targetDevice == nil {
-		log.Printf("Device not found: %s", deviceName)
-		c.publishResponse(fmt.Sprintf("Error: Device not found: %s", deviceName))
-		return
+}
+
+// resolve 解析设备当前的IP地址，返回填充了解析结果的设备配置副本
+// 不需要动态解析或解析失败时返回原配置
+func (c *Controller) resolve(device *config.DeviceConfig) (*config.DeviceConfig, ResolvedAddress, error) {
+	address, err := c.resolver.Resolve(device)
+	if err != nil || address.Source == RESOLVE_STATIC {
+		return device, address, err
 	}
-	
-	// 执行ping测试
-	log.Printf("Pinging device: %s (IP: %s)", targetDevice.Name, targetDevice.IP)
-	isReachable, rtt, err := PingHost(targetDevice.IP)
-	
-	if err != nil {
-		log.Printf("Failed to ping device %s: %v", targetDevice.Name, err)
-		c.publishResponse(fmt.Sprintf("Error pinging device %s: %v", targetDevice.Name, err))
-	} else if isReachable {
-		log.Printf("Device %s is reachable, RTT: %v", targetDevice.Name, rtt)
-		c.publishResponse(fmt.Sprintf("Device %s is reachable, RTT: %v", targetDevice.Name, rtt))
-	} else {
-		log.Printf("Device %s is not reachable", targetDevice.Name)
-		c.publishResponse(fmt.Sprintf("Device %s is not reachable", targetDevice.Name))
+
+	resolved := *device
+	resolved.IP = address.IP
+	return &resolved, address, nil
+}
+
+// isUp 解析设备地址并检查设备是否在线
+// 设备不在线时清除缓存的解析结果，下次检测时重新解析（设备重启后可能获得新的地址）
+func (c *Controller) isUp(device *config.DeviceConfig) bool {
+	resolved, _, _ := c.resolve(device)
+	if isDeviceUp(resolved) {
+		return true
 	}
+
+	c.resolver.Forget(device.Name)
+	return false
 }
 
-// publishResponse 发布响应消息
-func (c *Controller) publishResponse(message string) {
-	if c.mqtt.IsConnected() {
-		responseTopic := c.config.MQTT.Topic + "/response"
-		if err := c.mqtt.Publish(responseTopic, byte(c.config.MQTT.QoS), false, message); err != nil {
-			log.Printf("Failed to publish response: %v", err)
-		}
+// waitForDevice 轮询设备直到其在线或超时，动态解析地址的设备每次检测前重新解析地址
+func (c *Controller) waitForDevice(ctx context.Context, device *config.DeviceConfig, timeout time.Duration, progress func(elapsed time.Duration)) (time.Duration, bool) {
+	if !isDynamic(device) {
+		return waitForDeviceReady(ctx, device, timeout, progress)
+	}
+	return waitUntil(ctx, func() bool { return c.isUp(device) }, true, timeout, progress)
+}
+
+// addressOf 返回设备当前地址的显示文本
+func (c *Controller) addressOf(device *config.DeviceConfig) string {
+	address, err := c.resolver.Resolve(device)
+	if err != nil {
+		return "unresolved"
 	}
+	return address.String()
 }
@@ -0,0 +1,332 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+const (
+	// DEFAULT_DISCOVER_TIMEOUT 等待每个主机应答的默认超时时间
+	DEFAULT_DISCOVER_TIMEOUT = 500 * time.Millisecond
+	// DEFAULT_DISCOVER_WORKERS 同时探测的主机数量
+	DEFAULT_DISCOVER_WORKERS = 64
+	// DISCOVER_LOOKUP_TIMEOUT 反向DNS解析的超时时间
+	DISCOVER_LOOKUP_TIMEOUT = time.Second
+)
+
+// invalidNameChars 匹配设备名称中不允许的字符
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// DiscoverOptions 定义设备发现选项
+type DiscoverOptions struct {
+	Timeout time.Duration // 等待每个主机应答的超时时间
+	Workers int           // 同时探测的主机数量
+	Vendors OUITable      // 用于查询MAC地址厂商的OUI表
+}
+
+// DiscoveredHost 定义发现的主机
+type DiscoveredHost struct {
+	IP       string        `json:"ip"`                 // IP地址
+	MAC      string        `json:"mac,omitempty"`      // MAC地址，通过ICMP发现且不在本地网段时为空
+	Hostname string        `json:"hostname,omitempty"` // 反向DNS解析得到的主机名
+	Vendor   string        `json:"vendor,omitempty"`   // 网卡厂商
+	Method   string        `json:"method"`             // 发现方式：arp 或 icmp
+	RTT      time.Duration `json:"-"`                  // 应答时间
+}
+
+// NewDiscoverOptions 根据配置创建设备发现选项
+func NewDiscoverOptions(cfg config.DiscoverConfig) (DiscoverOptions, error) {
+	vendors, err := LoadOUITable(cfg.OUIFile)
+	if err != nil {
+		return DiscoverOptions{}, err
+	}
+
+	timeout := time.Duration(cfg.Timeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = DEFAULT_DISCOVER_TIMEOUT
+	}
+
+	return DiscoverOptions{
+		Timeout: timeout,
+		Workers: DEFAULT_DISCOVER_WORKERS,
+		Vendors: vendors,
+	}, nil
+}
+
+// Discover 扫描子网中的在线主机，按IP地址排序返回
+// 同一网段的主机通过ARP请求探测（需要CAP_NET_RAW），无法发送ARP请求时使用ICMP并从邻居表中查找MAC地址
+// subnets为空时扫描本地网卡所在的IPv4子网
+func Discover(ctx context.Context, subnets []string, opts DiscoverOptions) ([]DiscoveredHost, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEFAULT_DISCOVER_TIMEOUT
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DEFAULT_DISCOVER_WORKERS
+	}
+
+	if len(subnets) == 0 {
+		subnets = localSubnets()
+		if len(subnets) == 0 {
+			return nil, fmt.Errorf("no local IPv4 subnets to scan")
+		}
+	}
+
+	var targets []net.IP
+	for _, subnet := range subnets {
+		if err := config.ValidateDiscoverSubnet(subnet); err != nil {
+			return nil, err
+		}
+		_, network, _ := net.ParseCIDR(subnet)
+		targets = append(targets, subnetHosts(network)...)
+	}
+
+	log.Printf("Discovering devices on %s (%d addresses)", strings.Join(subnets, ", "), len(targets))
+
+	jobs := make(chan net.IP)
+	var hosts []DiscoveredHost
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range jobs {
+				host, ok := probeHost(ip, opts)
+				if !ok {
+					continue
+				}
+				mu.Lock()
+				hosts = append(hosts, host)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, ip := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- ip
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("discovery cancelled: %w", err)
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(hosts[i].IP).To4(), net.ParseIP(hosts[j].IP).To4()) < 0
+	})
+	return hosts, nil
+}
+
+// probeHost 探测单个主机是否在线，并收集MAC地址、主机名和厂商
+func probeHost(ip net.IP, opts DiscoverOptions) (DiscoveredHost, bool) {
+	host := DiscoveredHost{IP: ip.String()}
+
+	mac, rtt, err := ARPPing(host.IP, "", opts.Timeout)
+	switch {
+	case err == nil:
+		host.MAC = mac.String()
+		host.Method = CHECK_ARP
+		host.RTT = rtt
+	case errors.Is(err, ErrNoARPReply):
+		// 同一网段的主机即使屏蔽了ICMP也会应答ARP请求
+		return host, false
+	default:
+		// 无法发送ARP请求（缺少权限、不在本地网段或平台不支持）时使用ICMP
+		stats, err := Ping(host.IP, PingOptions{Count: 1, Timeout: opts.Timeout})
+		if err != nil || !stats.Reachable() {
+			return host, false
+		}
+		host.Method = CHECK_ICMP
+		host.RTT = stats.AvgRTT
+		if mac, err := LookupNeighbor(ip); err == nil {
+			host.MAC = mac.String()
+		}
+	}
+
+	host.Hostname = reverseLookup(host.IP)
+	if host.MAC != "" && opts.Vendors != nil {
+		host.Vendor = opts.Vendors.Lookup(host.MAC)
+	}
+	return host, true
+}
+
+// reverseLookup 通过反向DNS解析IP地址对应的主机名，失败时返回空字符串
+func reverseLookup(ip string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), DISCOVER_LOOKUP_TIMEOUT)
+	defer cancel()
+
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// localSubnets 返回本地网卡所在的IPv4子网，跳过回环网卡和过大的子网
+func localSubnets() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var subnets []string
+	seen := make(map[string]bool)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+
+			network := &net.IPNet{IP: ipNet.IP.Mask(ipNet.Mask), Mask: ipNet.Mask}
+			subnet := network.String()
+			if seen[subnet] {
+				continue
+			}
+			seen[subnet] = true
+
+			if err := config.ValidateDiscoverSubnet(subnet); err != nil {
+				log.Printf("Skipping subnet %s on %s: %v", subnet, iface.Name, err)
+				continue
+			}
+			subnets = append(subnets, subnet)
+		}
+	}
+
+	return subnets
+}
+
+// subnetHosts 返回子网中所有可用的主机地址，不包括网络地址和广播地址（/31和/32除外）
+func subnetHosts(network *net.IPNet) []net.IP {
+	base := network.IP.To4()
+	ones, bits := network.Mask.Size()
+	size := uint32(1) << uint(bits-ones)
+	start := uint32(base[0])<<24 | uint32(base[1])<<16 | uint32(base[2])<<8 | uint32(base[3])
+
+	first, last := uint32(0), size-1
+	if size > 2 {
+		first, last = 1, size-2
+	}
+
+	hosts := make([]net.IP, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		n := start + i
+		hosts = append(hosts, net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)).To4())
+	}
+	return hosts
+}
+
+// FormatDeviceEntries 将发现的主机格式化为可以合并到配置文件中的devices配置
+// 已经配置过的主机（MAC或IP相同）只输出注释，MAC地址未知的主机注释掉mac配置
+func FormatDeviceEntries(hosts []DiscoveredHost, known []config.DeviceConfig) string {
+	var b strings.Builder
+	b.WriteString("devices:\n")
+
+	names := make(map[string]bool)
+	for _, device := range known {
+		names[device.Name] = true
+	}
+
+	for _, host := range hosts {
+		if device := knownDevice(host, known); device != nil {
+			fmt.Fprintf(&b, "  # %s (%s) is already configured as %s\n", host.IP, macOrUnknown(host.MAC), device.Name)
+			continue
+		}
+
+		fmt.Fprintf(&b, "  # %s\n", describeHost(host))
+		fmt.Fprintf(&b, "  - name: %s\n", strconv.Quote(uniqueName(deviceName(host), names)))
+		if host.MAC != "" {
+			fmt.Fprintf(&b, "    mac: %s\n", strconv.Quote(host.MAC))
+		} else {
+			// 只通过ICMP发现的主机没有MAC地址，空的mac会使配置无法直接使用
+			b.WriteString("    # mac: \"\" # TODO: MAC address unknown, set it to wake this device via Wake-on-LAN\n")
+		}
+		fmt.Fprintf(&b, "    ip: %s\n", strconv.Quote(host.IP))
+		if host.Hostname != "" {
+			fmt.Fprintf(&b, "    hostname: %s\n", strconv.Quote(host.Hostname))
+		}
+	}
+
+	return b.String()
+}
+
+// knownDevice 查找与发现的主机MAC或IP相同的已配置设备
+func knownDevice(host DiscoveredHost, known []config.DeviceConfig) *config.DeviceConfig {
+	for i := range known {
+		device := &known[i]
+		if host.MAC != "" && device.MAC != "" && sameMAC(host.MAC, device.MAC) {
+			return device
+		}
+		if device.IP != "" && device.IP == host.IP {
+			return device
+		}
+	}
+	return nil
+}
+
+// describeHost 返回发现的主机的注释说明，如 "192.168.1.23 Synology Incorporated, arp reply in 1.2ms"
+func describeHost(host DiscoveredHost) string {
+	parts := []string{host.IP}
+	if host.Vendor != "" {
+		parts = append(parts, host.Vendor+",")
+	}
+	if host.MAC == "" {
+		parts = append(parts, "MAC unknown,")
+	}
+	parts = append(parts, fmt.Sprintf("%s reply in %v", host.Method, host.RTT.Round(time.Microsecond)))
+	return strings.Join(parts, " ")
+}
+
+// deviceName 根据主机名生成设备名称，没有主机名时使用IP地址
+func deviceName(host DiscoveredHost) string {
+	if host.Hostname != "" {
+		label := strings.SplitN(host.Hostname, ".", 2)[0]
+		if name := strings.Trim(invalidNameChars.ReplaceAllString(label, "-"), "-"); name != "" {
+			return name
+		}
+	}
+	return "host-" + strings.ReplaceAll(host.IP, ".", "-")
+}
+
+// uniqueName 在名称重复时添加数字后缀，并记录已使用的名称
+func uniqueName(name string, used map[string]bool) string {
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// macOrUnknown 返回MAC地址，为空时返回 "MAC unknown"
+func macOrUnknown(mac string) string {
+	if mac == "" {
+		return "MAC unknown"
+	}
+	return mac
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+// listDevices 列出所有已配置的设备
+func (c *Controller) listDevices(req *request) {
+	log.Println("Listing all configured devices:")
+
+	var response string
+	devices := make([]DeviceInfo, 0, len(c.config.Devices))
+	for i := range c.config.Devices {
+		device := &c.config.Devices[i]
+		info := DeviceInfo{
+			Name:  device.Name,
+			MAC:   device.MAC,
+			IP:    c.addressOf(device),
+			State: c.power.Get(device.Name).State,
+			Tags:  device.Tags,
+		}
+		devices = append(devices, info)
+
+		log.Printf("[%d] %s (MAC: %s, IP: %s, state: %s)", i+1, info.Name, info.MAC, info.IP, info.State)
+		response += fmt.Sprintf("[%d] %s (IP: %s, state: %s)\n", i+1, info.Name, info.IP, info.State)
+	}
+
+	// 发布设备列表回应
+	c.reply(req, STATUS_OK, response, devices)
+}
+
+// listSchedules 列出所有定时任务及其下一次执行时间
+func (c *Controller) listSchedules(req *request) {
+	if c.scheduler == nil {
+		c.reply(req, STATUS_OK, "No schedules configured", []ScheduleInfo{})
+		return
+	}
+
+	var response string
+	var schedules []ScheduleInfo
+	for i, run := range c.scheduler.NextRuns() {
+		response += fmt.Sprintf("[%d] %s: %s %s, next run at %s\n", i+1, run.Name, run.Action, run.Target, run.Next.Format(time.RFC3339))
+		schedules = append(schedules, ScheduleInfo{Name: run.Name, Action: run.Action, Target: run.Target, Next: run.Next.Unix()})
+	}
+
+	log.Printf("Schedules:\n%s", response)
+	c.reply(req, STATUS_OK, response, schedules)
+}
+
+// brokerStatus 发布当前连接的MQTT服务器和按优先级排列的服务器列表
+func (c *Controller) brokerStatus(req *request) {
+	status := c.mqtt.BrokerStatus()
+	data := BrokerData{Active: status.Active, Preferred: status.Preferred, Brokers: status.Brokers}
+
+	response := fmt.Sprintf("Connected to MQTT broker %s", status.Active)
+	if !status.Connected {
+		response = "Not connected to MQTT broker"
+	} else if !status.Preferred {
+		response += " (fallback)"
+	}
+	for i, broker := range status.Brokers {
+		response += fmt.Sprintf("\n[%d] %s", i+1, broker)
+	}
+	c.reply(req, STATUS_OK, response, data)
+}
+
+// discover 扫描子网并发布候选的设备配置
+// 参数subnet为空时扫描discover.subnets中配置的子网，未配置时扫描本地网卡所在的子网
+func (c *Controller) discover(req *request) {
+	subnets := c.config.Discover.Subnets
+	if subnet := req.StringArg("subnet"); subnet != "" {
+		if err := config.ValidateDiscoverSubnet(subnet); err != nil {
+			c.reply(req, STATUS_BAD_REQUEST, fmt.Sprintf("Error discovering devices: %v", err), nil)
+			return
+		}
+		subnets = []string{subnet}
+	}
+
+	opts, err := NewDiscoverOptions(c.config.Discover)
+	if err != nil {
+		log.Printf("Failed to discover devices: %v", err)
+		c.reply(req, STATUS_FAILED, fmt.Sprintf("Error discovering devices: %v", err), nil)
+		return
+	}
+
+	c.progress(req, "Discovering devices, this may take a while...")
+	hosts, err := Discover(req.context(), subnets, opts)
+	if err != nil {
+		log.Printf("Failed to discover devices: %v", err)
+		c.reply(req, STATUS_FAILED, fmt.Sprintf("Error discovering devices: %v", err), nil)
+		return
+	}
+
+	entries := FormatDeviceEntries(hosts, c.config.Devices)
+	response := fmt.Sprintf("Discovered %d hosts\n%s", len(hosts), entries)
+	log.Print(response)
+	c.reply(req, STATUS_OK, response, DiscoverData{Hosts: hosts, Entries: entries})
+}
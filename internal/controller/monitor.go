@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+const (
+	// PRESENCE_UNKNOWN 尚未检测过设备
+	PRESENCE_UNKNOWN = "unknown"
+	// PRESENCE_ONLINE 设备在线
+	PRESENCE_ONLINE = "online"
+	// PRESENCE_OFFLINE 设备离线
+	PRESENCE_OFFLINE = "offline"
+
+	// DEFAULT_MONITOR_INTERVAL 默认检测间隔
+	DEFAULT_MONITOR_INTERVAL = 30 * time.Second
+	// DEFAULT_ONLINE_THRESHOLD 默认连续检测成功多少次后视为上线
+	DEFAULT_ONLINE_THRESHOLD = 1
+	// DEFAULT_OFFLINE_THRESHOLD 默认连续检测失败多少次后视为离线
+	DEFAULT_OFFLINE_THRESHOLD = 3
+)
+
+// Publisher 定义发布MQTT消息的接口
+type Publisher interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) error
+}
+
+// Presence 设备在线状态机：unknown -> online <-> offline
+// 只有连续多次检测结果一致且距离上一次状态变化超过保持时间时才切换状态
+type Presence struct {
+	State     string    // 当前状态
+	Since     time.Time // 进入当前状态的时间
+	LastCheck time.Time // 最近一次检测的时间
+	successes int
+	failures  int
+	online    int
+	offline   int
+	holdTime  time.Duration
+}
+
+// NewPresence 创建在线状态机，阈值小于等于0时使用默认值
+func NewPresence(onlineThreshold, offlineThreshold int, holdTime time.Duration) *Presence {
+	if onlineThreshold <= 0 {
+		onlineThreshold = DEFAULT_ONLINE_THRESHOLD
+	}
+	if offlineThreshold <= 0 {
+		offlineThreshold = DEFAULT_OFFLINE_THRESHOLD
+	}
+
+	return &Presence{
+		State:    PRESENCE_UNKNOWN,
+		online:   onlineThreshold,
+		offline:  offlineThreshold,
+		holdTime: holdTime,
+	}
+}
+
+// Observe 记录一次检测结果，状态发生变化时返回变化前的状态和true
+// 从unknown状态出发时第一次检测结果即决定状态
+func (p *Presence) Observe(up bool, now time.Time) (string, bool) {
+	p.LastCheck = now
+	if up {
+		p.successes++
+		p.failures = 0
+	} else {
+		p.failures++
+		p.successes = 0
+	}
+
+	next := p.State
+	switch p.State {
+	case PRESENCE_UNKNOWN:
+		next = PRESENCE_OFFLINE
+		if up {
+			next = PRESENCE_ONLINE
+		}
+	case PRESENCE_ONLINE:
+		if p.failures >= p.offline {
+			next = PRESENCE_OFFLINE
+		}
+	case PRESENCE_OFFLINE:
+		if p.successes >= p.online {
+			next = PRESENCE_ONLINE
+		}
+	}
+
+	if next == p.State {
+		return p.State, false
+	}
+
+	// 抑制频繁切换
+	if p.State != PRESENCE_UNKNOWN && now.Sub(p.Since) < p.holdTime {
+		return p.State, false
+	}
+
+	previous := p.State
+	p.State = next
+	p.Since = now
+	return previous, true
+}
+
+// DeviceStateMessage 定义发布到设备状态主题的消息
+type DeviceStateMessage struct {
+	Device    string `json:"device"`    // 设备名称
+	State     string `json:"state"`     // 当前状态
+	Since     int64  `json:"since"`     // 进入当前状态的Unix时间戳
+	Timestamp int64  `json:"timestamp"` // 最近一次检测的Unix时间戳
+}
+
+// DeviceEventMessage 定义设备状态变化事件
+type DeviceEventMessage struct {
+	Device    string `json:"device"`    // 设备名称
+	From      string `json:"from"`      // 变化前的状态
+	To        string `json:"to"`        // 变化后的状态
+	Timestamp int64  `json:"timestamp"` // 状态变化的Unix时间戳
+}
+
+// Monitor 在后台定期检测设备是否在线，并发布设备状态和状态变化事件
+// 设备状态以保留消息发布到 {topic}/devices/{name}/state
+// 状态变化事件发布到 {topic}/devices/{name}/events
+type Monitor struct {
+	Probe   func(device *config.DeviceConfig) bool     // 检测设备是否在线，默认执行设备的健康检查或Ping
+	OnCheck func(device *config.DeviceConfig, up bool) // 每次检测完成后调用
+
+	config    *config.Config
+	publisher Publisher
+	presences map[string]*Presence
+	mu        sync.RWMutex
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewMonitor 创建设备在线状态监控
+func NewMonitor(cfg *config.Config, publisher Publisher) *Monitor {
+	m := &Monitor{
+		Probe:     isDeviceUp,
+		config:    cfg,
+		publisher: publisher,
+		presences: make(map[string]*Presence),
+		stopChan:  make(chan struct{}),
+	}
+
+	holdTime := time.Duration(cfg.Monitor.HoldTime) * time.Second
+	for _, device := range cfg.Devices {
+		m.presences[device.Name] = NewPresence(cfg.Monitor.OnlineThreshold, cfg.Monitor.OfflineThreshold, holdTime)
+	}
+
+	return m
+}
+
+// Start 为每个可以检测的设备启动检测协程
+// 没有配置ip也没有配置健康检查的设备不会被监控
+func (m *Monitor) Start() {
+	interval := time.Duration(m.config.Monitor.Interval) * time.Second
+	if interval <= 0 {
+		interval = DEFAULT_MONITOR_INTERVAL
+	}
+
+	for i := range m.config.Devices {
+		device := &m.config.Devices[i]
+		if !canCheck(device) {
+			log.Printf("Device %s has no IP address or checks, skipping presence monitoring", device.Name)
+			continue
+		}
+
+		m.wg.Add(1)
+		go m.watch(device, interval)
+	}
+}
+
+// Stop 停止所有检测协程
+func (m *Monitor) Stop() {
+	close(m.stopChan)
+	m.wg.Wait()
+}
+
+// State 返回设备当前的在线状态
+func (m *Monitor) State(name string) (Presence, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	presence, ok := m.presences[name]
+	if !ok {
+		return Presence{}, false
+	}
+	return *presence, true
+}
+
+// PublishStates 重新发布所有已检测过的设备的状态，用于MQTT重新连接后补发断线期间的状态变化
+func (m *Monitor) PublishStates() {
+	for i := range m.config.Devices {
+		name := m.config.Devices[i].Name
+		presence, ok := m.State(name)
+		if !ok || presence.State == PRESENCE_UNKNOWN {
+			continue
+		}
+
+		m.publish(name, "state", true, DeviceStateMessage{
+			Device:    name,
+			State:     presence.State,
+			Since:     presence.Since.Unix(),
+			Timestamp: presence.LastCheck.Unix(),
+		})
+	}
+}
+
+// watch 定期检测设备直到监控停止
+func (m *Monitor) watch(device *config.DeviceConfig, interval time.Duration) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// 立即检测一次
+	m.check(device)
+
+	for {
+		select {
+		case <-ticker.C:
+			m.check(device)
+		case <-m.stopChan:
+			return
+		}
+	}
+}
+
+// check 检测一次设备，状态变化时发布状态和事件
+func (m *Monitor) check(device *config.DeviceConfig) {
+	up := m.Probe(device)
+	now := time.Now()
+
+	if m.OnCheck != nil {
+		m.OnCheck(device, up)
+	}
+
+	m.mu.Lock()
+	presence := m.presences[device.Name]
+	previous, changed := presence.Observe(up, now)
+	snapshot := *presence
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	log.Printf("Device %s is now %s (was %s)", device.Name, snapshot.State, previous)
+
+	m.publish(device.Name, "state", true, DeviceStateMessage{
+		Device:    device.Name,
+		State:     snapshot.State,
+		Since:     snapshot.Since.Unix(),
+		Timestamp: snapshot.LastCheck.Unix(),
+	})
+	m.publish(device.Name, "events", false, DeviceEventMessage{
+		Device:    device.Name,
+		From:      previous,
+		To:        snapshot.State,
+		Timestamp: now.Unix(),
+	})
+}
+
+// publish 将消息编码为JSON并发布到设备的子主题
+func (m *Monitor) publish(device, subtopic string, retained bool, message interface{}) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Failed to encode %s message for device %s: %v", subtopic, device, err)
+		return
+	}
+
+	topic := m.config.MQTT.Topic + "/devices/" + device + "/" + subtopic
+	if err := m.publisher.Publish(topic, byte(m.config.MQTT.QoS), retained, payload); err != nil {
+		log.Printf("Failed to publish %s for device %s: %v", subtopic, device, err)
+	}
+}
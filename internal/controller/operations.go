@@ -0,0 +1,330 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+// wakeDevice 唤醒指定的设备，返回最终结果
+// 如果设备正在唤醒或关机，不会重复发送唤醒请求
+// 如果设备配置了depends_on，会先按顺序唤醒依赖的设备并等待其上线
+// 如果设备启用了verify，会先发布中间进度，再等待设备上线
+func (c *Controller) wakeDevice(req *request, device *config.DeviceConfig) operationResult {
+	if state, ok := c.power.BeginWake(device.Name); !ok {
+		message := fmt.Sprintf("Device %s is already %s (for %v)", device.Name, state.State, time.Since(state.Since).Round(time.Second))
+		log.Print(message)
+		result := operationResult{device: device.Name, message: message, ok: state.State != POWER_SHUTTING_DOWN, data: c.stateData(device)}
+		if !result.ok {
+			result.status = STATUS_CONFLICT
+		}
+		return result
+	}
+
+	// 先唤醒依赖的设备
+	if len(device.DependsOn) > 0 {
+		if err := c.wakeDependencies(req, device); err != nil {
+			return c.wakeFailed(device, err)
+		}
+	}
+
+	// 创建设备对应的唤醒方式
+	waker, err := NewWaker(device, c.config.Wake)
+	if err != nil {
+		return c.wakeFailed(device, err)
+	}
+
+	// 执行唤醒
+	log.Printf("Waking up device: %s (MAC: %s)", device.Name, device.MAC)
+	result, err := waker.Wake(req.context(), device)
+	if err != nil {
+		return c.wakeFailed(device, err)
+	}
+
+	log.Print(result)
+	if !device.Verify {
+		c.expectBoot(device)
+		return operationResult{device: device.Name, message: result, ok: true, data: c.stateData(device)}
+	}
+
+	c.power.Set(device.Name, POWER_BOOTING, "")
+	c.progress(req, result)
+	return c.verifyDevice(req, device)
+}
+
+// wakeFailed 记录唤醒失败，返回失败结果
+func (c *Controller) wakeFailed(device *config.DeviceConfig, err error) operationResult {
+	log.Printf("Failed to wake device %s: %v", device.Name, err)
+	c.power.Set(device.Name, POWER_FAILED, err.Error())
+	return operationResult{device: device.Name, message: fmt.Sprintf("Error waking device %s: %v", device.Name, err), data: c.stateData(device)}
+}
+
+// expectBoot 将设备切换为booting状态
+// 如果在启动超时时间内没有检测到设备上线，超时后检测一次设备是否在线
+func (c *Controller) expectBoot(device *config.DeviceConfig) {
+	timeout := bootTimeout(device.BootTimeout)
+	c.power.SetWithTimeout(device.Name, POWER_BOOTING, "", timeout, func() (string, string) {
+		if !canCheck(device) {
+			return POWER_UNKNOWN, "reachability cannot be checked"
+		}
+		if c.isUp(device) {
+			return POWER_ONLINE, ""
+		}
+		return POWER_FAILED, fmt.Sprintf("did not come up within %v", timeout)
+	})
+}
+
+// wakeDependencies 按依赖顺序唤醒设备依赖的所有设备
+// 任何一步失败时返回错误，说明是第几步、哪个设备失败
+func (c *Controller) wakeDependencies(req *request, device *config.DeviceConfig) error {
+	order, err := c.config.WakeOrder(device.Name)
+	if err != nil {
+		return err
+	}
+
+	// 最后一个是设备本身，前面是依赖的设备
+	for i, dep := range order[:len(order)-1] {
+		if err := c.bringUp(req, dep, device); err != nil {
+			return fmt.Errorf("step %d/%d failed: dependency %s: %w", i+1, len(order), dep.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// bringUp 确保依赖的设备已上线
+// 设备已在线时直接返回；设备正在唤醒时等待其上线；否则唤醒设备并等待其上线
+func (c *Controller) bringUp(req *request, dep, device *config.DeviceConfig) error {
+	if !canCheck(dep) {
+		return fmt.Errorf("no IP address or checks configured to check reachability")
+	}
+
+	if c.isUp(dep) {
+		c.power.Observe(dep.Name, true)
+		log.Printf("Dependency %s of %s is already online", dep.Name, device.Name)
+		c.progress(req, fmt.Sprintf("Dependency %s of %s is already online", dep.Name, device.Name))
+		return nil
+	}
+
+	if state, ok := c.power.BeginWake(dep.Name); ok {
+		waker, err := NewWaker(dep, c.config.Wake)
+		if err != nil {
+			c.power.Set(dep.Name, POWER_FAILED, err.Error())
+			return err
+		}
+
+		log.Printf("Waking up dependency %s of %s", dep.Name, device.Name)
+		result, err := waker.Wake(req.context(), dep)
+		if err != nil {
+			c.power.Set(dep.Name, POWER_FAILED, err.Error())
+			return err
+		}
+		c.power.Set(dep.Name, POWER_BOOTING, "")
+		c.progress(req, result)
+	} else if state.State == POWER_SHUTTING_DOWN {
+		return fmt.Errorf("device is shutting down")
+	} else {
+		// 其他请求正在唤醒该设备，只需等待
+		log.Printf("Dependency %s of %s is already %s", dep.Name, device.Name, state.State)
+	}
+
+	timeout := bootTimeout(dep.BootTimeout)
+	log.Printf("Waiting for dependency %s to come online (timeout %v)", dep.Name, timeout)
+	c.progress(req, fmt.Sprintf("Waiting for dependency %s to come online (timeout %v)", dep.Name, timeout))
+
+	elapsed, online := c.waitForDevice(req.context(), dep, timeout, func(elapsed time.Duration) {
+		c.progress(req, fmt.Sprintf("Still waiting for dependency %s (%v elapsed)", dep.Name, elapsed.Round(time.Second)))
+	})
+	if err := req.context().Err(); !online && err != nil {
+		c.power.Set(dep.Name, POWER_UNKNOWN, "stopped waiting")
+		return fmt.Errorf("stopped waiting: %w", err)
+	}
+	if !online {
+		c.power.Set(dep.Name, POWER_FAILED, fmt.Sprintf("did not come up within %v", timeout))
+		return fmt.Errorf("did not come up within %v", timeout)
+	}
+
+	c.power.Set(dep.Name, POWER_ONLINE, "")
+	log.Printf("Dependency %s online after %v", dep.Name, elapsed.Round(time.Second))
+	c.progress(req, fmt.Sprintf("Dependency %s online after %v", dep.Name, elapsed.Round(time.Second)))
+	return nil
+}
+
+// verifyDevice 等待设备上线并发布等待进度，返回最终结果
+func (c *Controller) verifyDevice(req *request, device *config.DeviceConfig) operationResult {
+	if !canCheck(device) {
+		c.power.Set(device.Name, POWER_UNKNOWN, "reachability cannot be checked")
+		log.Printf("Cannot verify device %s: no IP address or checks configured", device.Name)
+		return operationResult{device: device.Name, message: fmt.Sprintf("Cannot verify device %s: no IP address or checks configured", device.Name), data: c.stateData(device)}
+	}
+
+	timeout := bootTimeout(device.BootTimeout)
+	log.Printf("Waiting for device %s to come online (timeout %v)", device.Name, timeout)
+	c.progress(req, fmt.Sprintf("Waiting for device %s to come online (timeout %v)", device.Name, timeout))
+
+	elapsed, online := c.waitForDevice(req.context(), device, timeout, func(elapsed time.Duration) {
+		c.progress(req, fmt.Sprintf("Still waiting for device %s (%v elapsed)", device.Name, elapsed.Round(time.Second)))
+	})
+
+	if online {
+		c.power.Set(device.Name, POWER_ONLINE, "")
+		log.Printf("Device %s online after %v", device.Name, elapsed.Round(time.Second))
+		return operationResult{device: device.Name, message: fmt.Sprintf("Device %s online after %v", device.Name, elapsed.Round(time.Second)), ok: true, data: c.stateData(device)}
+	}
+
+	if err := req.context().Err(); err != nil {
+		c.power.Set(device.Name, POWER_UNKNOWN, "stopped waiting")
+		log.Printf("Stopped waiting for device %s: %v", device.Name, err)
+		return operationResult{device: device.Name, message: fmt.Sprintf("Stopped waiting for device %s: %v", device.Name, err), data: c.stateData(device)}
+	}
+
+	c.power.Set(device.Name, POWER_FAILED, fmt.Sprintf("did not come up within %v", timeout))
+	log.Printf("Device %s did not come up within %v", device.Name, timeout)
+	return operationResult{device: device.Name, message: fmt.Sprintf("Device %s did not come up within %v", device.Name, timeout), data: c.stateData(device)}
+}
+
+// pingDevice ping指定的设备，返回结果
+// 设备配置了健康检查时执行所有检查并返回每个检查的结果
+// 动态解析地址的设备会在结果中附带解析到的地址
+func (c *Controller) pingDevice(req *request, device *config.DeviceConfig) operationResult {
+	resolved, address, err := c.resolve(device)
+	if err != nil {
+		log.Printf("Failed to resolve address of device %s: %v", device.Name, err)
+		// 健康检查可能指定了其他主机，仍然执行
+		if len(device.Checks) == 0 {
+			return operationResult{device: device.Name, message: fmt.Sprintf("Error resolving address of device %s: %v", device.Name, err)}
+		}
+	}
+
+	if len(resolved.Checks) > 0 {
+		return c.checkDevice(resolved, address)
+	}
+
+	// 执行ping测试
+	name := describe(device, address)
+	log.Printf("Pinging device: %s (IP: %s)", device.Name, resolved.IP)
+	stats, err := Ping(resolved.IP, pingOptions(device.Ping))
+
+	if err != nil {
+		log.Printf("Failed to ping device %s: %v", name, err)
+		return operationResult{device: device.Name, message: fmt.Sprintf("Error pinging device %s: %v", name, err)}
+	}
+
+	c.power.Observe(device.Name, stats.Reachable())
+	if stats.Reachable() {
+		log.Printf("Device %s is reachable, RTT: %v (%s)", name, stats.AvgRTT, stats)
+		return operationResult{device: device.Name, message: fmt.Sprintf("Device %s is reachable, RTT: %v (%s)", name, stats.AvgRTT, stats), ok: true, data: newPingData(stats)}
+	}
+
+	// 解析到的地址可能已经失效
+	c.resolver.Forget(device.Name)
+	log.Printf("Device %s is not reachable (%s)", name, stats)
+	return operationResult{device: device.Name, message: fmt.Sprintf("Device %s is not reachable (%s)", name, stats), data: newPingData(stats)}
+}
+
+// checkDevice 执行设备的所有健康检查，返回结果
+func (c *Controller) checkDevice(device *config.DeviceConfig, address ResolvedAddress) operationResult {
+	log.Printf("Running %d checks for device: %s", len(device.Checks), device.Name)
+	results := RunChecks(context.Background(), device)
+
+	passed := 0
+	for _, result := range results {
+		if result.Passed {
+			passed++
+		}
+	}
+
+	c.power.Observe(device.Name, passed == len(results))
+	if passed < len(results) {
+		c.resolver.Forget(device.Name)
+	}
+
+	message := fmt.Sprintf("Device %s: %d/%d checks passed\n%s", describe(device, address), passed, len(results), formatCheckResults(results))
+	log.Print(message)
+	return operationResult{device: device.Name, message: message, ok: passed == len(results), data: newCheckData(device, results)}
+}
+
+// shutdownDevice 关闭指定的设备，返回结果
+// 如果设备正在唤醒或关机，不会重复发送关机请求
+func (c *Controller) shutdownDevice(req *request, device *config.DeviceConfig) operationResult {
+	if device.Shutdown.Method == "" {
+		log.Printf("Failed to shut down device %s: %v", device.Name, ErrShutdownNotConfigured)
+		return operationResult{device: device.Name, message: fmt.Sprintf("Error shutting down device %s: %v", device.Name, ErrShutdownNotConfigured), status: STATUS_BAD_REQUEST}
+	}
+
+	if state, ok := c.power.BeginShutdown(device.Name); !ok {
+		message := fmt.Sprintf("Device %s is already %s (for %v)", device.Name, state.State, time.Since(state.Since).Round(time.Second))
+		log.Print(message)
+		result := operationResult{device: device.Name, message: message, ok: state.State == POWER_SHUTTING_DOWN, data: c.stateData(device)}
+		if !result.ok {
+			result.status = STATUS_CONFLICT
+		}
+		return result
+	}
+
+	// 关机命令的模板可能使用设备的ip，解析失败时使用原配置
+	resolved, _, err := c.resolve(device)
+	if err != nil {
+		log.Printf("Failed to resolve address of device %s: %v", device.Name, err)
+	}
+
+	log.Printf("Shutting down device: %s", device.Name)
+	result, err := ShutdownDevice(req.context(), resolved)
+	if err != nil {
+		c.power.Set(device.Name, POWER_FAILED, err.Error())
+		log.Printf("Failed to shut down device %s: %v", device.Name, err)
+		return operationResult{device: device.Name, message: fmt.Sprintf("Error shutting down device %s: %v", device.Name, err), data: c.stateData(device)}
+	}
+
+	// 超时后检测一次设备是否已关机
+	c.power.SetWithTimeout(device.Name, POWER_SHUTTING_DOWN, "", DEFAULT_SHUTDOWN_TIMEOUT, func() (string, string) {
+		if !canCheck(device) {
+			return POWER_UNKNOWN, "reachability cannot be checked"
+		}
+		if c.isUp(device) {
+			return POWER_FAILED, fmt.Sprintf("still online after %v", DEFAULT_SHUTDOWN_TIMEOUT)
+		}
+		return POWER_OFF, ""
+	})
+
+	log.Print(result)
+	return operationResult{device: device.Name, message: result, ok: true, data: c.stateData(device)}
+}
+
+// deviceState 返回设备当前的电源状态
+func (c *Controller) deviceState(req *request, device *config.DeviceConfig) operationResult {
+	state := c.power.Get(device.Name)
+
+	_, address, _ := c.resolve(device)
+	message := fmt.Sprintf("Device %s is %s (for %v)", describe(device, address), state.State, time.Since(state.Since).Round(time.Second))
+	if state.Reason != "" {
+		message += ": " + state.Reason
+	}
+
+	data := StateData{State: state.State, Since: state.Since.Unix(), Reason: state.Reason}
+	if address.Source != RESOLVE_STATIC {
+		data.Address = address.IP
+	}
+	return operationResult{device: device.Name, message: message, ok: state.State != POWER_FAILED, data: data}
+}
+
+// stateData 返回设备当前电源状态的结构化结果
+func (c *Controller) stateData(device *config.DeviceConfig) StateData {
+	state := c.power.Get(device.Name)
+	return StateData{State: state.State, Since: state.Since.Unix(), Reason: state.Reason}
+}
+
+// skipIfOnline 包装设备操作，设备已在线时跳过操作
+func (c *Controller) skipIfOnline(op operation) operation {
+	return func(req *request, device *config.DeviceConfig) operationResult {
+		if c.isUp(device) {
+			c.power.Observe(device.Name, true)
+			log.Printf("Device %s is already online, skipped", device.Name)
+			return operationResult{device: device.Name, message: fmt.Sprintf("Device %s is already online, skipped", device.Name), ok: true, data: c.stateData(device)}
+		}
+		return op(req, device)
+	}
+}
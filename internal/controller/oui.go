@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// builtinOUI 内置的常见厂商OUI，完整的数据库可以通过discover.oui_file加载
+var builtinOUI = map[string]string{
+	"001132": "Synology Incorporated",
+	"245EBE": "QNAP Systems, Inc.",
+	"B827EB": "Raspberry Pi Foundation",
+	"DCA632": "Raspberry Pi Trading Ltd",
+	"E45F01": "Raspberry Pi Trading Ltd",
+	"28CDC1": "Raspberry Pi Trading Ltd",
+	"D83ADD": "Raspberry Pi Trading Ltd",
+	"2CCF67": "Raspberry Pi (Trading) Ltd",
+	"000C29": "VMware, Inc.",
+	"005056": "VMware, Inc.",
+	"000569": "VMware, Inc.",
+	"080027": "PCS Systemtechnik GmbH (VirtualBox)",
+	"00155D": "Microsoft Corporation (Hyper-V)",
+	"001C42": "Parallels, Inc.",
+	"525400": "QEMU/KVM virtual NIC",
+}
+
+// ieeeOUIPattern 匹配IEEE oui.txt中的条目，如 "00-11-32   (hex)		Synology Incorporated"
+var ieeeOUIPattern = regexp.MustCompile(`^([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})\s+\(hex\)\s+(.+)$`)
+
+// OUITable 定义MAC地址前缀（OUI）到厂商名称的映射，键为6位大写十六进制
+type OUITable map[string]string
+
+// LoadOUITable 返回内置的OUI表，path不为空时合并该文件中的条目
+func LoadOUITable(path string) (OUITable, error) {
+	table := make(OUITable, len(builtinOUI))
+	for prefix, vendor := range builtinOUI {
+		table[prefix] = vendor
+	}
+
+	if path == "" {
+		return table, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OUI file: %w", err)
+	}
+	defer file.Close()
+
+	entries, err := ParseOUI(file)
+	if err != nil {
+		return nil, err
+	}
+	for prefix, vendor := range entries {
+		table[prefix] = vendor
+	}
+
+	return table, nil
+}
+
+// ParseOUI 解析OUI数据库，支持IEEE oui.txt和Wireshark manuf两种格式
+// manuf格式示例: "00:11:32	Synology	Synology Incorporated"，优先使用完整名称
+func ParseOUI(r io.Reader) (OUITable, error) {
+	table := make(OUITable)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if match := ieeeOUIPattern.FindStringSubmatch(line); match != nil {
+			table[strings.ToUpper(match[1]+match[2]+match[3])] = strings.TrimSpace(match[4])
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		// 跳过 "00:55:DA:00:00:00/28" 这类更长前缀的条目
+		prefix := strings.NewReplacer(":", "", "-", "").Replace(fields[0])
+		if len(prefix) != 6 {
+			continue
+		}
+		vendor := strings.TrimSpace(fields[len(fields)-1])
+		if vendor == "" {
+			vendor = strings.TrimSpace(fields[1])
+		}
+		table[strings.ToUpper(prefix)] = vendor
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read OUI file: %w", err)
+	}
+	return table, nil
+}
+
+// Lookup 返回MAC地址对应的厂商名称，未知时返回空字符串
+// 本地管理的地址（如虚拟网卡或随机MAC）不属于任何厂商
+func (t OUITable) Lookup(mac string) string {
+	addr, err := parseMACAddress(mac)
+	if err != nil {
+		return ""
+	}
+
+	if vendor, ok := t[fmt.Sprintf("%02X%02X%02X", addr[0], addr[1], addr[2])]; ok {
+		return vendor
+	}
+	if addr[0]&0x02 != 0 {
+		return "Locally administered"
+	}
+	return ""
+}
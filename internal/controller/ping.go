@@ -1,59 +1,384 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"math/rand"
 	"net"
+	"os"
 	"os/exec"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/fbigun/smartwaker/internal/config"
 )
 
+const (
+	// DEFAULT_PING_COUNT 默认发送的回显请求数量
+	DEFAULT_PING_COUNT = 1
+	// DEFAULT_PING_INTERVAL 默认相邻两次回显请求之间的间隔
+	DEFAULT_PING_INTERVAL = time.Second
+	// DEFAULT_PING_TIMEOUT 默认等待每个回显应答的超时时间
+	DEFAULT_PING_TIMEOUT = 3 * time.Second
+
+	// PING_METHOD_DATAGRAM 使用非特权ICMP数据报套接字
+	PING_METHOD_DATAGRAM = "icmp-datagram"
+	// PING_METHOD_RAW 使用原始ICMP套接字
+	PING_METHOD_RAW = "icmp-raw"
+	// PING_METHOD_EXEC 使用系统ping命令
+	PING_METHOD_EXEC = "exec"
+
+	// PROTOCOL_ICMP ICMPv4协议号
+	PROTOCOL_ICMP = 1
+	// PROTOCOL_ICMPV6 ICMPv6协议号
+	PROTOCOL_ICMPV6 = 58
+)
+
+// ErrICMPUnavailable 表示无法创建ICMP套接字（权限不足或系统不支持）
+var ErrICMPUnavailable = errors.New("native ICMP is unavailable")
+
+// pingPayload 回显请求携带的数据
+var pingPayload = []byte("smartwaker-ping")
+
+// replyRTTPattern 从系统ping命令输出中提取往返时间，如 "time=0.045 ms"、"时间<1ms"
+var replyRTTPattern = regexp.MustCompile(`[=<]\s*([\d.]+)\s*ms`)
+
+// PingOptions 定义Ping的参数
+type PingOptions struct {
+	Count    int           // 发送的回显请求数量
+	Interval time.Duration // 相邻两次请求之间的间隔
+	Timeout  time.Duration // 等待每个回显应答的超时时间
+}
+
+// PingStats 定义Ping的统计结果
+type PingStats struct {
+	Address    string          // 实际Ping的IP地址
+	Method     string          // 使用的Ping方式
+	Sent       int             // 发送的请求数量
+	Received   int             // 收到的应答数量
+	PacketLoss float64         // 丢包率(百分比)
+	RTTs       []time.Duration // 每个应答的往返时间
+	MinRTT     time.Duration   // 最小往返时间
+	AvgRTT     time.Duration   // 平均往返时间
+	MaxRTT     time.Duration   // 最大往返时间
+}
+
+// Reachable 判断主机是否可达（至少收到一个应答）
+func (s *PingStats) Reachable() bool {
+	return s.Received > 0
+}
+
+// String 返回统计结果的文字描述
+func (s *PingStats) String() string {
+	summary := fmt.Sprintf("%d/%d packets received, %.0f%% packet loss", s.Received, s.Sent, s.PacketLoss)
+	if s.Received > 0 {
+		summary += fmt.Sprintf(", rtt min/avg/max = %v/%v/%v", s.MinRTT, s.AvgRTT, s.MaxRTT)
+	}
+	return summary
+}
+
 // PingHost ping指定主机并返回是否可达以及往返时间
+// 主机名无法解析时视为不可达，不返回错误
 func PingHost(host string) (bool, time.Duration, error) {
-	// 首先尝试使用net.DialTimeout快速检查主机是否可达
-	startTime := time.Now()
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:80", host), 3*time.Second)
+	stats, err := Ping(host, PingOptions{})
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			return false, 0, nil
+		}
+		return false, 0, err
+	}
+
+	return stats.Reachable(), stats.AvgRTT, nil
+}
+
+// Ping 向指定主机发送ICMP回显请求并返回统计结果
+// 优先使用非特权ICMP数据报套接字，其次使用原始套接字，都不可用时才调用系统ping命令
+func Ping(host string, opts PingOptions) (*PingStats, error) {
+	opts = opts.withDefaults()
+
+	addr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve host %s: %w", host, err)
+	}
+
+	stats, err := pingICMP(addr, opts)
+	if err == nil {
+		return stats, nil
+	}
+	if !errors.Is(err, ErrICMPUnavailable) {
+		return nil, err
+	}
+
+	log.Printf("%v, falling back to ping command", err)
+	return pingExec(addr, opts)
+}
+
+// pingOptions 根据设备的Ping检测配置生成Ping参数
+func pingOptions(cfg config.PingConfig) PingOptions {
+	return PingOptions{
+		Count:    cfg.Count,
+		Interval: time.Duration(cfg.Interval) * time.Millisecond,
+		Timeout:  time.Duration(cfg.Timeout) * time.Second,
+	}
+}
+
+// withDefaults 为未设置的参数填充默认值
+func (o PingOptions) withDefaults() PingOptions {
+	if o.Count <= 0 {
+		o.Count = DEFAULT_PING_COUNT
+	}
+	if o.Interval <= 0 {
+		o.Interval = DEFAULT_PING_INTERVAL
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DEFAULT_PING_TIMEOUT
+	}
+	return o
+}
+
+// pingICMP 使用ICMP套接字发送回显请求
+func pingICMP(addr *net.IPAddr, opts PingOptions) (*PingStats, error) {
+	useIPv6 := addr.IP.To4() == nil
+
+	conn, method, err := listenICMP(useIPv6)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// 数据报套接字的标识符由内核分配，原始套接字则使用随机标识符区分并发的Ping
+	id := (os.Getpid() ^ rand.Intn(0x10000)) & 0xffff
+
+	var dst net.Addr = addr
+	if method == PING_METHOD_DATAGRAM {
+		dst = &net.UDPAddr{IP: addr.IP, Zone: addr.Zone}
+	}
+
+	stats := &PingStats{Address: addr.String(), Method: method}
+	var lastErr error
+
+	for seq := 1; seq <= opts.Count; seq++ {
+		if seq > 1 {
+			time.Sleep(opts.Interval)
+		}
+
+		stats.Sent++
+		rtt, ok, err := sendEcho(conn, dst, addr.IP, useIPv6, method == PING_METHOD_RAW, id, seq, opts.Timeout)
+		if err != nil {
+			// 发送失败（如没有路由）视为丢包
+			lastErr = err
+			continue
+		}
+		if ok {
+			stats.Received++
+			stats.RTTs = append(stats.RTTs, rtt)
+		}
+	}
+
+	// 因权限不足（如防火墙策略）无法发送时，交由系统ping命令处理
+	if stats.Received == 0 && lastErr != nil && isPermissionError(lastErr) {
+		return nil, fmt.Errorf("%w: %v", ErrICMPUnavailable, lastErr)
+	}
+
+	stats.summarize()
+	return stats, nil
+}
+
+// listenICMP 创建ICMP套接字，优先使用非特权数据报套接字
+func listenICMP(useIPv6 bool) (*icmp.PacketConn, string, error) {
+	datagramNetwork, rawNetwork, address := "udp4", "ip4:icmp", "0.0.0.0"
+	if useIPv6 {
+		datagramNetwork, rawNetwork, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+
+	conn, err := icmp.ListenPacket(datagramNetwork, address)
 	if err == nil {
-		// 连接成功，主机可达
-		conn.Close()
-		return true, time.Since(startTime), nil
+		return conn, PING_METHOD_DATAGRAM, nil
+	}
+
+	conn, rawErr := icmp.ListenPacket(rawNetwork, address)
+	if rawErr == nil {
+		return conn, PING_METHOD_RAW, nil
+	}
+
+	return nil, "", fmt.Errorf("%w: datagram socket: %v, raw socket: %v", ErrICMPUnavailable, err, rawErr)
+}
+
+// sendEcho 发送一个回显请求并等待对应的应答
+// 超时未收到应答时返回false，不返回错误
+func sendEcho(conn *icmp.PacketConn, dst net.Addr, target net.IP, useIPv6, raw bool, id, seq int, timeout time.Duration) (time.Duration, bool, error) {
+	var requestType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	protocol := PROTOCOL_ICMP
+	if useIPv6 {
+		requestType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		protocol = PROTOCOL_ICMPV6
+	}
+
+	request := icmp.Message{
+		Type: requestType,
+		Code: 0,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: pingPayload},
+	}
+	packet, err := request.Marshal(nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to build ICMP echo request: %w", err)
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(packet, dst); err != nil {
+		return 0, false, fmt.Errorf("failed to send ICMP echo request: %w", err)
+	}
+
+	if err := conn.SetReadDeadline(start.Add(timeout)); err != nil {
+		return 0, false, err
 	}
 
-	// 如果TCP连接失败，使用系统ping命令
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, false, nil
+			}
+			return 0, false, fmt.Errorf("failed to read ICMP reply: %w", err)
+		}
+		rtt := time.Since(start)
+
+		// 原始套接字会收到所有ICMP报文，需要过滤出本次请求的应答
+		reply, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || echo.Seq != seq || (raw && echo.ID != id) {
+			continue
+		}
+		if peerIP := addrIP(peer); peerIP != nil && !peerIP.Equal(target) {
+			continue
+		}
+
+		return rtt, true, nil
+	}
+}
+
+// addrIP 返回地址中的IP
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// isPermissionError 判断错误是否由权限不足引起
+func isPermissionError(err error) bool {
+	return errors.Is(err, os.ErrPermission)
+}
+
+// summarize 计算丢包率和往返时间统计
+func (s *PingStats) summarize() {
+	if s.Sent > 0 {
+		s.PacketLoss = float64(s.Sent-s.Received) / float64(s.Sent) * 100
+	}
+	if len(s.RTTs) == 0 {
+		return
+	}
+
+	var total time.Duration
+	s.MinRTT, s.MaxRTT = s.RTTs[0], s.RTTs[0]
+	for _, rtt := range s.RTTs {
+		total += rtt
+		if rtt < s.MinRTT {
+			s.MinRTT = rtt
+		}
+		if rtt > s.MaxRTT {
+			s.MaxRTT = rtt
+		}
+	}
+	s.AvgRTT = total / time.Duration(len(s.RTTs))
+}
+
+// pingExec 调用系统ping命令，仅在无法使用ICMP套接字时作为最后手段
+// 通过包含TTL的应答行统计收到的应答，不依赖输出的语言
+func pingExec(addr *net.IPAddr, opts PingOptions) (*PingStats, error) {
+	host := addr.String()
+	ipv6 := addr.IP.To4() == nil
+	count := strconv.Itoa(opts.Count)
+	interval := strconv.FormatFloat(opts.Interval.Seconds(), 'f', 1, 64)
+
 	// 根据不同操作系统使用不同的ping命令参数
 	var cmd *exec.Cmd
-
 	switch runtime.GOOS {
 	case "windows":
-		cmd = exec.Command("ping", "-n", "1", "-w", "3000", host)
-	default: // Linux, Darwin等
-		cmd = exec.Command("ping", "-c", "1", "-W", "3", host)
+		args := []string{"-n", count, "-w", strconv.FormatInt(opts.Timeout.Milliseconds(), 10), host}
+		if ipv6 {
+			args = append([]string{"-6"}, args...)
+		}
+		cmd = exec.Command("ping", args...)
+	case "darwin":
+		if ipv6 {
+			cmd = exec.Command("ping6", "-c", count, "-i", interval, host)
+		} else {
+			cmd = exec.Command("ping", "-c", count, "-i", interval, "-W", strconv.FormatInt(opts.Timeout.Milliseconds(), 10), host)
+		}
+	default: // Linux等
+		// -W只接受整数秒，不足一秒的超时向上取整，避免-W 0
+		timeout := int(math.Ceil(opts.Timeout.Seconds()))
+		if timeout < 1 {
+			timeout = 1
+		}
+		args := []string{"-c", count, "-i", interval, "-W", strconv.Itoa(timeout), host}
+		if ipv6 {
+			args = append([]string{"-6"}, args...)
+		}
+		cmd = exec.Command("ping", args...)
 	}
 
-	startTime = time.Now()
 	output, err := cmd.CombinedOutput()
-	pingDuration := time.Since(startTime)
-
 	if err != nil {
-		// 检查输出以确定是错误还是主机不可达
-		outputStr := string(output)
-		if strings.Contains(outputStr, "timed out") || 
-		   strings.Contains(outputStr, "100% packet loss") ||
-		   strings.Contains(outputStr, "Destination Host Unreachable") {
-			return false, 0, nil // 主机不可达，但不是错误
+		// 非零退出码表示没有收到应答，其他错误（如找不到ping命令）才是真正的错误
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("ping error: %w, output: %s", err, truncate(string(output)))
+		}
+	}
+
+	stats := &PingStats{Address: host, Method: PING_METHOD_EXEC, Sent: opts.Count}
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.Contains(strings.ToLower(line), "ttl=") {
+			continue
+		}
+		stats.Received++
+		if match := replyRTTPattern.FindStringSubmatch(line); match != nil {
+			if ms, err := strconv.ParseFloat(match[1], 64); err == nil {
+				stats.RTTs = append(stats.RTTs, time.Duration(ms*float64(time.Millisecond)))
+			}
 		}
-		return false, 0, fmt.Errorf("ping error: %w, output: %s", err, outputStr)
+	}
+	if stats.Received > stats.Sent {
+		stats.Received = stats.Sent
 	}
 
-	// 简单地返回执行命令的时间作为RTT
-	// 可以进一步解析输出以获取更准确的RTT
-	return true, pingDuration, nil
+	stats.summarize()
+	return stats, nil
 }
 
 // IsPortOpen 检查指定主机的指定端口是否开放
 func IsPortOpen(host string, port int) (bool, error) {
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 	conn, err := net.DialTimeout("tcp", address, 3*time.Second)
 	
 	if err != nil {
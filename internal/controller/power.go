@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+const (
+	// POWER_UNKNOWN 设备状态未知
+	POWER_UNKNOWN = "unknown"
+	// POWER_OFF 设备已关机
+	POWER_OFF = "off"
+	// POWER_WAKING 正在唤醒设备（包括唤醒依赖的设备）
+	POWER_WAKING = "waking"
+	// POWER_BOOTING 已发送唤醒请求，等待设备启动完成
+	POWER_BOOTING = "booting"
+	// POWER_ONLINE 设备在线
+	POWER_ONLINE = "online"
+	// POWER_SHUTTING_DOWN 已发送关机请求，等待设备关机
+	POWER_SHUTTING_DOWN = "shutting-down"
+	// POWER_FAILED 唤醒或关机失败
+	POWER_FAILED = "failed"
+
+	// DEFAULT_SHUTDOWN_TIMEOUT 等待设备关机的超时时间
+	DEFAULT_SHUTDOWN_TIMEOUT = 180 * time.Second
+)
+
+// PowerState 定义设备的电源状态
+type PowerState struct {
+	State  string    // 当前状态
+	Since  time.Time // 进入当前状态的时间
+	Reason string    // 进入当前状态的原因（如失败原因）
+}
+
+// Busy 判断设备是否正在唤醒或关机
+func (s PowerState) Busy() bool {
+	return s.State == POWER_WAKING || s.State == POWER_BOOTING || s.State == POWER_SHUTTING_DOWN
+}
+
+// powerEntry 记录单个设备的电源状态和超时定时器
+type powerEntry struct {
+	PowerState
+	generation int
+	timer      *time.Timer
+}
+
+// PowerTracker 维护所有设备的电源状态
+// 状态由唤醒、关机命令和设备可达性检测结果驱动，正在进行的操作超时后转为failed
+type PowerTracker struct {
+	mu      sync.Mutex
+	entries map[string]*powerEntry
+}
+
+// NewPowerTracker 为所有设备创建电源状态，初始状态为unknown
+func NewPowerTracker(devices []config.DeviceConfig) *PowerTracker {
+	t := &PowerTracker{entries: make(map[string]*powerEntry)}
+
+	now := time.Now()
+	for _, device := range devices {
+		t.entries[device.Name] = &powerEntry{PowerState: PowerState{State: POWER_UNKNOWN, Since: now}}
+	}
+
+	return t
+}
+
+// Get 返回设备当前的电源状态
+func (t *PowerTracker) Get(name string) PowerState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[name]
+	if !ok {
+		return PowerState{State: POWER_UNKNOWN}
+	}
+	return entry.PowerState
+}
+
+// BeginWake 开始唤醒设备
+// 如果设备正在唤醒或关机则不改变状态，返回当前状态和false
+func (t *PowerTracker) BeginWake(name string) (PowerState, bool) {
+	return t.begin(name, POWER_WAKING)
+}
+
+// BeginShutdown 开始关闭设备
+// 如果设备正在唤醒或关机则不改变状态，返回当前状态和false
+func (t *PowerTracker) BeginShutdown(name string) (PowerState, bool) {
+	return t.begin(name, POWER_SHUTTING_DOWN)
+}
+
+// begin 在设备没有正在进行的操作时切换到指定状态
+func (t *PowerTracker) begin(name, state string) (PowerState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.entry(name)
+	if entry.Busy() {
+		return entry.PowerState, false
+	}
+
+	t.set(entry, state, "")
+	return entry.PowerState, true
+}
+
+// Set 切换设备的电源状态，并取消等待中的超时
+func (t *PowerTracker) Set(name, state, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.set(t.entry(name), state, reason)
+}
+
+// SetWithTimeout 切换设备的电源状态
+// 如果超时后设备仍处于该状态，调用expire确定新的状态和原因
+func (t *PowerTracker) SetWithTimeout(name, state, reason string, timeout time.Duration, expire func() (string, string)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.entry(name)
+	t.set(entry, state, reason)
+
+	generation := entry.generation
+	entry.timer = time.AfterFunc(timeout, func() {
+		if !t.current(name, generation) {
+			return
+		}
+		next, reason := expire()
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if entry.generation == generation {
+			t.set(entry, next, reason)
+		}
+	})
+}
+
+// Observe 根据设备可达性检测结果更新状态
+// 唤醒或启动中的设备可达时转为online；关机中的设备不可达时转为off
+// 失败的设备只有在可达时才会转为online，以保留失败原因
+func (t *PowerTracker) Observe(name string, up bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.entry(name)
+
+	next := entry.State
+	switch entry.State {
+	case POWER_WAKING, POWER_BOOTING:
+		if up {
+			next = POWER_ONLINE
+		}
+	case POWER_SHUTTING_DOWN:
+		if !up {
+			next = POWER_OFF
+		}
+	case POWER_FAILED:
+		if up {
+			next = POWER_ONLINE
+		}
+	default:
+		next = POWER_OFF
+		if up {
+			next = POWER_ONLINE
+		}
+	}
+
+	if next != entry.State {
+		t.set(entry, next, "")
+	}
+}
+
+// Stop 取消所有等待中的超时
+func (t *PowerTracker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, entry := range t.entries {
+		if entry.timer != nil {
+			entry.timer.Stop()
+			entry.timer = nil
+		}
+		entry.generation++
+	}
+}
+
+// current 判断设备状态自设置超时以来是否没有变化
+func (t *PowerTracker) current(name string, generation int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.entry(name).generation == generation
+}
+
+// entry 返回设备的状态记录，不存在时创建，调用者需要持有锁
+func (t *PowerTracker) entry(name string) *powerEntry {
+	entry, ok := t.entries[name]
+	if !ok {
+		entry = &powerEntry{PowerState: PowerState{State: POWER_UNKNOWN, Since: time.Now()}}
+		t.entries[name] = entry
+	}
+	return entry
+}
+
+// set 切换状态并取消等待中的超时，调用者需要持有锁
+func (t *PowerTracker) set(entry *powerEntry, state, reason string) {
+	if entry.timer != nil {
+		entry.timer.Stop()
+		entry.timer = nil
+	}
+	entry.generation++
+
+	if entry.State != state {
+		entry.Since = time.Now()
+	}
+	entry.State = state
+	entry.Reason = reason
+}
@@ -0,0 +1,380 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+const (
+	// RESOLVE_STATIC 使用配置的静态ip
+	RESOLVE_STATIC = "static"
+	// RESOLVE_DNS 通过DNS解析主机名
+	RESOLVE_DNS = "dns"
+	// RESOLVE_LEASES 根据MAC地址在DHCP租约文件中查找
+	RESOLVE_LEASES = "dhcp"
+	// RESOLVE_NEIGHBOR 根据MAC地址在邻居表中查找
+	RESOLVE_NEIGHBOR = "arp"
+
+	// LEASES_DNSMASQ dnsmasq租约文件格式
+	LEASES_DNSMASQ = "dnsmasq"
+	// LEASES_ISC ISC dhcpd租约文件格式
+	LEASES_ISC = "isc"
+
+	// DEFAULT_RESOLVE_TTL 解析结果的默认缓存时间
+	DEFAULT_RESOLVE_TTL = 60 * time.Second
+	// DEFAULT_RESOLVE_TIMEOUT DNS解析的超时时间
+	DEFAULT_RESOLVE_TIMEOUT = 3 * time.Second
+)
+
+// ErrAddressNotResolved 表示无法解析设备的IP地址
+var ErrAddressNotResolved = errors.New("address could not be resolved")
+
+// iscLeaseStart 匹配ISC dhcpd租约文件中租约块的开始
+var iscLeaseStart = regexp.MustCompile(`(?m)^\s*lease\s+\S+\s*\{`)
+
+// Lease 定义DHCP租约文件中的一条租约
+type Lease struct {
+	IP       net.IP           // 分配的IP地址
+	MAC      net.HardwareAddr // 客户端MAC地址
+	Hostname string           // 客户端主机名
+	Expires  time.Time        // 到期时间，为零值时表示永不过期
+}
+
+// Active 判断租约在指定时间是否有效
+func (l Lease) Active(now time.Time) bool {
+	return l.Expires.IsZero() || now.Before(l.Expires)
+}
+
+// ParseLeases 解析DHCP租约文件
+// format为dnsmasq或isc，为空时根据内容自动识别
+func ParseLeases(r io.Reader, format string) ([]Lease, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read leases: %w", err)
+	}
+
+	if format == "" {
+		format = LEASES_DNSMASQ
+		if iscLeaseStart.Match(data) {
+			format = LEASES_ISC
+		}
+	}
+
+	switch format {
+	case LEASES_DNSMASQ:
+		return parseDnsmasqLeases(data), nil
+	case LEASES_ISC:
+		return parseISCLeases(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported leases format: %s", format)
+	}
+}
+
+// parseDnsmasqLeases 解析dnsmasq租约文件
+// 格式示例: "1717711200 00:11:22:33:44:55 192.168.1.23 nas *"，到期时间为0表示永不过期
+func parseDnsmasqLeases(data []byte) []Lease {
+	var leases []Lease
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		// IPv6租约和duid行的第二列不是MAC地址，会在这里被跳过
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		mac, err := net.ParseMAC(fields[1])
+		ip := net.ParseIP(fields[2])
+		if err != nil || ip == nil {
+			continue
+		}
+
+		lease := Lease{IP: ip, MAC: mac}
+		if fields[3] != "*" {
+			lease.Hostname = fields[3]
+		}
+		if expiry > 0 {
+			lease.Expires = time.Unix(expiry, 0)
+		}
+		leases = append(leases, lease)
+	}
+
+	return leases
+}
+
+// parseISCLeases 解析ISC dhcpd租约文件，只返回处于active状态的租约
+// 格式示例:
+//
+//	lease 192.168.1.23 {
+//	  ends 4 2024/06/06 22:00:00;
+//	  binding state active;
+//	  hardware ethernet 00:11:22:33:44:55;
+//	  client-hostname "nas";
+//	}
+func parseISCLeases(data []byte) []Lease {
+	var leases []Lease
+	var current *Lease
+	state := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if current == nil {
+			fields := strings.Fields(line)
+			if len(fields) == 3 && fields[0] == "lease" && fields[2] == "{" {
+				if ip := net.ParseIP(fields[1]); ip != nil {
+					current = &Lease{IP: ip}
+					state = ""
+				}
+			}
+			continue
+		}
+
+		if line == "}" {
+			if current.MAC != nil && (state == "" || state == "active") {
+				leases = append(leases, *current)
+			}
+			current = nil
+			continue
+		}
+
+		line = strings.TrimSuffix(line, ";")
+		switch {
+		case strings.HasPrefix(line, "hardware ethernet "):
+			if mac, err := net.ParseMAC(strings.TrimPrefix(line, "hardware ethernet ")); err == nil {
+				current.MAC = mac
+			}
+		case strings.HasPrefix(line, "binding state "):
+			state = strings.TrimPrefix(line, "binding state ")
+		case strings.HasPrefix(line, "client-hostname "):
+			current.Hostname = strings.Trim(strings.TrimPrefix(line, "client-hostname "), `"`)
+		case strings.HasPrefix(line, "ends "):
+			current.Expires = parseISCTime(strings.TrimPrefix(line, "ends "))
+		}
+	}
+
+	return leases
+}
+
+// parseISCTime 解析ISC dhcpd租约文件中的时间
+// 支持 "4 2024/06/06 22:00:00"（UTC）、"epoch 1717711200" 和 "never"
+func parseISCTime(value string) time.Time {
+	fields := strings.Fields(value)
+	switch {
+	case len(fields) == 2 && fields[0] == "epoch":
+		if seconds, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			return time.Unix(seconds, 0)
+		}
+	case len(fields) == 3:
+		if t, err := time.Parse("2006/01/02 15:04:05", fields[1]+" "+fields[2]); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ResolvedAddress 定义设备地址的解析结果
+type ResolvedAddress struct {
+	IP      string    // 解析到的IP地址
+	Source  string    // 解析方式：static、dns、dhcp 或 arp
+	Expires time.Time // 缓存到期时间
+}
+
+// String 返回解析结果的描述，如 "192.168.1.23 via dhcp"
+func (a ResolvedAddress) String() string {
+	if a.Source == RESOLVE_STATIC {
+		return a.IP
+	}
+	return fmt.Sprintf("%s via %s", a.IP, a.Source)
+}
+
+// Resolver 解析设备当前的IP地址，并按TTL缓存解析结果
+// 配置了hostname的设备通过DNS解析，未配置ip的设备根据MAC地址在DHCP租约文件和邻居表中查找
+// 解析失败时使用配置的静态ip
+type Resolver struct {
+	config config.ResolveConfig
+	mu     sync.Mutex
+	cache  map[string]ResolvedAddress
+}
+
+// NewResolver 创建设备地址解析器
+func NewResolver(cfg config.ResolveConfig) *Resolver {
+	return &Resolver{
+		config: cfg,
+		cache:  make(map[string]ResolvedAddress),
+	}
+}
+
+// Resolve 返回设备当前的IP地址，优先使用未过期的缓存
+func (r *Resolver) Resolve(device *config.DeviceConfig) (ResolvedAddress, error) {
+	if !isDynamic(device) {
+		return ResolvedAddress{IP: device.IP, Source: RESOLVE_STATIC}, nil
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[device.Name]
+	r.mu.Unlock()
+	if ok && now.Before(cached.Expires) {
+		return cached, nil
+	}
+
+	address, err := r.lookup(device, now)
+	if err != nil {
+		return ResolvedAddress{}, fmt.Errorf("device %s: %w", device.Name, err)
+	}
+
+	// 静态ip只是后备地址，不缓存，下次检测时重新解析
+	if address.Source != RESOLVE_STATIC {
+		address.Expires = now.Add(r.ttl())
+		r.mu.Lock()
+		r.cache[device.Name] = address
+		r.mu.Unlock()
+	}
+
+	return address, nil
+}
+
+// Forget 清除设备缓存的解析结果
+func (r *Resolver) Forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.cache, name)
+}
+
+// lookup 依次尝试每种解析方式
+func (r *Resolver) lookup(device *config.DeviceConfig, now time.Time) (ResolvedAddress, error) {
+	var failures []string
+
+	if device.Hostname != "" {
+		ip, err := lookupHostname(device.Hostname)
+		if err == nil {
+			return ResolvedAddress{IP: ip, Source: RESOLVE_DNS}, nil
+		}
+		failures = append(failures, err.Error())
+	}
+
+	if device.IP == "" && device.MAC != "" {
+		if r.config.Leases != "" {
+			ip, err := r.lookupLease(device.MAC, now)
+			if err == nil {
+				return ResolvedAddress{IP: ip, Source: RESOLVE_LEASES}, nil
+			}
+			failures = append(failures, err.Error())
+		}
+
+		ip, err := lookupNeighborByMAC(device.MAC)
+		if err == nil {
+			return ResolvedAddress{IP: ip, Source: RESOLVE_NEIGHBOR}, nil
+		}
+		failures = append(failures, err.Error())
+	}
+
+	if device.IP != "" {
+		return ResolvedAddress{IP: device.IP, Source: RESOLVE_STATIC}, nil
+	}
+
+	return ResolvedAddress{}, fmt.Errorf("%w: %s", ErrAddressNotResolved, strings.Join(failures, "; "))
+}
+
+// lookupLease 在DHCP租约文件中查找MAC地址对应的有效租约，同一MAC有多条租约时使用最后一条
+func (r *Resolver) lookupLease(mac string, now time.Time) (string, error) {
+	file, err := os.Open(r.config.Leases)
+	if err != nil {
+		return "", fmt.Errorf("failed to open leases file: %w", err)
+	}
+	defer file.Close()
+
+	leases, err := ParseLeases(file, r.config.LeasesFormat)
+	if err != nil {
+		return "", err
+	}
+
+	var ip string
+	for _, lease := range leases {
+		if lease.Active(now) && sameMAC(mac, lease.MAC.String()) {
+			ip = lease.IP.String()
+		}
+	}
+	if ip == "" {
+		return "", fmt.Errorf("no active lease for %s in %s", mac, r.config.Leases)
+	}
+	return ip, nil
+}
+
+// ttl 返回解析结果的缓存时间
+func (r *Resolver) ttl() time.Duration {
+	if r.config.TTL <= 0 {
+		return DEFAULT_RESOLVE_TTL
+	}
+	return time.Duration(r.config.TTL) * time.Second
+}
+
+// lookupHostname 通过DNS解析主机名，优先返回IPv4地址
+func lookupHostname(hostname string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_RESOLVE_TIMEOUT)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve hostname %s: %w", hostname, err)
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("no addresses found for hostname %s", hostname)
+	}
+
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			return addr.IP.String(), nil
+		}
+	}
+	return addrs[0].IP.String(), nil
+}
+
+// lookupNeighborByMAC 在邻居表中查找MAC地址对应的IP地址
+func lookupNeighborByMAC(mac string) (string, error) {
+	entries, err := ReadNeighborTable()
+	if err != nil {
+		return "", err
+	}
+
+	for _, entry := range entries {
+		if entry.Complete && sameMAC(mac, entry.MAC.String()) {
+			return entry.IP.String(), nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in neighbor table", mac)
+}
+
+// isDynamic 判断设备的IP地址是否需要动态解析
+// 配置了hostname，或者没有配置ip但配置了mac的设备需要动态解析
+func isDynamic(device *config.DeviceConfig) bool {
+	return device.Hostname != "" || (device.IP == "" && device.MAC != "")
+}
+
+// describe 返回设备的显示名称，动态解析的设备附带解析到的地址
+func describe(device *config.DeviceConfig, address ResolvedAddress) string {
+	if address.Source == "" || address.Source == RESOLVE_STATIC {
+		return device.Name
+	}
+	return fmt.Sprintf("%s (%s)", device.Name, address)
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+// ScheduledRun 定义定时任务的下一次执行信息
+type ScheduledRun struct {
+	Name   string    // 任务名称
+	Action string    // 动作
+	Target string    // 目标
+	Next   time.Time // 下一次执行时间（任务所在时区）
+}
+
+// Scheduler 按照cron表达式定时执行设备操作
+type Scheduler struct {
+	cron    *cron.Cron
+	entries map[cron.EntryID]config.ScheduleConfig
+	ctx     context.Context // 传给执行中的任务，停止调度器时取消
+	cancel  context.CancelFunc
+}
+
+// NewScheduler 根据定时任务配置创建调度器
+// 到达执行时间时（加上随机延迟后）调用run执行任务，ctx在调度器停止时取消
+func NewScheduler(schedules []config.ScheduleConfig, run func(ctx context.Context, schedule config.ScheduleConfig)) (*Scheduler, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		cron:    cron.New(),
+		entries: make(map[cron.EntryID]config.ScheduleConfig),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	for _, schedule := range schedules {
+		schedule := schedule
+
+		// 通过CRON_TZ前缀为每个任务指定时区
+		spec := schedule.Cron
+		if schedule.Timezone != "" {
+			spec = "CRON_TZ=" + schedule.Timezone + " " + spec
+		}
+
+		id, err := s.cron.AddFunc(spec, func() {
+			if !s.waitJitter(schedule.Jitter) {
+				return
+			}
+			log.Printf("Running schedule %s: %s %s", schedule.Name, schedule.Action, schedule.Target)
+			run(s.ctx, schedule)
+		})
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid schedule %s: %w", schedule.Name, err)
+		}
+		s.entries[id] = schedule
+	}
+
+	return s, nil
+}
+
+// Start 启动调度器
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop 停止调度器，等待中的随机延迟和执行中任务的等待会被取消
+// 返回前等待执行中的任务结束
+func (s *Scheduler) Stop() {
+	s.cancel()
+	<-s.cron.Stop().Done()
+}
+
+// NextRuns 返回所有定时任务的下一次执行时间，按时间先后排序
+// 调度器未启动时根据当前时间计算
+func (s *Scheduler) NextRuns() []ScheduledRun {
+	now := time.Now()
+	runs := make([]ScheduledRun, 0, len(s.entries))
+
+	for _, entry := range s.cron.Entries() {
+		schedule := s.entries[entry.ID]
+		next := entry.Next
+		if next.IsZero() {
+			next = entry.Schedule.Next(now)
+		}
+		runs = append(runs, ScheduledRun{
+			Name:   schedule.Name,
+			Action: schedule.Action,
+			Target: schedule.Target,
+			Next:   next,
+		})
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Next.Before(runs[j].Next)
+	})
+	return runs
+}
+
+// waitJitter 等待0到jitter秒之间的随机时间
+// 如果等待期间调度器被停止则返回false
+func (s *Scheduler) waitJitter(jitter int) bool {
+	if jitter <= 0 {
+		return true
+	}
+
+	delay := time.Duration(rand.Int63n(int64(jitter) * int64(time.Second)))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
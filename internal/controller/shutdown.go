@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+// ErrShutdownNotConfigured 表示设备没有配置关机方式
+var ErrShutdownNotConfigured = errors.New("shutdown is not configured")
+
+// ShutdownDevice 按照设备的关机配置关闭设备，返回描述结果的消息
+// 关机方式与唤醒方式相同，支持 http 和 exec，命令参数同样支持设备字段模板
+func ShutdownDevice(ctx context.Context, device *config.DeviceConfig) (string, error) {
+	cfg := device.Shutdown
+
+	switch cfg.Method {
+	case WAKER_HTTP:
+		status, err := sendHTTPRequest(ctx, http.DefaultClient, cfg.HTTP, device)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("HTTP shutdown request sent to %s (status %d)", device.Name, status), nil
+	case WAKER_EXEC:
+		output, err := runCommand(ctx, cfg.Exec, device)
+		if err != nil {
+			return "", err
+		}
+		message := fmt.Sprintf("Shutdown command executed for %s", device.Name)
+		if output != "" {
+			message += ": " + output
+		}
+		return message, nil
+	case "":
+		return "", ErrShutdownNotConfigured
+	default:
+		return "", fmt.Errorf("unknown shutdown method: %s", cfg.Method)
+	}
+}
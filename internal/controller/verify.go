@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	"github.com/fbigun/smartwaker/pkg/utils"
+)
+
+const (
+	// DEFAULT_BOOT_TIMEOUT 默认等待设备上线的超时时间
+	DEFAULT_BOOT_TIMEOUT = 180 * time.Second
+	// BOOT_POLL_INTERVAL 检测设备是否上线的轮询间隔
+	BOOT_POLL_INTERVAL = time.Second
+	// BOOT_PROGRESS_INTERVAL 等待设备上线时报告进度的间隔
+	BOOT_PROGRESS_INTERVAL = 15 * time.Second
+)
+
+// WaitForDevice 轮询设备直到其可达或超时
+// 如果port大于0则检测该TCP端口，否则使用PingHost检测
+// 等待期间每隔BOOT_PROGRESS_INTERVAL调用一次progress报告已等待的时间
+// 返回实际等待的时间以及设备是否已上线
+func WaitForDevice(host string, port int, timeout time.Duration, progress func(elapsed time.Duration)) (time.Duration, bool) {
+	return waitForHost(context.Background(), host, port, timeout, progress)
+}
+
+// waitForHost 与WaitForDevice相同，ctx取消时停止等待
+func waitForHost(ctx context.Context, host string, port int, timeout time.Duration, progress func(elapsed time.Duration)) (time.Duration, bool) {
+	// 端口检测已经在WaitForConnection中等待过，无需再次休眠
+	return waitUntil(ctx, func() bool { return isHostUp(host, port) }, port <= 0, timeout, progress)
+}
+
+// waitForDeviceReady 轮询设备直到其在线或超时
+// 设备配置了健康检查时要求所有检查都通过，否则与WaitForDevice相同
+func waitForDeviceReady(ctx context.Context, device *config.DeviceConfig, timeout time.Duration, progress func(elapsed time.Duration)) (time.Duration, bool) {
+	if len(device.Checks) == 0 {
+		return waitForHost(ctx, device.IP, device.CheckPort, timeout, progress)
+	}
+	return waitUntil(ctx, func() bool { return isDeviceUp(device) }, true, timeout, progress)
+}
+
+// waitUntil 轮询直到up返回true、超时或ctx取消，sleep表示每次检测后是否需要休眠
+func waitUntil(ctx context.Context, up func() bool, sleep bool, timeout time.Duration, progress func(elapsed time.Duration)) (time.Duration, bool) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	lastReport := start
+
+	for {
+		if up() {
+			return time.Since(start), true
+		}
+
+		now := time.Now()
+		if !now.Before(deadline) || ctx.Err() != nil {
+			return now.Sub(start), false
+		}
+
+		// 定期报告等待进度
+		if progress != nil && now.Sub(lastReport) >= BOOT_PROGRESS_INTERVAL {
+			progress(now.Sub(start))
+			lastReport = now
+		}
+
+		if sleep {
+			select {
+			case <-time.After(BOOT_POLL_INTERVAL):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// canCheck 判断是否可以检测设备是否在线（配置了ip、可以动态解析地址或配置了健康检查）
+func canCheck(device *config.DeviceConfig) bool {
+	return device.IP != "" || isDynamic(device) || len(device.Checks) > 0
+}
+
+// isDeviceUp 检查设备是否在线
+// 设备配置了健康检查时要求所有检查都通过，否则检测check_port或Ping设备的ip
+func isDeviceUp(device *config.DeviceConfig) bool {
+	if len(device.Checks) > 0 {
+		return checksPassed(RunChecks(context.Background(), device))
+	}
+	return device.IP != "" && isHostUp(device.IP, device.CheckPort)
+}
+
+// isHostUp 检查主机是否可达
+func isHostUp(host string, port int) bool {
+	if port > 0 {
+		return utils.WaitForConnection(host, port, BOOT_POLL_INTERVAL)
+	}
+
+	reachable, _, err := PingHost(host)
+	return err == nil && reachable
+}
+
+// bootTimeout 返回设备配置的上线超时时间
+func bootTimeout(seconds int) time.Duration {
+	if seconds <= 0 {
+		return DEFAULT_BOOT_TIMEOUT
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -2,57 +2,286 @@ package controller
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
 	"net"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/fbigun/smartwaker/pkg/utils"
+)
+
+const (
+	// TRANSPORT_UDP 通过UDP数据报发送Magic Packet
+	TRANSPORT_UDP = "udp"
+	// TRANSPORT_ETHERNET 通过EtherType为0x0842的以太网帧发送Magic Packet
+	TRANSPORT_ETHERNET = "ethernet"
 )
 
+// WakeOptions 定义发送Magic Packet时的可选参数
+type WakeOptions struct {
+	SecureOn  string // SecureOn密码，为空时发送不带密码的Magic Packet
+	Transport string // 发送方式：udp（默认）或 ethernet
+	Interface string // 发送使用的网卡名称，ethernet方式必须指定
+	Subnet    string // 目标子网（CIDR格式），用于计算定向广播地址
+	IPv6      bool   // 未指定IP地址时发送到网卡上的IPv6组播地址ff02::1
+
+	Repeat         int           // 每个目标发送的次数，小于1时发送一次
+	RepeatInterval time.Duration // 每轮发送之间的间隔
+	Ports          []int         // 发送的端口列表，为空时使用port参数
+}
+
 // WakeOnLAN 发送网络唤醒 Magic Packet
 func WakeOnLAN(macAddr, ipAddr string, port int) error {
+	_, err := WakeOnLANWithOptions(macAddr, ipAddr, port, WakeOptions{})
+	return err
+}
+
+// WakeOnLANWithOptions 按照指定选项发送网络唤醒 Magic Packet
+// 返回成功发送的Magic Packet数量
+func WakeOnLANWithOptions(macAddr, ipAddr string, port int, opts WakeOptions) (int, error) {
 	// 如果没有指定端口，使用默认端口9
 	if port <= 0 {
 		port = 9
 	}
 
+	// 确定发送端口列表
+	ports := opts.Ports
+	if len(ports) == 0 {
+		ports = []int{port}
+	}
+
+	// 确定发送轮数
+	repeat := opts.Repeat
+	if repeat < 1 {
+		repeat = 1
+	}
+
 	// 解析MAC地址
 	mac, err := parseMACAddress(macAddr)
 	if err != nil {
-		return fmt.Errorf("invalid MAC address: %w", err)
+		return 0, fmt.Errorf("invalid MAC address: %w", err)
+	}
+
+	// 解析SecureOn密码
+	var password []byte
+	if opts.SecureOn != "" {
+		password, err = utils.ParseSecureOnPassword(opts.SecureOn)
+		if err != nil {
+			return 0, fmt.Errorf("invalid SecureOn password: %w", err)
+		}
 	}
 
 	// 创建Magic Packet
-	mp, err := createMagicPacket(mac)
+	mp, err := createMagicPacket(mac, password)
 	if err != nil {
-		return fmt.Errorf("failed to create magic packet: %w", err)
+		return 0, fmt.Errorf("failed to create magic packet: %w", err)
+	}
+
+	// 以太网帧方式直接从指定网卡发送，不需要IP地址和端口
+	if opts.Transport == TRANSPORT_ETHERNET {
+		if opts.Interface == "" {
+			return 0, fmt.Errorf("interface is required for ethernet transport")
+		}
+		return sendRepeatedly(repeat, opts.RepeatInterval, 1, func(int) error {
+			return sendEthernetMagicPacket(opts.Interface, mp)
+		})
+	}
+
+	// 确定所有端口的目标地址
+	var targets []wakeTarget
+	for _, p := range ports {
+		portTargets, err := resolveWakeTargets(ipAddr, p, opts)
+		if err != nil {
+			return 0, err
+		}
+		targets = append(targets, portTargets...)
+	}
+
+	return sendRepeatedly(repeat, opts.RepeatInterval, len(targets), func(i int) error {
+		return sendUDPMagicPacket(targets[i], mp)
+	})
+}
+
+// sendRepeatedly 按轮次向每个目标发送Magic Packet，每轮之间等待指定间隔
+// 只要有一次发送成功即视为成功，返回成功发送的数量，发送失败的目标记录到日志
+// 如果第一轮全部发送失败，说明错误不是偶发的，直接返回错误
+func sendRepeatedly(repeat int, interval time.Duration, targets int, send func(i int) error) (int, error) {
+	sent := 0
+	var failed []error
+
+	for round := 0; round < repeat; round++ {
+		if round > 0 && interval > 0 {
+			time.Sleep(interval)
+		}
+
+		var errs []error
+		for i := 0; i < targets; i++ {
+			if err := send(i); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			sent++
+		}
+
+		if sent == 0 && len(errs) > 0 {
+			return 0, errors.Join(errs...)
+		}
+		failed = append(failed, errs...)
+	}
+
+	if len(failed) > 0 {
+		log.Printf("Warning: Failed to send %d of %d Magic Packets: %v", len(failed), len(failed)+sent, errors.Join(failed...))
+	}
+	return sent, nil
+}
+
+// wakeTarget 定义一个UDP方式发送Magic Packet的目标
+type wakeTarget struct {
+	addr  *net.UDPAddr // 目标地址
+	local net.IP       // 绑定的本地地址，为空时由系统选择
+	iface string       // 绑定的网卡名称，为空时由路由表决定
+}
+
+// resolveWakeTargets 根据IP地址、子网和网卡选项确定发送Magic Packet的目标地址
+// 如果提供了IP地址（IPv4或IPv6），直接发送到该地址
+// 如果启用了IPv6，发送到指定网卡上的链路本地全节点组播地址ff02::1
+// 否则发送到子网或网卡的定向广播地址
+// 都没有指定时发送到所有可用IPv4网卡的广播地址
+func resolveWakeTargets(ipAddr string, port int, opts WakeOptions) ([]wakeTarget, error) {
+	// 获取指定网卡的IPv4网络，用于绑定本地地址
+	var ifaceNetworks []*net.IPNet
+	if opts.Interface != "" {
+		networks, err := utils.InterfaceIPv4Networks(opts.Interface)
+		if err != nil {
+			return nil, err
+		}
+		ifaceNetworks = networks
 	}
 
-	// 确定目标地址
 	// 如果提供了IP地址，使用IP:端口作为目标
-	// 否则使用广播地址255.255.255.255:端口
-	var target string
 	if ipAddr != "" {
-		target = fmt.Sprintf("%s:%d", ipAddr, port)
-	} else {
-		target = fmt.Sprintf("255.255.255.255:%d", port)
+		addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(ipAddr, strconv.Itoa(port)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve target address: %w", err)
+		}
+
+		// 只有IPv4目标才绑定网卡的IPv4地址，IPv6目标仅绑定网卡
+		target := wakeTarget{addr: addr, iface: opts.Interface}
+		if addr.IP.To4() != nil && len(ifaceNetworks) > 0 {
+			target.local = ifaceNetworks[0].IP
+		}
+		return []wakeTarget{target}, nil
+	}
+
+	// 如果启用了IPv6，发送到网卡上的链路本地全节点组播地址
+	if opts.IPv6 {
+		if opts.Interface == "" {
+			return nil, fmt.Errorf("interface is required for IPv6 multicast")
+		}
+		addr := &net.UDPAddr{IP: net.IPv6linklocalallnodes, Port: port, Zone: opts.Interface}
+		return []wakeTarget{{addr: addr, iface: opts.Interface}}, nil
+	}
+
+	if opts.Interface != "" && len(ifaceNetworks) == 0 {
+		return nil, fmt.Errorf("interface %s has no IPv4 address", opts.Interface)
 	}
 
-	// 解析目标地址
-	addr, err := net.ResolveUDPAddr("udp", target)
+	// 如果指定了子网，发送到子网的定向广播地址
+	if opts.Subnet != "" {
+		_, subnet, err := net.ParseCIDR(opts.Subnet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet %s: %w", opts.Subnet, err)
+		}
+
+		broadcast, err := utils.BroadcastAddress(subnet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet %s: %w", opts.Subnet, err)
+		}
+
+		target := wakeTarget{addr: &net.UDPAddr{IP: broadcast, Port: port}, iface: opts.Interface}
+		for _, network := range ifaceNetworks {
+			if subnet.Contains(network.IP) {
+				target.local = network.IP
+				break
+			}
+		}
+		return []wakeTarget{target}, nil
+	}
+
+	// 如果指定了网卡，发送到网卡所有IPv4网络的定向广播地址
+	if opts.Interface != "" {
+		return broadcastTargets(opts.Interface, ifaceNetworks, port), nil
+	}
+
+	// 默认发送到所有可用IPv4网卡的广播地址
+	ifaces, err := net.Interfaces()
 	if err != nil {
-		return fmt.Errorf("failed to resolve target address: %w", err)
+		return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+
+	var targets []wakeTarget
+	for _, iface := range ifaces {
+		// 跳过回环接口、非活动接口和不支持广播的接口
+		if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+
+		networks, err := utils.InterfaceIPv4Networks(iface.Name)
+		if err != nil {
+			continue
+		}
+		targets = append(targets, broadcastTargets(iface.Name, networks, port)...)
+	}
+
+	// 没有可用网卡时退回到受限广播地址
+	if len(targets) == 0 {
+		targets = append(targets, wakeTarget{addr: &net.UDPAddr{IP: net.IPv4bcast, Port: port}})
+	}
+
+	return targets, nil
+}
+
+// broadcastTargets 为网卡的每个IPv4网络生成定向广播目标
+func broadcastTargets(ifaceName string, networks []*net.IPNet, port int) []wakeTarget {
+	var targets []wakeTarget
+	for _, network := range networks {
+		broadcast, err := utils.BroadcastAddress(network)
+		if err != nil {
+			continue
+		}
+		targets = append(targets, wakeTarget{
+			addr:  &net.UDPAddr{IP: broadcast, Port: port},
+			local: network.IP,
+			iface: ifaceName,
+		})
+	}
+	return targets
+}
+
+// sendUDPMagicPacket 通过UDP发送Magic Packet到指定目标
+func sendUDPMagicPacket(target wakeTarget, packet []byte) error {
+	dialer := net.Dialer{}
+	if target.local != nil {
+		dialer.LocalAddr = &net.UDPAddr{IP: target.local}
+	}
+	if target.iface != "" {
+		dialer.Control = bindToDevice(target.iface)
 	}
 
 	// 创建UDP连接
-	conn, err := net.DialUDP("udp", nil, addr)
+	conn, err := dialer.Dial("udp", target.addr.String())
 	if err != nil {
-		return fmt.Errorf("failed to create UDP connection: %w", err)
+		return fmt.Errorf("failed to create UDP connection to %s: %w", target.addr, err)
 	}
 	defer conn.Close()
 
 	// 发送Magic Packet
-	_, err = conn.Write(mp)
+	_, err = conn.Write(packet)
 	if err != nil {
-		return fmt.Errorf("failed to send magic packet: %w", err)
+		return fmt.Errorf("failed to send magic packet to %s: %w", target.addr, err)
 	}
 
 	return nil
@@ -80,13 +309,18 @@ func parseMACAddress(macAddr string) ([]byte, error) {
 }
 
 // createMagicPacket 创建网络唤醒的Magic Packet
-func createMagicPacket(mac []byte) ([]byte, error) {
+// 如果提供了SecureOn密码，则将其附加在Magic Packet末尾
+func createMagicPacket(mac, password []byte) ([]byte, error) {
 	if len(mac) != 6 {
 		return nil, fmt.Errorf("invalid MAC address length: %d bytes", len(mac))
 	}
 
-	// Magic Packet格式：6字节的0xFF，然后是目标MAC地址重复16次
-	packet := make([]byte, 102)
+	if len(password) != 0 && len(password) != 4 && len(password) != 6 {
+		return nil, fmt.Errorf("invalid SecureOn password length: %d bytes", len(password))
+	}
+
+	// Magic Packet格式：6字节的0xFF，然后是目标MAC地址重复16次，最后是可选的SecureOn密码
+	packet := make([]byte, 102, 102+len(password))
 
 	// 前6字节设置为0xFF
 	for i := 0; i < 6; i++ {
@@ -98,5 +332,8 @@ func createMagicPacket(mac []byte) ([]byte, error) {
 		copy(packet[6+(i*6):], mac)
 	}
 
+	// 附加SecureOn密码（4字节或6字节）
+	packet = append(packet, password...)
+
 	return packet, nil
 }
@@ -0,0 +1,27 @@
+//go:build linux
+
+package controller
+
+import (
+	"errors"
+	"syscall"
+)
+
+// bindToDevice 返回将套接字绑定到指定网卡的控制函数
+// 没有权限使用SO_BINDTODEVICE时退回到仅绑定源地址
+func bindToDevice(ifaceName string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, ifaceName)
+		})
+		if err != nil {
+			return err
+		}
+
+		if errors.Is(sockErr, syscall.EPERM) {
+			return nil
+		}
+		return sockErr
+	}
+}
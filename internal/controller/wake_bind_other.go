@@ -0,0 +1,10 @@
+//go:build !linux
+
+package controller
+
+import "syscall"
+
+// bindToDevice 非Linux平台不支持绑定网卡，仅通过源地址选择出口
+func bindToDevice(ifaceName string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
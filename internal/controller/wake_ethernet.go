@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"errors"
+	"net"
+)
+
+const (
+	// ETHERTYPE_WOL 网络唤醒以太网帧的EtherType
+	ETHERTYPE_WOL = 0x0842
+)
+
+// ErrRawSocketPermission 表示进程没有创建原始套接字的权限（缺少CAP_NET_RAW）
+var ErrRawSocketPermission = errors.New("raw socket requires CAP_NET_RAW capability")
+
+// ErrEthernetUnsupported 表示当前平台不支持以太网帧方式发送Magic Packet
+var ErrEthernetUnsupported = errors.New("ethernet transport is only supported on linux")
+
+// buildEthernetFrame 构造以太网帧：目标MAC、源MAC、EtherType和负载
+func buildEthernetFrame(dst, src net.HardwareAddr, etherType uint16, payload []byte) []byte {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, dst...)
+	frame = append(frame, src...)
+	frame = append(frame, byte(etherType>>8), byte(etherType))
+	frame = append(frame, payload...)
+	return frame
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package controller
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// sendEthernetMagicPacket 通过AF_PACKET套接字从指定网卡发送EtherType为0x0842的Magic Packet
+func sendEthernetMagicPacket(ifaceName string, packet []byte) error {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return fmt.Errorf("failed to find interface %s: %w", ifaceName, err)
+	}
+
+	if len(iface.HardwareAddr) != 6 {
+		return fmt.Errorf("interface %s has no ethernet address", ifaceName)
+	}
+
+	// 创建原始套接字，需要CAP_NET_RAW权限
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(ETHERTYPE_WOL)))
+	if err != nil {
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+			return fmt.Errorf("failed to open raw socket on %s: %w (run as root or grant it with 'setcap cap_net_raw+ep')", ifaceName, ErrRawSocketPermission)
+		}
+		return fmt.Errorf("failed to open raw socket on %s: %w", ifaceName, err)
+	}
+	defer syscall.Close(fd)
+
+	// 使用广播地址作为目标，保证交换机会将帧转发到所有端口
+	broadcast := net.HardwareAddr{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	frame := buildEthernetFrame(broadcast, iface.HardwareAddr, ETHERTYPE_WOL, packet)
+
+	addr := &syscall.SockaddrLinklayer{
+		Protocol: htons(ETHERTYPE_WOL),
+		Ifindex:  iface.Index,
+		Halen:    6,
+	}
+	copy(addr.Addr[:], broadcast)
+
+	if err := syscall.Sendto(fd, frame, 0, addr); err != nil {
+		return fmt.Errorf("failed to send ethernet frame on %s: %w", ifaceName, err)
+	}
+
+	return nil
+}
+
+// htons 将16位整数从主机字节序转换为网络字节序
+func htons(v uint16) uint16 {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return binary.NativeEndian.Uint16(b[:])
+}
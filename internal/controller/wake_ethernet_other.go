@@ -0,0 +1,10 @@
+//go:build !linux
+
+package controller
+
+import "fmt"
+
+// sendEthernetMagicPacket 非Linux平台不支持以太网帧方式发送Magic Packet
+func sendEthernetMagicPacket(ifaceName string, packet []byte) error {
+	return fmt.Errorf("failed to send ethernet frame on %s: %w", ifaceName, ErrEthernetUnsupported)
+}
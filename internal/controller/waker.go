@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+const (
+	// WAKER_WOL 通过网络唤醒Magic Packet唤醒设备
+	WAKER_WOL = "wol"
+	// WAKER_HTTP 通过HTTP请求（如智能插座API）唤醒设备
+	WAKER_HTTP = "http"
+	// WAKER_EXEC 通过执行本地命令（如ipmitool）唤醒设备
+	WAKER_EXEC = "exec"
+
+	// DEFAULT_WAKER_TIMEOUT HTTP和命令方式唤醒的默认超时时间
+	DEFAULT_WAKER_TIMEOUT = 10 * time.Second
+	// MAX_OUTPUT_LENGTH 响应消息中包含的命令输出或响应体的最大长度
+	MAX_OUTPUT_LENGTH = 200
+)
+
+// Waker 定义唤醒设备的方式
+type Waker interface {
+	// Wake 唤醒指定设备，返回描述唤醒结果的消息
+	Wake(ctx context.Context, device *config.DeviceConfig) (string, error)
+}
+
+// NewWaker 根据设备配置的唤醒方式创建对应的Waker
+func NewWaker(device *config.DeviceConfig, defaults config.WakeConfig) (Waker, error) {
+	switch device.Waker {
+	case "", WAKER_WOL:
+		return &WOLWaker{Defaults: defaults}, nil
+	case WAKER_HTTP:
+		return &HTTPWaker{Client: http.DefaultClient}, nil
+	case WAKER_EXEC:
+		return &ExecWaker{}, nil
+	default:
+		return nil, fmt.Errorf("unknown waker: %s", device.Waker)
+	}
+}
+
+// WOLWaker 通过网络唤醒Magic Packet唤醒设备
+type WOLWaker struct {
+	Defaults config.WakeConfig // 全局唤醒配置
+}
+
+// Wake 发送Magic Packet唤醒设备
+func (w *WOLWaker) Wake(ctx context.Context, device *config.DeviceConfig) (string, error) {
+	sent, err := WakeOnLANWithOptions(device.MAC, device.IP, device.Port, wakeOptions(device, w.Defaults))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Wake-on-LAN packet sent to %s (%d packets)", device.Name, sent), nil
+}
+
+// wakeOptions 根据设备配置和全局唤醒配置生成发送Magic Packet的选项
+// 设备级别的配置优先于全局配置
+func wakeOptions(device *config.DeviceConfig, defaults config.WakeConfig) WakeOptions {
+	opts := WakeOptions{
+		SecureOn:       device.SecureOn,
+		Transport:      device.Transport,
+		Interface:      device.Interface,
+		Subnet:         device.Subnet,
+		IPv6:           device.IPv6,
+		Repeat:         defaults.Repeat,
+		RepeatInterval: time.Duration(defaults.RepeatInterval) * time.Millisecond,
+		Ports:          defaults.Ports,
+	}
+
+	if device.Repeat > 0 {
+		opts.Repeat = device.Repeat
+	}
+	if device.RepeatInterval > 0 {
+		opts.RepeatInterval = time.Duration(device.RepeatInterval) * time.Millisecond
+	}
+
+	// 设备指定了端口时不使用全局端口列表
+	if len(device.Ports) > 0 {
+		opts.Ports = device.Ports
+	} else if device.Port > 0 {
+		opts.Ports = nil
+	}
+
+	return opts
+}
+
+// HTTPWaker 通过HTTP请求唤醒设备
+// URL、请求头和请求体支持使用设备字段作为模板，如 {{.Name}}、{{.MAC}}、{{.IP}}
+type HTTPWaker struct {
+	Client *http.Client
+}
+
+// Wake 发送HTTP请求唤醒设备
+func (w *HTTPWaker) Wake(ctx context.Context, device *config.DeviceConfig) (string, error) {
+	status, err := sendHTTPRequest(ctx, w.Client, device.HTTP, device)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("HTTP wake request sent to %s (status %d)", device.Name, status), nil
+}
+
+// sendHTTPRequest 使用设备字段渲染并发送HTTP请求，返回响应状态码
+func sendHTTPRequest(ctx context.Context, client *http.Client, cfg config.HTTPWakerConfig, device *config.DeviceConfig) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, wakerTimeout(cfg.Timeout))
+	defer cancel()
+
+	// 渲染请求模板
+	url, err := renderTemplate(cfg.URL, device)
+	if err != nil {
+		return 0, fmt.Errorf("failed to render URL: %w", err)
+	}
+	body, err := renderTemplate(cfg.Body, device)
+	if err != nil {
+		return 0, fmt.Errorf("failed to render body: %w", err)
+	}
+
+	method := strings.ToUpper(cfg.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	for name, value := range cfg.Headers {
+		rendered, err := renderTemplate(value, device)
+		if err != nil {
+			return 0, fmt.Errorf("failed to render header %s: %w", name, err)
+		}
+		req.Header.Set(name, rendered)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, MAX_OUTPUT_LENGTH))
+
+	if !isSuccessStatus(resp.StatusCode, cfg.StatusCodes) {
+		return 0, fmt.Errorf("unexpected HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	return resp.StatusCode, nil
+}
+
+// isSuccessStatus 判断HTTP状态码是否表示成功
+// 如果没有配置成功状态码，则所有2xx状态码都视为成功
+func isSuccessStatus(status int, codes []int) bool {
+	if len(codes) == 0 {
+		return status >= 200 && status < 300
+	}
+
+	for _, code := range codes {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecWaker 通过执行本地命令唤醒设备
+// 命令参数支持使用设备字段作为模板，如 {{.Name}}、{{.MAC}}、{{.IP}}
+type ExecWaker struct{}
+
+// Wake 执行命令唤醒设备
+func (w *ExecWaker) Wake(ctx context.Context, device *config.DeviceConfig) (string, error) {
+	output, err := runCommand(ctx, device.Exec, device)
+	if err != nil {
+		return "", err
+	}
+
+	message := fmt.Sprintf("Wake command executed for %s", device.Name)
+	if output != "" {
+		message += ": " + output
+	}
+	return message, nil
+}
+
+// runCommand 使用设备字段渲染命令参数并执行命令，返回截断后的输出
+func runCommand(ctx context.Context, cfg config.ExecWakerConfig, device *config.DeviceConfig) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, wakerTimeout(cfg.Timeout))
+	defer cancel()
+
+	// 渲染命令参数模板
+	args := make([]string, 0, len(cfg.Args))
+	for _, arg := range cfg.Args {
+		rendered, err := renderTemplate(arg, device)
+		if err != nil {
+			return "", fmt.Errorf("failed to render argument %q: %w", arg, err)
+		}
+		args = append(args, rendered)
+	}
+
+	output, err := exec.CommandContext(ctx, cfg.Command, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("command %s failed: %w, output: %s", cfg.Command, err, truncate(string(output)))
+	}
+
+	return truncate(string(output)), nil
+}
+
+// renderTemplate 使用设备字段渲染模板字符串
+func renderTemplate(text string, device *config.DeviceConfig) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("waker").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, device); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// wakerTimeout 返回HTTP和命令方式唤醒的超时时间
+func wakerTimeout(seconds int) time.Duration {
+	if seconds <= 0 {
+		return DEFAULT_WAKER_TIMEOUT
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// truncate 去除首尾空白并截断过长的输出
+func truncate(output string) string {
+	output = strings.TrimSpace(output)
+	if runes := []rune(output); len(runes) > MAX_OUTPUT_LENGTH {
+		output = string(runes[:MAX_OUTPUT_LENGTH]) + "..."
+	}
+	return output
+}
@@ -0,0 +1,253 @@
+package mqtt
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+const (
+	// AUTH_SCRAM_SHA256 SCRAM-SHA-256认证方法 (RFC 7677)
+	AUTH_SCRAM_SHA256 = "SCRAM-SHA-256"
+	// AUTH_SCRAM_SHA512 SCRAM-SHA-512认证方法
+	AUTH_SCRAM_SHA512 = "SCRAM-SHA-512"
+)
+
+// Authenticator 定义MQTT v5增强认证方法，通过CONNECT、AUTH和CONNACK报文与服务器交换认证数据
+type Authenticator interface {
+	// Method 返回认证方法名称，如 "SCRAM-SHA-256"
+	Method() string
+	// Start 返回CONNECT报文中携带的初始认证数据
+	Start() ([]byte, error)
+	// Continue 处理服务器在AUTH报文中发送的认证数据，返回回应服务器的认证数据
+	Continue(data []byte) ([]byte, error)
+	// Finish 处理服务器在CONNACK报文中返回的认证数据，认证没有完成时返回错误
+	Finish(data []byte) error
+}
+
+// NewAuthenticator 根据增强认证配置创建对应的Authenticator
+// SCRAM方法使用auth.username和auth.password，其他方法只在CONNECT报文中发送auth_data
+func NewAuthenticator(cfg *config.MQTTConfig) Authenticator {
+	switch strings.ToUpper(cfg.Auth.Enhanced.AuthMethod) {
+	case AUTH_SCRAM_SHA256:
+		return NewScramAuthenticator(AUTH_SCRAM_SHA256, sha256.New, cfg.Auth.Username, cfg.Auth.Password)
+	case AUTH_SCRAM_SHA512:
+		return NewScramAuthenticator(AUTH_SCRAM_SHA512, sha512.New, cfg.Auth.Username, cfg.Auth.Password)
+	default:
+		return &StaticAuthenticator{AuthMethod: cfg.Auth.Enhanced.AuthMethod, AuthData: []byte(cfg.Auth.Enhanced.AuthData)}
+	}
+}
+
+// StaticAuthenticator 只在CONNECT报文中发送固定认证数据的认证方法，如令牌认证
+type StaticAuthenticator struct {
+	AuthMethod string
+	AuthData   []byte
+}
+
+// Method 返回认证方法名称
+func (a *StaticAuthenticator) Method() string {
+	return a.AuthMethod
+}
+
+// Start 返回配置的认证数据
+func (a *StaticAuthenticator) Start() ([]byte, error) {
+	return a.AuthData, nil
+}
+
+// Continue 固定认证数据不支持多步认证
+func (a *StaticAuthenticator) Continue(data []byte) ([]byte, error) {
+	return nil, fmt.Errorf("authentication method %s does not support AUTH exchange", a.AuthMethod)
+}
+
+// Finish 服务器返回CONNACK即表示认证成功
+func (a *StaticAuthenticator) Finish(data []byte) error {
+	return nil
+}
+
+// ScramAuthenticator 实现SCRAM认证方法的客户端 (RFC 5802，不使用通道绑定)
+// 客户端首条消息在CONNECT报文中发送，服务器的最终消息可以在AUTH或CONNACK报文中返回
+type ScramAuthenticator struct {
+	method   string
+	hash     func() hash.Hash
+	username string
+	password string
+
+	clientNonce     string
+	clientFirstBare string
+	serverSignature []byte
+	verified        bool
+}
+
+// NewScramAuthenticator 创建使用指定哈希函数的SCRAM认证方法
+func NewScramAuthenticator(method string, h func() hash.Hash, username, password string) *ScramAuthenticator {
+	return &ScramAuthenticator{
+		method:   method,
+		hash:     h,
+		username: username,
+		password: password,
+	}
+}
+
+// Method 返回认证方法名称
+func (a *ScramAuthenticator) Method() string {
+	return a.method
+}
+
+// Start 返回客户端首条消息 "n,,n=<用户名>,r=<客户端随机数>"
+func (a *ScramAuthenticator) Start() ([]byte, error) {
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	a.clientNonce = base64.RawStdEncoding.EncodeToString(nonce)
+	a.clientFirstBare = "n=" + scramEscape(a.username) + ",r=" + a.clientNonce
+	a.serverSignature = nil
+	a.verified = false
+
+	return []byte("n,," + a.clientFirstBare), nil
+}
+
+// Continue 处理服务器首条消息并返回带有证明的客户端最终消息，或者校验服务器的最终消息
+func (a *ScramAuthenticator) Continue(data []byte) ([]byte, error) {
+	if a.serverSignature == nil {
+		return a.clientFinal(string(data))
+	}
+	if err := a.verify(string(data)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// Finish 校验服务器的最终消息，服务器已经在AUTH报文中返回过最终消息时CONNACK可以不带认证数据
+func (a *ScramAuthenticator) Finish(data []byte) error {
+	if len(data) == 0 {
+		if !a.verified {
+			return fmt.Errorf("%s: server did not send its signature", a.method)
+		}
+		return nil
+	}
+	return a.verify(string(data))
+}
+
+// clientFinal 根据服务器首条消息 "r=<随机数>,s=<盐>,i=<迭代次数>" 计算客户端证明
+func (a *ScramAuthenticator) clientFinal(serverFirst string) ([]byte, error) {
+	attrs := scramAttributes(serverFirst)
+	if msg, ok := attrs["e"]; ok {
+		return nil, fmt.Errorf("%s: server error: %s", a.method, msg)
+	}
+
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, a.clientNonce) || len(nonce) == len(a.clientNonce) {
+		return nil, fmt.Errorf("%s: invalid server nonce", a.method)
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("%s: invalid salt", a.method)
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations <= 0 {
+		return nil, fmt.Errorf("%s: invalid iteration count: %q", a.method, attrs["i"])
+	}
+
+	saltedPassword, err := pbkdf2.Key(a.hash, a.password, salt, iterations, a.hash().Size())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", a.method, err)
+	}
+
+	clientFinalBare := "c=biws,r=" + nonce // biws 为 "n,," 的Base64编码
+	authMessage := a.clientFirstBare + "," + serverFirst + "," + clientFinalBare
+
+	clientKey := a.hmac(saltedPassword, "Client Key")
+	storedKey := a.hash()
+	storedKey.Write(clientKey)
+	clientSignature := a.hmac(storedKey.Sum(nil), authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+
+	a.serverSignature = a.hmac(a.hmac(saltedPassword, "Server Key"), authMessage)
+
+	return []byte(clientFinalBare + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// verify 校验服务器最终消息 "v=<服务器签名>"
+func (a *ScramAuthenticator) verify(serverFinal string) error {
+	attrs := scramAttributes(serverFinal)
+	if msg, ok := attrs["e"]; ok {
+		return fmt.Errorf("%s: server error: %s", a.method, msg)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || !hmac.Equal(signature, a.serverSignature) {
+		return fmt.Errorf("%s: invalid server signature", a.method)
+	}
+
+	a.verified = true
+	return nil
+}
+
+// hmac 使用认证方法的哈希函数计算HMAC
+func (a *ScramAuthenticator) hmac(key []byte, message string) []byte {
+	mac := hmac.New(a.hash, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// scramAttributes 解析SCRAM消息中逗号分隔的 "名称=值" 属性
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, field := range strings.Split(msg, ",") {
+		if name, value, ok := strings.Cut(field, "="); ok {
+			attrs[name] = value
+		}
+	}
+	return attrs
+}
+
+// scramEscape 按照SCRAM规范转义用户名中的 "=" 和 ","
+func scramEscape(username string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(username)
+}
+
+// auther 将Authenticator适配为paho.Auther，记录认证过程中的第一个错误
+type auther struct {
+	authenticator Authenticator
+	err           error
+}
+
+// Authenticate 收到服务器的AUTH报文时调用，返回回应服务器的AUTH报文
+func (a *auther) Authenticate(auth *paho.Auth) *paho.Auth {
+	var data []byte
+	if auth.Properties != nil {
+		data = auth.Properties.AuthData
+	}
+
+	response, err := a.authenticator.Continue(data)
+	if err != nil && a.err == nil {
+		a.err = err
+	}
+
+	return &paho.Auth{
+		ReasonCode: packets.AuthContinueAuthentication,
+		Properties: &paho.AuthProperties{
+			AuthMethod: a.authenticator.Method(),
+			AuthData:   response,
+		},
+	}
+}
+
+// Authenticated 收到CONNACK时调用，服务器的认证数据在连接时由Finish校验
+func (a *auther) Authenticated() {}
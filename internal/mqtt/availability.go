@@ -0,0 +1,76 @@
+package mqtt
+
+import "log"
+
+const (
+	// DEFAULT_ONLINE_PAYLOAD 默认的上线消息
+	DEFAULT_ONLINE_PAYLOAD = "online"
+	// DEFAULT_OFFLINE_PAYLOAD 默认的下线消息
+	DEFAULT_OFFLINE_PAYLOAD = "offline"
+)
+
+// SetAvailability 设置可用性主题，必须在Connect之前调用
+// 每次连接成功后发布保留的上线消息，并将保留的下线消息设为遗嘱消息，连接异常断开时由服务器发布
+func (c *Client) SetAvailability(topic string) {
+	c.availabilityTopic = topic
+}
+
+// PublishOffline 发布保留的下线消息，用于正常退出时在Disconnect之前通知订阅者
+// 正常断开连接时服务器不发布遗嘱消息；未连接时服务器已经发布了遗嘱消息，不做处理
+func (c *Client) PublishOffline() error {
+	if c.availabilityTopic == "" {
+		return nil
+	}
+
+	c.mutex.Lock()
+	connected, conn := c.isConnected, c.conn
+	c.mutex.Unlock()
+
+	if !connected {
+		return nil
+	}
+	return c.publishAvailability(conn, c.offlinePayload())
+}
+
+// publishOnline 在连接conn上发布保留的上线消息
+func (c *Client) publishOnline(conn *connection) {
+	if c.availabilityTopic == "" {
+		return
+	}
+	if err := c.publishAvailability(conn, c.onlinePayload()); err != nil {
+		log.Printf("Failed to publish online status: %v", err)
+	}
+}
+
+// publishOffline 在连接conn上发布保留的下线消息
+func (c *Client) publishOffline(conn *connection) {
+	if c.availabilityTopic == "" {
+		return
+	}
+	if err := c.publishAvailability(conn, c.offlinePayload()); err != nil {
+		log.Printf("Failed to publish offline status: %v", err)
+	}
+}
+
+// publishAvailability 在连接conn上发布保留的可用性消息，不经过消息队列
+// 可用性消息不使用配置中的message_expiry，避免过期后新订阅者收不到状态
+func (c *Client) publishAvailability(conn *connection, payload string) error {
+	var noExpiry uint32
+	return c.publish(conn, c.availabilityTopic, byte(c.config.QoS), true, payload, &Properties{MessageExpiry: &noExpiry})
+}
+
+// onlinePayload 返回上线消息
+func (c *Client) onlinePayload() string {
+	if c.config.Availability.Online != "" {
+		return c.config.Availability.Online
+	}
+	return DEFAULT_ONLINE_PAYLOAD
+}
+
+// offlinePayload 返回下线消息
+func (c *Client) offlinePayload() string {
+	if c.config.Availability.Offline != "" {
+		return c.config.Availability.Offline
+	}
+	return DEFAULT_OFFLINE_PAYLOAD
+}
@@ -6,50 +6,143 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/fbigun/smartwaker/internal/config"
 )
 
+// ConnectHandler 连接成功回调，reconnected为true表示断线后重新连接成功
+type ConnectHandler func(reconnected bool)
+
+// ConnectionLostHandler 连接断开回调，客户端随后会在后台自动重连
+type ConnectionLostHandler func(err error)
+
+// subscription 记录订阅的主题，重新连接后自动恢复
+type subscription struct {
+	qos     byte
+	handler mqtt.MessageHandler
+}
+
 // Client MQTT客户端封装
+// 连接断开后在后台按指数退避自动重连，重连成功后恢复所有订阅
+// 配置了多个服务器时按优先级依次尝试连接，连接到备用服务器后定期尝试切换回优先级更高的服务器
+// 启用消息队列时断线期间发布的消息进入队列，重新连接后按原顺序发布
 type Client struct {
-	client     mqtt.Client
-	config     *config.MQTTConfig
-	onMessage  mqtt.MessageHandler
-	isConnected bool
+	conn                  *connection // 当前连接
+	config                *config.MQTTConfig
+	brokers               []config.BrokerConfig // 按优先级排列的服务器
+	onMessage             mqtt.MessageHandler
+	connectHandler        ConnectHandler
+	connectionLostHandler ConnectionLostHandler
+	isConnected           bool
+	closed                bool                    // 已调用Disconnect，不再重连
+	subscriptions         map[string]subscription // 订阅的主题过滤器及其处理函数
+	authenticator         Authenticator           // MQTT 5.0增强认证方法，为空时根据配置创建
+	queue                 *Queue                  // 断线期间发布的消息，未启用队列时为空
+	replaying             bool                    // 正在发布队列中的消息，期间新发布的消息同样进入队列
+	replayMutex           sync.Mutex              // 保证同一时间只有一个replayQueue在发布
+	availabilityTopic     string                  // 可用性主题，为空时不发布上线消息和遗嘱消息
+	stopChan              chan struct{}
+	mutex                 sync.Mutex
 }
 
 // NewClient 创建新的MQTT客户端
 func NewClient(cfg *config.MQTTConfig, onMessage mqtt.MessageHandler) *Client {
 	return &Client{
-		config:    cfg,
-		onMessage: onMessage,
+		config:        cfg,
+		brokers:       cfg.BrokerList(),
+		onMessage:     onMessage,
+		subscriptions: make(map[string]subscription),
+		stopChan:      make(chan struct{}),
 	}
 }
 
-// Connect 连接到MQTT服务器
+// SetAuthenticator 设置MQTT 5.0增强认证方法，替代根据auth.enhanced.auth_method创建的内置方法
+func (c *Client) SetAuthenticator(authenticator Authenticator) {
+	c.authenticator = authenticator
+}
+
+// SetOnConnect 设置连接成功回调，首次连接和每次重新连接成功后调用
+func (c *Client) SetOnConnect(handler ConnectHandler) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.connectHandler = handler
+}
+
+// SetOnConnectionLost 设置连接断开回调
+func (c *Client) SetOnConnectionLost(handler ConnectionLostHandler) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.connectionLostHandler = handler
+}
+
+// Connect 连接到MQTT服务器，首次连接失败时直接返回错误，不会在后台重连
 func (c *Client) Connect() error {
-	opts := c.createClientOptions()
+	if c.config.Queue.Enabled && c.queue == nil {
+		queue, err := NewQueue(c.config.Queue)
+		if err != nil {
+			return fmt.Errorf("failed to create publish queue: %w", err)
+		}
+		c.queue = queue
+	}
+
+	conn, err := c.dialBrokers(len(c.brokers))
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.conn = conn
+	c.isConnected = true
+	c.replaying = c.queue != nil && c.queue.Len() > 0
+	handler := c.connectHandler
+	c.mutex.Unlock()
+
+	log.Printf("Connected to MQTT broker: %s", c.brokers[conn.broker].URL)
+	c.publishOnline(conn)
+	// 发布上次运行时持久化的消息
+	c.replayQueue(conn)
+	c.startFailback(conn)
+	if handler != nil {
+		handler(false)
+	}
+	return nil
+}
+
+// dial 连接到第index个服务器
+func (c *Client) dial(index int) (*connection, error) {
+	cfg := c.brokerConfig(index)
+	conn := &connection{broker: index}
+
+	// paho.mqtt.golang只支持MQTT 3.1和3.1.1，MQTT 5.0使用paho.golang
+	if cfg.Version == 5 {
+		client, err := c.connectV5(cfg, conn)
+		if err != nil {
+			return nil, err
+		}
+		conn.v5 = client
+		return conn, nil
+	}
+
+	opts := c.createClientOptions(cfg, conn)
 
 	// 创建客户端实例
 	client := mqtt.NewClient(opts)
 
 	// 连接到服务器
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
 	}
 
-	c.client = client
-	c.isConnected = true
-	log.Printf("Connected to MQTT broker: %s", c.config.Broker)
-	
-	return nil
+	conn.client = client
+	return conn, nil
 }
 
-// Subscribe 订阅主题
+// Subscribe 订阅主题，重新连接后自动恢复订阅
 func (c *Client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) error {
-	if !c.isConnected {
+	if !c.IsConnected() {
 		return fmt.Errorf("mqtt client not connected")
 	}
 	
@@ -58,22 +151,83 @@ func (c *Client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler)
 	if callback != nil {
 		handler = callback
 	}
-	token := c.client.Subscribe(topic, qos, handler)
-	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to subscribe to topic %s: %w", topic, token.Error())
+
+	c.mutex.Lock()
+	previous, existed := c.subscriptions[topic]
+	c.subscriptions[topic] = subscription{qos: qos, handler: handler}
+	c.mutex.Unlock()
+
+	if err := c.current().subscribe(topic, qos, handler); err != nil {
+		c.mutex.Lock()
+		if existed {
+			c.subscriptions[topic] = previous
+		} else {
+			delete(c.subscriptions, topic)
+		}
+		c.mutex.Unlock()
+		return err
 	}
 	
 	log.Printf("Subscribed to topic: %s", topic)
 	return nil
 }
 
+// subscribe 在连接上订阅主题
+func (conn *connection) subscribe(topic string, qos byte, handler mqtt.MessageHandler) error {
+	if conn.v5 != nil {
+		return subscribeV5(conn.v5, topic, qos)
+	}
+
+	token := conn.client.Subscribe(topic, qos, handler)
+	if token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to subscribe to topic %s: %w", topic, token.Error())
+	}
+	return nil
+}
+
 // Publish 发布消息到指定主题
 func (c *Client) Publish(topic string, qos byte, retained bool, payload interface{}) error {
-	if !c.isConnected {
+	return c.PublishWithProperties(topic, qos, retained, payload, nil)
+}
+
+// PublishWithProperties 发布带有MQTT v5属性的消息，v3/v4连接忽略属性
+// 启用消息队列时，未连接、正在发布队列中的消息或发布时连接断开时将消息加入队列
+func (c *Client) PublishWithProperties(topic string, qos byte, retained bool, payload interface{}, props *Properties) error {
+	c.mutex.Lock()
+	if c.queue != nil && (!c.isConnected || c.replaying) {
+		defer c.mutex.Unlock()
+		return c.enqueue(topic, qos, retained, payload, props)
+	}
+	connected, conn := c.isConnected, c.conn
+	c.mutex.Unlock()
+
+	if !connected {
 		return fmt.Errorf("mqtt client not connected")
 	}
+	err := c.publish(conn, topic, qos, retained, payload, props)
+	if err == nil || c.queue == nil || (c.isActive(conn) && conn.isOpen()) {
+		return err
+	}
+
+	// 发布时连接已断开，连接断开回调可能还没有执行
+	c.mutex.Lock()
+	if c.conn != conn && c.isConnected && !c.replaying {
+		// 已经重新连接，在新连接上重新发布
+		c.mutex.Unlock()
+		return c.PublishWithProperties(topic, qos, retained, payload, props)
+	}
+	defer c.mutex.Unlock()
+	log.Printf("Connection lost while publishing to topic %s, queuing message", topic)
+	return c.enqueue(topic, qos, retained, payload, props)
+}
+
+// publish 在连接conn上发布消息
+func (c *Client) publish(conn *connection, topic string, qos byte, retained bool, payload interface{}, props *Properties) error {
+	if conn.v5 != nil {
+		return c.publishV5(conn.v5, topic, qos, retained, payload, props)
+	}
 	
-	token := c.client.Publish(topic, qos, retained, payload)
+	token := conn.client.Publish(topic, qos, retained, payload)
 	if token.Wait() && token.Error() != nil {
 		return fmt.Errorf("failed to publish to topic %s: %w", topic, token.Error())
 	}
@@ -81,43 +235,80 @@ func (c *Client) Publish(topic string, qos byte, retained bool, payload interfac
 	return nil
 }
 
-// Disconnect 断开MQTT连接
+// Disconnect 断开MQTT连接并停止重连
 func (c *Client) Disconnect() {
-	if c.client != nil && c.isConnected {
-		c.client.Disconnect(250) // 等待250ms完成正在进行的工作
-		c.isConnected = false
-		log.Println("Disconnected from MQTT broker")
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return
 	}
+	// 先更新状态，断开后的连接断开回调不再报告连接断开或触发重连
+	c.closed = true
+	close(c.stopChan)
+	connected := c.isConnected
+	c.isConnected = false
+	conn := c.conn
+	c.mutex.Unlock()
+
+	if !connected {
+		return
+	}
+	conn.close()
+	log.Println("Disconnected from MQTT broker")
 }
 
 // IsConnected 返回连接状态
 func (c *Client) IsConnected() bool {
-	return c.isConnected && c.client.IsConnected()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.isConnected
+}
+
+// current 返回当前连接
+func (c *Client) current() *connection {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.conn
 }
 
-// createClientOptions 创建MQTT客户端选项
-func (c *Client) createClientOptions() *mqtt.ClientOptions {
+// createClientOptions 创建连接服务器使用的MQTT客户端选项，连接断开时报告conn断开
+func (c *Client) createClientOptions(cfg *config.MQTTConfig, conn *connection) *mqtt.ClientOptions {
 	opts := mqtt.NewClientOptions()
-	opts.AddBroker(c.config.Broker)
-	opts.SetClientID(c.config.ClientID)
+	opts.AddBroker(cfg.Broker)
+	opts.SetClientID(cfg.ClientID)
+
+	// 设置WebSocket路径、HTTP头和代理
+	if isWebSocket(cfg.Broker) {
+		if err := setWebSocketOptions(opts, cfg); err != nil {
+			log.Printf("Warning: Failed to configure WebSocket: %v", err)
+		}
+	}
 	
 	// 设置认证信息
-	if c.config.Auth.Enabled {
-		opts.SetUsername(c.config.Auth.Username)
-		opts.SetPassword(c.config.Auth.Password)
+	if cfg.Auth.Enabled {
+		opts.SetUsername(cfg.Auth.Username)
+		opts.SetPassword(cfg.Auth.Password)
 	}
 	
 	// 设置MQTT会话参数
-	opts.SetCleanSession(c.config.CleanSession)
-	opts.SetKeepAlive(time.Duration(c.config.KeepAlive) * time.Second)
+	opts.SetCleanSession(cfg.CleanSession)
+	opts.SetKeepAlive(time.Duration(cfg.KeepAlive) * time.Second)
+	
+	// 连接异常断开时由服务器发布下线消息
+	if c.availabilityTopic != "" {
+		opts.SetWill(c.availabilityTopic, c.offlinePayload(), byte(cfg.QoS), true)
+	}
 	
-	// 设置连接和断线回调
-	opts.SetOnConnectHandler(c.onConnect)
-	opts.SetConnectionLostHandler(c.onConnectionLost)
+	// 设置断线回调，连接成功的日志由Connect和reconnect输出
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		c.connectionLost(conn, err)
+	})
+	// 由Client自行重连并恢复订阅
+	opts.SetAutoReconnect(false)
 	
 	// 设置TLS/SSL
-	if c.config.TLS.Enabled {
-		tlsConfig, err := c.createTLSConfig()
+	if cfg.TLS.Enabled {
+		tlsConfig, err := createTLSConfig(cfg.TLS)
 		if err != nil {
 			log.Printf("Warning: Failed to configure TLS: %v", err)
 		} else {
@@ -126,34 +317,43 @@ func (c *Client) createClientOptions() *mqtt.ClientOptions {
 	}
 	
 	// 设置MQTT版本
-	switch c.config.Version {
+	switch cfg.Version {
 	case 3:
 		opts.SetProtocolVersion(3) // MQTT 3.1
-	case 5:
-		opts.SetProtocolVersion(5) // MQTT 5.0
 	default:
 		opts.SetProtocolVersion(4) // MQTT 3.1.1 (默认)
 	}
 	
-	// 增强认证 (MQTT 5.0)
-	if c.config.Version == 5 && c.config.Auth.Enhanced.Enabled {
-		// 注意：Paho MQTT 客户端目前对MQTT 5增强认证的支持有限
-		// 这里是基本实现，可能需要根据具体的客户端库进行调整
-		log.Println("MQTT 5 enhanced authentication enabled")
-	}
-	
 	return opts
 }
 
+// setWebSocketOptions 设置MQTT over WebSocket选项
+func setWebSocketOptions(opts *mqtt.ClientOptions, cfg *config.MQTTConfig) error {
+	address, err := websocketURL(cfg.Broker, cfg.WebSocket)
+	if err != nil {
+		return err
+	}
+	wsOpts, err := websocketOptions(cfg.WebSocket)
+	if err != nil {
+		return err
+	}
+
+	opts.Servers = nil
+	opts.AddBroker(address)
+	opts.SetHTTPHeaders(websocketHeaders(cfg.WebSocket))
+	opts.SetWebsocketOptions(wsOpts)
+	return nil
+}
+
 // createTLSConfig 创建TLS配置
-func (c *Client) createTLSConfig() (*tls.Config, error) {
+func createTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
 	tlsConfig := &tls.Config{
-		InsecureSkipVerify: c.config.TLS.InsecureSkipVerify,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
 	}
 	
 	// 如果提供了CA证书，加载并配置
-	if c.config.TLS.CACert != "" {
-		caCert, err := os.ReadFile(c.config.TLS.CACert)
+	if cfg.CACert != "" {
+		caCert, err := os.ReadFile(cfg.CACert)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
 		}
@@ -167,8 +367,8 @@ func (c *Client) createTLSConfig() (*tls.Config, error) {
 	}
 	
 	// 如果提供了客户端证书和密钥，加载并配置
-	if c.config.TLS.ClientCert != "" && c.config.TLS.ClientKey != "" {
-		cert, err := tls.LoadX509KeyPair(c.config.TLS.ClientCert, c.config.TLS.ClientKey)
+	if cfg.ClientCert != "" && cfg.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load client certificate/key: %w", err)
 		}
@@ -178,14 +378,3 @@ func (c *Client) createTLSConfig() (*tls.Config, error) {
 	
 	return tlsConfig, nil
 }
-
-// onConnect MQTT连接成功回调
-func (c *Client) onConnect(client mqtt.Client) {
-	log.Println("Connected to MQTT broker")
-}
-
-// onConnectionLost MQTT连接断开回调
-func (c *Client) onConnectionLost(client mqtt.Client, err error) {
-	c.isConnected = false
-	log.Printf("Connection to MQTT broker lost: %v", err)
-}
@@ -0,0 +1,171 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+// DEFAULT_FAILBACK_INTERVAL 连接到备用服务器时检查优先级更高的服务器的默认间隔
+const DEFAULT_FAILBACK_INTERVAL = 60 * time.Second
+
+// connection 到某个服务器的一次连接
+type connection struct {
+	client mqtt.Client  // MQTT 3.1/3.1.1连接
+	v5     *paho.Client // MQTT 5.0连接，version为5时使用
+	broker int          // 服务器在brokers中的序号
+}
+
+// close 关闭连接
+func (conn *connection) close() {
+	if conn.v5 != nil {
+		conn.v5.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	} else if conn.client != nil {
+		conn.client.Disconnect(250) // 等待250ms完成正在进行的工作
+	}
+}
+
+// isOpen 判断连接是否仍然打开
+func (conn *connection) isOpen() bool {
+	if conn.v5 != nil {
+		select {
+		case <-conn.v5.Done():
+			return false
+		default:
+			return true
+		}
+	}
+	return conn.client.IsConnectionOpen()
+}
+
+// BrokerStatus 服务器连接状态
+type BrokerStatus struct {
+	Brokers   []string // 按优先级排列的服务器地址
+	Active    string   // 当前连接的服务器地址，未连接时为空
+	Preferred bool     // 当前连接的是否为优先级最高的服务器
+	Connected bool
+}
+
+// BrokerStatus 返回服务器列表和当前连接的服务器
+func (c *Client) BrokerStatus() BrokerStatus {
+	status := BrokerStatus{Brokers: make([]string, len(c.brokers))}
+	for i, broker := range c.brokers {
+		status.Brokers[i] = broker.URL
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.isConnected {
+		status.Connected = true
+		status.Active = c.brokers[c.conn.broker].URL
+		status.Preferred = c.conn.broker == 0
+	}
+	return status
+}
+
+// brokerConfig 返回连接第index个服务器使用的配置，服务器的auth和tls覆盖全局配置
+func (c *Client) brokerConfig(index int) *config.MQTTConfig {
+	broker := c.brokers[index]
+	cfg := *c.config
+	cfg.Broker = broker.URL
+	if broker.Auth != nil {
+		cfg.Auth = *broker.Auth
+	}
+	if broker.TLS != nil {
+		cfg.TLS = *broker.TLS
+	}
+	return &cfg
+}
+
+// dialBrokers 按优先级依次连接前limit个服务器，返回第一个建立的连接
+func (c *Client) dialBrokers(limit int) (*connection, error) {
+	// 只有一个服务器时保留原始错误
+	if len(c.brokers) == 1 {
+		return c.dial(0)
+	}
+
+	var errs []error
+	for i := 0; i < limit; i++ {
+		conn, err := c.dial(i)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", c.brokers[i].URL, err))
+	}
+	return nil, fmt.Errorf("all MQTT brokers unavailable: %w", errors.Join(errs...))
+}
+
+// startFailback 连接到备用服务器时在后台开始检查优先级更高的服务器
+func (c *Client) startFailback(conn *connection) {
+	if conn.broker > 0 {
+		go c.failback(conn)
+	}
+}
+
+// failback 定期尝试连接优先级高于conn的服务器，成功后切换到新连接
+// conn断开或调用Disconnect后停止，断开后由reconnect重新选择服务器
+func (c *Client) failback(conn *connection) {
+	interval := time.Duration(c.config.FailbackInterval) * time.Second
+	if interval <= 0 {
+		interval = DEFAULT_FAILBACK_INTERVAL
+	}
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-time.After(interval):
+		}
+
+		if !c.isActive(conn) {
+			return
+		}
+		next, err := c.dialBrokers(conn.broker)
+		if err != nil {
+			log.Printf("Preferred MQTT broker still unavailable: %v", err)
+			continue
+		}
+		c.switchConnection(conn, next)
+		return
+	}
+}
+
+// isActive 判断conn是否为当前已连接的连接
+func (c *Client) isActive(conn *connection) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.conn == conn && c.isConnected && !c.closed
+}
+
+// switchConnection 将当前连接从old切换到next，切换前在next上恢复所有订阅
+func (c *Client) switchConnection(old, next *connection) {
+	c.restoreSubscriptions(next)
+
+	c.mutex.Lock()
+	if c.conn != old || !c.isConnected || c.closed {
+		// 切换期间连接已断开或调用了Disconnect
+		c.mutex.Unlock()
+		next.close()
+		return
+	}
+	c.conn = next
+	c.replaying = c.queue != nil && c.queue.Len() > 0
+	handler := c.connectHandler
+	c.mutex.Unlock()
+
+	c.publishOnline(next)
+	// 正常断开时服务器不发布遗嘱消息，由客户端通知原服务器上的订阅者
+	c.publishOffline(old)
+	old.close()
+	c.replayQueue(next)
+	log.Printf("Switched MQTT broker from %s to %s", c.brokers[old.broker].URL, c.brokers[next.broker].URL)
+	c.startFailback(next)
+	if handler != nil {
+		handler(true)
+	}
+}
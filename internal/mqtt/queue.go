@@ -0,0 +1,277 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+const (
+	// DEFAULT_QUEUE_SIZE 消息队列默认最多保存的消息数
+	DEFAULT_QUEUE_SIZE = 1000
+	// QUEUE_FILE_EXT 持久化消息文件的扩展名
+	QUEUE_FILE_EXT = ".json"
+)
+
+// ErrQueueFull 队列已满且丢弃策略为newest时，新消息被丢弃
+var ErrQueueFull = errors.New("mqtt publish queue is full")
+
+// QueuedMessage 断线期间等待发布的消息
+type QueuedMessage struct {
+	Topic      string      `json:"topic"`
+	QoS        byte        `json:"qos"`
+	Retained   bool        `json:"retained"`
+	Payload    []byte      `json:"payload"`
+	Properties *Properties `json:"properties,omitempty"`
+	Queued     time.Time   `json:"queued"` // 进入队列的时间
+
+	seq uint64 // 序号，同时用作持久化文件名
+}
+
+// Queue 有界的消息队列，按进入队列的顺序保存消息
+// 配置了持久化目录时每条消息保存为一个文件，程序重启后从目录恢复
+type Queue struct {
+	config   config.QueueConfig
+	messages []*QueuedMessage
+	next     uint64 // 下一条消息的序号
+	mutex    sync.Mutex
+}
+
+// NewQueue 创建消息队列，配置了持久化目录时加载目录中保存的消息
+func NewQueue(cfg config.QueueConfig) (*Queue, error) {
+	q := &Queue{config: cfg}
+	if q.config.Size <= 0 {
+		q.config.Size = DEFAULT_QUEUE_SIZE
+	}
+
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create queue directory: %w", err)
+		}
+		if err := q.load(); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// Push 将消息加入队列末尾
+// 队列已满时按丢弃策略丢弃最早的消息，或丢弃新消息并返回ErrQueueFull
+func (q *Queue) Push(msg *QueuedMessage) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.dropExpired()
+	if len(q.messages) >= q.config.Size {
+		if q.config.DropPolicy == "newest" {
+			return ErrQueueFull
+		}
+		log.Printf("Publish queue full, dropping oldest message to topic %s", q.messages[0].Topic)
+		q.remove(q.messages[0])
+	}
+
+	if msg.Queued.IsZero() {
+		msg.Queued = time.Now()
+	}
+	msg.seq = q.next
+	q.next++
+	if err := q.save(msg); err != nil {
+		return err
+	}
+	q.messages = append(q.messages, msg)
+	return nil
+}
+
+// Front 返回队列中最早的未过期消息，队列为空时返回nil
+func (q *Queue) Front() *QueuedMessage {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.dropExpired()
+	if len(q.messages) == 0 {
+		return nil
+	}
+	return q.messages[0]
+}
+
+// Remove 从队列中删除消息
+func (q *Queue) Remove(msg *QueuedMessage) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.remove(msg)
+}
+
+// Len 返回队列中的消息数
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.messages)
+}
+
+// dropExpired 丢弃队列头部超过ttl的消息
+func (q *Queue) dropExpired() {
+	if q.config.TTL <= 0 {
+		return
+	}
+	ttl := time.Duration(q.config.TTL) * time.Second
+	for len(q.messages) > 0 && time.Since(q.messages[0].Queued) > ttl {
+		log.Printf("Dropping expired queued message to topic %s", q.messages[0].Topic)
+		q.remove(q.messages[0])
+	}
+}
+
+// remove 从队列和持久化目录中删除消息
+func (q *Queue) remove(msg *QueuedMessage) {
+	for i, m := range q.messages {
+		if m == msg {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			break
+		}
+	}
+	if q.config.Dir != "" {
+		if err := os.Remove(q.path(msg.seq)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove queued message file: %v", err)
+		}
+	}
+}
+
+// path 返回序号为seq的消息的持久化文件路径，文件名按序号排序即为消息顺序
+func (q *Queue) path(seq uint64) string {
+	return filepath.Join(q.config.Dir, fmt.Sprintf("%020d%s", seq, QUEUE_FILE_EXT))
+}
+
+// save 将消息写入持久化目录，先写入临时文件再重命名，避免程序中断时留下不完整的文件
+func (q *Queue) save(msg *QueuedMessage) error {
+	if q.config.Dir == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode queued message: %w", err)
+	}
+	path := q.path(msg.seq)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write queued message: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write queued message: %w", err)
+	}
+	return nil
+}
+
+// load 按序号顺序加载持久化目录中的消息，无法解析的文件被删除
+func (q *Queue) load() error {
+	entries, err := os.ReadDir(q.config.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read queue directory: %w", err)
+	}
+
+	var seqs []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, QUEUE_FILE_EXT) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, QUEUE_FILE_EXT), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	for _, seq := range seqs {
+		path := q.path(seq)
+		msg := &QueuedMessage{seq: seq}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, msg)
+		}
+		if err != nil {
+			log.Printf("Discarding unreadable queued message %s: %v", path, err)
+			os.Remove(path)
+			continue
+		}
+		q.messages = append(q.messages, msg)
+		q.next = seq + 1
+	}
+
+	// 重启后配置的队列长度可能变小，只保留最新的消息
+	for len(q.messages) > q.config.Size {
+		q.remove(q.messages[0])
+	}
+	if len(q.messages) > 0 {
+		log.Printf("Loaded %d queued messages from %s", len(q.messages), q.config.Dir)
+	}
+	return nil
+}
+
+// enqueue 将消息加入客户端的消息队列，调用时必须持有c.mutex
+func (c *Client) enqueue(topic string, qos byte, retained bool, payload interface{}, props *Properties) error {
+	data, err := payloadBytes(payload)
+	if err != nil {
+		return fmt.Errorf("failed to queue message to topic %s: %w", topic, err)
+	}
+
+	msg := &QueuedMessage{Topic: topic, QoS: qos, Retained: retained, Payload: data, Properties: props}
+	if err := c.queue.Push(msg); err != nil {
+		return fmt.Errorf("failed to queue message to topic %s: %w", topic, err)
+	}
+	return nil
+}
+
+// replayQueue 在conn上按原顺序发布队列中的消息，直到队列为空、连接断开或切换到其他连接
+// 服务器拒绝的消息被丢弃，连接断开时剩余的消息留在队列中，由切换后的连接继续发布
+// 同一时间只有一个replayQueue在发布，避免新旧连接上的发布重复或乱序
+func (c *Client) replayQueue(conn *connection) {
+	if c.queue == nil {
+		return
+	}
+
+	c.replayMutex.Lock()
+	defer c.replayMutex.Unlock()
+
+	published := 0
+	for {
+		c.mutex.Lock()
+		if c.conn != conn {
+			// 已切换到其他连接，由切换后的连接结束发布
+			c.mutex.Unlock()
+			break
+		}
+		msg := c.queue.Front()
+		if msg == nil || !c.isConnected {
+			// 在持有锁时结束发布，之后发布的消息不再进入队列
+			c.replaying = false
+			c.mutex.Unlock()
+			break
+		}
+		c.mutex.Unlock()
+
+		if err := c.publish(conn, msg.Topic, msg.QoS, msg.Retained, msg.Payload, msg.Properties); err != nil {
+			if !(c.isActive(conn) && conn.isOpen()) {
+				// 消息留在队列中，重新连接后发布
+				break
+			}
+			log.Printf("Dropping queued message: %v", err)
+		} else {
+			published++
+		}
+		c.queue.Remove(msg)
+	}
+
+	if published > 0 {
+		log.Printf("Published %d queued messages", published)
+	}
+}
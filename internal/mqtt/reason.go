@@ -0,0 +1,68 @@
+package mqtt
+
+import "fmt"
+
+// reasonCodeNames MQTT 5.0规范中定义的失败原因码
+var reasonCodeNames = map[byte]string{
+	0x80: "unspecified error",
+	0x81: "malformed packet",
+	0x82: "protocol error",
+	0x83: "implementation specific error",
+	0x84: "unsupported protocol version",
+	0x85: "client identifier not valid",
+	0x86: "bad user name or password",
+	0x87: "not authorized",
+	0x88: "server unavailable",
+	0x89: "server busy",
+	0x8A: "banned",
+	0x8B: "server shutting down",
+	0x8C: "bad authentication method",
+	0x8D: "keep alive timeout",
+	0x8E: "session taken over",
+	0x8F: "topic filter invalid",
+	0x90: "topic name invalid",
+	0x91: "packet identifier in use",
+	0x92: "packet identifier not found",
+	0x93: "receive maximum exceeded",
+	0x94: "topic alias invalid",
+	0x95: "packet too large",
+	0x96: "message rate too high",
+	0x97: "quota exceeded",
+	0x98: "administrative action",
+	0x99: "payload format invalid",
+	0x9A: "retain not supported",
+	0x9B: "QoS not supported",
+	0x9C: "use another server",
+	0x9D: "server moved",
+	0x9E: "shared subscriptions not supported",
+	0x9F: "connection rate exceeded",
+	0xA0: "maximum connect time",
+	0xA1: "subscription identifiers not supported",
+	0xA2: "wildcard subscriptions not supported",
+}
+
+// ReasonCodeError 定义MQTT 5.0服务器在CONNACK、SUBACK、PUBACK或DISCONNECT报文中返回的失败原因
+type ReasonCodeError struct {
+	Code   byte   // 原因码，0x80及以上表示失败
+	Reason string // 服务器返回的原因字符串，可能为空
+}
+
+// Error 返回包含原因码的错误描述，如 "not authorized (reason code 0x87)"
+func (e *ReasonCodeError) Error() string {
+	name, ok := reasonCodeNames[e.Code]
+	if !ok {
+		name = "unknown reason"
+	}
+	if e.Reason != "" && e.Reason != name {
+		name += ": " + e.Reason
+	}
+	return fmt.Sprintf("%s (reason code 0x%02X)", name, e.Code)
+}
+
+// reasonCodeError 原因码表示失败时返回ReasonCodeError，否则返回nil
+func reasonCodeError(code byte, reason string) error {
+	if code < 0x80 {
+		return nil
+	}
+	return &ReasonCodeError{Code: code, Reason: reason}
+}
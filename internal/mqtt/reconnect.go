@@ -0,0 +1,131 @@
+package mqtt
+
+import (
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// DEFAULT_RECONNECT_INTERVAL 连接断开后首次重连前的默认等待时间
+	DEFAULT_RECONNECT_INTERVAL = 1 * time.Second
+	// DEFAULT_MAX_RECONNECT_INTERVAL 重连等待时间的默认上限
+	DEFAULT_MAX_RECONNECT_INTERVAL = 60 * time.Second
+)
+
+// connectionLost 处理连接conn断开，通知回调并在后台开始重连
+// 同一次断开可能被多次报告，只有第一次生效；已被替换的连接断开时不做处理
+func (c *Client) connectionLost(conn *connection, err error) {
+	c.mutex.Lock()
+	if c.conn != conn || !c.isConnected || c.closed {
+		c.mutex.Unlock()
+		return
+	}
+	c.isConnected = false
+	handler := c.connectionLostHandler
+	c.mutex.Unlock()
+
+	log.Printf("Connection to MQTT broker %s lost: %v", c.brokers[conn.broker].URL, err)
+	if handler != nil {
+		handler(err)
+	}
+
+	go c.reconnect()
+}
+
+// reconnect 按指数退避重连直到成功或调用Disconnect，重连成功后恢复所有订阅
+// 每次重连按优先级依次尝试所有服务器
+func (c *Client) reconnect() {
+	backoff := newBackoff(c.config.ReconnectInterval, c.config.MaxReconnectInterval)
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-c.stopChan:
+			return
+		case <-time.After(backoff.next()):
+		}
+
+		conn, err := c.dialBrokers(len(c.brokers))
+		if err != nil {
+			log.Printf("Reconnect attempt %d to MQTT broker failed: %v", attempt, err)
+			continue
+		}
+
+		c.mutex.Lock()
+		if c.closed {
+			// 重连期间调用了Disconnect，关闭刚建立的连接
+			c.mutex.Unlock()
+			conn.close()
+			return
+		}
+		c.conn = conn
+		c.isConnected = true
+		c.replaying = c.queue != nil && c.queue.Len() > 0
+		handler := c.connectHandler
+		c.mutex.Unlock()
+
+		log.Printf("Reconnected to MQTT broker: %s (attempt %d)", c.brokers[conn.broker].URL, attempt)
+		c.restoreSubscriptions(conn)
+		c.publishOnline(conn)
+		c.replayQueue(conn)
+		c.startFailback(conn)
+		if handler != nil {
+			handler(true)
+		}
+		return
+	}
+}
+
+// restoreSubscriptions 在新连接上重新订阅所有主题
+func (c *Client) restoreSubscriptions(conn *connection) {
+	c.mutex.Lock()
+	subscriptions := make(map[string]subscription, len(c.subscriptions))
+	for topic, sub := range c.subscriptions {
+		subscriptions[topic] = sub
+	}
+	c.mutex.Unlock()
+
+	for topic, sub := range subscriptions {
+		if err := conn.subscribe(topic, sub.qos, sub.handler); err != nil {
+			log.Printf("Failed to restore subscription: %v", err)
+			continue
+		}
+		log.Printf("Restored subscription to topic: %s", topic)
+	}
+}
+
+// backoff 计算带抖动的指数退避等待时间
+type backoff struct {
+	current time.Duration
+	max     time.Duration
+}
+
+// newBackoff 创建指数退避，interval和maxInterval单位为秒，为0时使用默认值
+func newBackoff(interval, maxInterval int) *backoff {
+	b := &backoff{
+		current: time.Duration(interval) * time.Second,
+		max:     time.Duration(maxInterval) * time.Second,
+	}
+	if b.current <= 0 {
+		b.current = DEFAULT_RECONNECT_INTERVAL
+	}
+	if b.max <= 0 {
+		b.max = DEFAULT_MAX_RECONNECT_INTERVAL
+	}
+	if b.current > b.max {
+		b.current = b.max
+	}
+	return b
+}
+
+// next 返回下一次等待时间并将基准时间加倍
+// 等待时间在基准时间的一半到全部之间随机选取，避免大量客户端同时重连
+func (b *backoff) next() time.Duration {
+	wait := b.current/2 + rand.N(b.current/2+1)
+
+	b.current *= 2
+	if b.current > b.max {
+		b.current = b.max
+	}
+	return wait
+}
@@ -0,0 +1,414 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+const (
+	// CONNECT_TIMEOUT 连接MQTT服务器的超时时间
+	CONNECT_TIMEOUT = 30 * time.Second
+	// OPERATION_TIMEOUT 订阅和发布等操作的超时时间
+	OPERATION_TIMEOUT = 10 * time.Second
+)
+
+// Properties 定义MQTT v5消息属性，v3/v4连接中会被忽略
+type Properties struct {
+	ResponseTopic   string            // 响应主题，请求方希望接收响应的主题
+	CorrelationData []byte            // 关联数据，响应中原样返回以便请求方匹配请求
+	UserProperties  map[string]string // 用户属性，发布时覆盖配置中的同名属性
+	MessageExpiry   *uint32           // 消息过期时间(秒)，发布时覆盖配置中的message_expiry，0表示永不过期
+}
+
+// propertiesCarrier 由携带MQTT v5属性的消息实现
+type propertiesCarrier interface {
+	Properties() *Properties
+}
+
+// PropertiesOf 返回消息的MQTT v5属性，v3/v4连接收到的消息返回nil
+func PropertiesOf(msg mqtt.Message) *Properties {
+	if carrier, ok := msg.(propertiesCarrier); ok {
+		return carrier.Properties()
+	}
+	return nil
+}
+
+// message 将MQTT v5的PUBLISH报文适配为mqtt.Message
+type message struct {
+	publish *paho.Publish
+}
+
+func (m *message) Duplicate() bool   { return false }
+func (m *message) Qos() byte         { return m.publish.QoS }
+func (m *message) Retained() bool    { return m.publish.Retain }
+func (m *message) Topic() string     { return m.publish.Topic }
+func (m *message) MessageID() uint16 { return m.publish.PacketID }
+func (m *message) Payload() []byte   { return m.publish.Payload }
+
+// Ack 报文由客户端自动确认，这里无需处理
+func (m *message) Ack() {}
+
+// Properties 返回消息的MQTT v5属性
+func (m *message) Properties() *Properties {
+	props := &Properties{}
+	if m.publish.Properties != nil {
+		props.ResponseTopic = m.publish.Properties.ResponseTopic
+		props.CorrelationData = m.publish.Properties.CorrelationData
+		if len(m.publish.Properties.User) > 0 {
+			props.UserProperties = make(map[string]string, len(m.publish.Properties.User))
+			for _, user := range m.publish.Properties.User {
+				props.UserProperties[user.Key] = user.Value
+			}
+		}
+	}
+	return props
+}
+
+// connectV5 使用MQTT 5.0协议连接到服务器，连接断开时报告conn断开
+func (c *Client) connectV5(cfg *config.MQTTConfig, conn *connection) (*paho.Client, error) {
+	var tlsConfig *tls.Config
+	if cfg.TLS.Enabled {
+		var err error
+		if tlsConfig, err = createTLSConfig(cfg.TLS); err != nil {
+			log.Printf("Warning: Failed to configure TLS: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), CONNECT_TIMEOUT)
+	defer cancel()
+
+	netConn, err := dialBroker(ctx, cfg, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+
+	clientConfig := paho.ClientConfig{
+		ClientID:          cfg.ClientID,
+		Conn:              packets.NewThreadSafeConn(netConn),
+		OnPublishReceived: []func(paho.PublishReceived) (bool, error){c.routeV5},
+		OnClientError: func(err error) {
+			c.connectionLost(conn, err)
+		},
+		OnServerDisconnect: func(disconnect *paho.Disconnect) {
+			c.connectionLost(conn, serverDisconnectError(disconnect))
+		},
+	}
+
+	connect := &paho.Connect{
+		ClientID:   cfg.ClientID,
+		KeepAlive:  uint16(cfg.KeepAlive),
+		CleanStart: cfg.CleanSession,
+		// 请求服务器在错误响应中返回原因字符串和用户属性
+		Properties: &paho.ConnectProperties{RequestProblemInfo: true},
+	}
+	if cfg.SessionExpiry > 0 {
+		expiry := uint32(cfg.SessionExpiry)
+		connect.Properties.SessionExpiryInterval = &expiry
+	}
+	if c.availabilityTopic != "" {
+		connect.WillMessage = &paho.WillMessage{
+			Retain:  true,
+			QoS:     byte(cfg.QoS),
+			Topic:   c.availabilityTopic,
+			Payload: []byte(c.offlinePayload()),
+		}
+	}
+	if cfg.Auth.Enabled {
+		connect.Username = cfg.Auth.Username
+		connect.UsernameFlag = cfg.Auth.Username != ""
+		connect.Password = []byte(cfg.Auth.Password)
+		connect.PasswordFlag = cfg.Auth.Password != ""
+	}
+
+	// 增强认证：初始认证数据随CONNECT报文发送，服务器的质询在AUTH报文中处理
+	var authHandler *auther
+	if cfg.Auth.Enhanced.Enabled {
+		authenticator := c.authenticator
+		if authenticator == nil {
+			authenticator = NewAuthenticator(cfg)
+		}
+		data, err := authenticator.Start()
+		if err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("failed to start enhanced authentication: %w", err)
+		}
+		connect.Properties.AuthMethod = authenticator.Method()
+		connect.Properties.AuthData = data
+		authHandler = &auther{authenticator: authenticator}
+		clientConfig.AuthHandler = authHandler
+	}
+
+	client := paho.NewClient(clientConfig)
+	connack, err := client.Connect(ctx, connect)
+	if err == nil && authHandler != nil {
+		err = authHandler.err
+		if err == nil {
+			var data []byte
+			if connack.Properties != nil {
+				data = connack.Properties.AuthData
+			}
+			err = authHandler.authenticator.Finish(data)
+		}
+		if err != nil {
+			client.Disconnect(&paho.Disconnect{ReasonCode: 0x87})
+		}
+	}
+	if err != nil {
+		netConn.Close()
+		switch {
+		case authHandler != nil && authHandler.err != nil:
+			// 客户端认证失败时服务器返回的原因码不如本地错误准确
+			err = authHandler.err
+		case connack != nil:
+			if reasonErr := reasonCodeError(connack.ReasonCode, connackReason(connack)); reasonErr != nil {
+				err = reasonErr
+			}
+		}
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+
+	return client, nil
+}
+
+// operationContext 返回MQTT 5.0订阅和发布使用的上下文，超时或连接断开时取消
+// 连接断开后等待中的QoS 1/2应答不会再到达
+func operationContext(client *paho.Client) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), OPERATION_TIMEOUT)
+	go func() {
+		select {
+		case <-client.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// subscribeV5 使用MQTT 5.0协议订阅主题，收到的消息由routeV5分发给订阅的处理函数
+func subscribeV5(client *paho.Client, topic string, qos byte) error {
+	ctx, cancel := operationContext(client)
+	defer cancel()
+
+	suback, err := client.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: qos}},
+	})
+	if err != nil {
+		if suback != nil && len(suback.Reasons) > 0 {
+			reason := ""
+			if suback.Properties != nil {
+				reason = suback.Properties.ReasonString
+			}
+			if reasonErr := reasonCodeError(suback.Reasons[0], reason); reasonErr != nil {
+				err = reasonErr
+			}
+		}
+		return fmt.Errorf("failed to subscribe to topic %s: %w", topic, err)
+	}
+	return nil
+}
+
+// publishV5 使用MQTT 5.0协议发布消息
+func (c *Client) publishV5(client *paho.Client, topic string, qos byte, retained bool, payload interface{}, props *Properties) error {
+	data, err := payloadBytes(payload)
+	if err != nil {
+		return fmt.Errorf("failed to publish to topic %s: %w", topic, err)
+	}
+
+	publish := &paho.Publish{
+		Topic:      topic,
+		QoS:        qos,
+		Retain:     retained,
+		Payload:    data,
+		Properties: &paho.PublishProperties{},
+	}
+	expiry := uint32(c.config.MessageExpiry)
+	if props != nil && props.MessageExpiry != nil {
+		expiry = *props.MessageExpiry
+	}
+	if expiry > 0 {
+		publish.Properties.MessageExpiry = &expiry
+	}
+	userProperties := c.config.UserProperties
+	if props != nil {
+		publish.Properties.ResponseTopic = props.ResponseTopic
+		publish.Properties.CorrelationData = props.CorrelationData
+		if len(props.UserProperties) > 0 {
+			userProperties = make(map[string]string, len(c.config.UserProperties)+len(props.UserProperties))
+			for key, value := range c.config.UserProperties {
+				userProperties[key] = value
+			}
+			for key, value := range props.UserProperties {
+				userProperties[key] = value
+			}
+		}
+	}
+	publish.Properties.User = toUserProperties(userProperties)
+
+	ctx, cancel := operationContext(client)
+	defer cancel()
+
+	response, err := client.Publish(ctx, publish)
+	if err != nil {
+		if response != nil {
+			reason := ""
+			if response.Properties != nil {
+				reason = response.Properties.ReasonString
+			}
+			if reasonErr := reasonCodeError(response.ReasonCode, reason); reasonErr != nil {
+				err = reasonErr
+			}
+		}
+		return fmt.Errorf("failed to publish to topic %s: %w", topic, err)
+	}
+	return nil
+}
+
+// routeV5 将收到的消息分发给订阅时注册的处理函数，没有匹配的订阅时使用默认的处理函数
+// MQTT 5.0连接没有mqtt.Client实例，处理函数收到的client参数为nil
+func (c *Client) routeV5(received paho.PublishReceived) (bool, error) {
+	msg := &message{publish: received.Packet}
+
+	c.mutex.Lock()
+	var handlers []mqtt.MessageHandler
+	for filter, sub := range c.subscriptions {
+		if topicMatches(filter, msg.Topic()) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	c.mutex.Unlock()
+
+	if len(handlers) == 0 && c.onMessage != nil {
+		handlers = append(handlers, c.onMessage)
+	}
+	for _, handler := range handlers {
+		handler(nil, msg)
+	}
+
+	return len(handlers) > 0, nil
+}
+
+// serverDisconnectError 返回服务器主动断开MQTT 5.0连接的原因
+func serverDisconnectError(disconnect *paho.Disconnect) error {
+	reason := ""
+	if disconnect.Properties != nil {
+		reason = disconnect.Properties.ReasonString
+	}
+	err := reasonCodeError(disconnect.ReasonCode, reason)
+	if err == nil {
+		err = fmt.Errorf("MQTT broker closed the connection: reason code 0x%02X %s", disconnect.ReasonCode, reason)
+	}
+	return err
+}
+
+// connackReason 返回CONNACK报文中服务器的原因字符串
+func connackReason(connack *paho.Connack) string {
+	if connack.Properties == nil {
+		return ""
+	}
+	return connack.Properties.ReasonString
+}
+
+// toUserProperties 将用户属性转换为按名称排序的MQTT v5用户属性列表
+func toUserProperties(properties map[string]string) paho.UserProperties {
+	if len(properties) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	user := make(paho.UserProperties, 0, len(keys))
+	for _, key := range keys {
+		user = append(user, paho.UserProperty{Key: key, Value: properties[key]})
+	}
+	return user
+}
+
+// dialBroker 根据服务器地址建立网络连接，支持tcp、mqtt、ssl、tls、mqtts、ws和wss协议
+func dialBroker(ctx context.Context, cfg *config.MQTTConfig, tlsConfig *tls.Config) (net.Conn, error) {
+	u, err := url.Parse(cfg.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker address %s: %w", cfg.Broker, err)
+	}
+
+	secure := false
+	port := "1883"
+	switch strings.ToLower(u.Scheme) {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		secure = true
+		port = "8883"
+	case "ws", "wss":
+		return dialWebSocket(cfg, tlsConfig)
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme: %s", u.Scheme)
+	}
+
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	if !secure {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	dialer := tls.Dialer{Config: tlsConfig}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// payloadBytes 将消息内容转换为字节切片，支持string、[]byte和bytes.Buffer
+func payloadBytes(payload interface{}) ([]byte, error) {
+	switch p := payload.(type) {
+	case string:
+		return []byte(p), nil
+	case []byte:
+		return p, nil
+	case bytes.Buffer:
+		return p.Bytes(), nil
+	case *bytes.Buffer:
+		return p.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported payload type %T", payload)
+	}
+}
+
+// topicMatches 判断主题是否匹配订阅的主题过滤器，支持 "+" 和 "#" 通配符
+func topicMatches(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,75 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fbigun/smartwaker/internal/config"
+)
+
+// isWebSocket 判断服务器地址是否使用ws://或wss://协议
+func isWebSocket(broker string) bool {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "ws" || scheme == "wss"
+}
+
+// websocketURL 返回WebSocket连接地址，配置了path时替换服务器地址中的路径
+func websocketURL(broker string, ws config.WebSocketConfig) (string, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return "", fmt.Errorf("invalid broker address %s: %w", broker, err)
+	}
+	if ws.Path != "" {
+		u.Path = ws.Path
+	}
+	return u.String(), nil
+}
+
+// websocketHeaders 返回WebSocket握手请求附加的HTTP头
+func websocketHeaders(ws config.WebSocketConfig) http.Header {
+	headers := make(http.Header)
+	for name, value := range ws.Headers {
+		headers.Set(name, value)
+	}
+	return headers
+}
+
+// websocketOptions 返回WebSocket连接选项，没有配置代理时使用环境变量中的代理
+func websocketOptions(ws config.WebSocketConfig) (*mqtt.WebsocketOptions, error) {
+	opts := &mqtt.WebsocketOptions{Proxy: http.ProxyFromEnvironment}
+	if ws.Proxy != "" {
+		proxy, err := url.Parse(ws.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid websocket proxy %s: %w", ws.Proxy, err)
+		}
+		opts.Proxy = http.ProxyURL(proxy)
+	}
+	return opts, nil
+}
+
+// dialWebSocket 建立MQTT over WebSocket连接，wss://连接使用tlsConfig
+func dialWebSocket(cfg *config.MQTTConfig, tlsConfig *tls.Config) (net.Conn, error) {
+	address, err := websocketURL(cfg.Broker, cfg.WebSocket)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := websocketOptions(cfg.WebSocket)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := mqtt.NewWebsocket(address, tlsConfig, CONNECT_TIMEOUT, websocketHeaders(cfg.WebSocket), opts)
+	if err != nil {
+		return nil, fmt.Errorf("websocket handshake with %s failed: %w", address, err)
+	}
+	return conn, nil
+}
@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"encoding/hex"
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -33,6 +35,71 @@ func GetLocalIP() (string, error) {
 	return "", fmt.Errorf("no IP address found")
 }
 
+// ParseSecureOnPassword 解析SecureOn密码
+// 支持MAC地址格式（如 "00:11:22:33:44:55"、"11-22-33-44"）和十六进制格式（如 "aabbccdd"）
+// 密码长度必须为4字节或6字节
+func ParseSecureOnPassword(password string) ([]byte, error) {
+	// 移除可能的分隔符
+	cleaned := strings.NewReplacer(":", "", "-", "", ".", "").Replace(password)
+	cleaned = strings.TrimPrefix(strings.TrimPrefix(cleaned, "0x"), "0X")
+
+	data, err := hex.DecodeString(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode password %q: %w", password, err)
+	}
+
+	if len(data) != 4 && len(data) != 6 {
+		return nil, fmt.Errorf("invalid password length: %d bytes, must be 4 or 6", len(data))
+	}
+
+	return data, nil
+}
+
+// BroadcastAddress 计算IPv4网络的定向广播地址
+func BroadcastAddress(network *net.IPNet) (net.IP, error) {
+	ip := network.IP.To4()
+	if ip == nil {
+		return nil, fmt.Errorf("not an IPv4 network: %s", network)
+	}
+
+	mask := network.Mask
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+	if len(mask) != net.IPv4len {
+		return nil, fmt.Errorf("invalid IPv4 mask: %s", network.Mask)
+	}
+
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range ip {
+		broadcast[i] = ip[i] | ^mask[i]
+	}
+
+	return broadcast, nil
+}
+
+// InterfaceIPv4Networks 获取指定网卡的所有IPv4网络
+func InterfaceIPv4Networks(name string) ([]*net.IPNet, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find interface %s: %w", name, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get addresses of interface %s: %w", name, err)
+	}
+
+	var networks []*net.IPNet
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			networks = append(networks, &net.IPNet{IP: ipnet.IP.To4(), Mask: ipnet.Mask})
+		}
+	}
+
+	return networks, nil
+}
+
 // WaitForConnection 等待网络连接可用
 func WaitForConnection(host string, port int, timeout time.Duration) bool {
 	// 计算超时时间
@@ -40,7 +107,7 @@ func WaitForConnection(host string, port int, timeout time.Duration) bool {
 	
 	// 循环尝试连接，直到超时
 	for time.Now().Before(deadline) {
-		conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", host, port), time.Second)
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), time.Second)
 		if err == nil {
 			conn.Close()
 			return true
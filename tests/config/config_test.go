@@ -117,6 +117,311 @@ devices:
     ip: 192.168.1.100
 `
 
+	// 无效的设备检测端口
+	invalidCheckPortConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+    ip: 192.168.1.100
+    verify: true
+    check_port: 70000
+`
+
+	// 无效的SecureOn密码
+	invalidSecureOnConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+    ip: 192.168.1.100
+    secureon: "11:22:33"
+`
+
+	// 以太网帧方式但未指定网卡
+	ethernetWithoutInterfaceConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+    transport: ethernet
+`
+
+	// 无效的全局唤醒端口
+	invalidWakePortsConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+wake:
+  repeat: 3
+  repeat_interval: 100
+  ports: [7, 0]
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+`
+
+	// HTTP唤醒方式但未指定URL
+	httpWakerWithoutURLConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    waker: http
+    http:
+      method: POST
+`
+
+	// 设备组引用了不存在的设备
+	unknownGroupMemberConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+groups:
+  backup: [test-device, missing-device]
+`
+
+	// 设备之间存在循环依赖
+	dependencyCycleConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: nas
+    mac: 00:11:22:33:44:55
+    depends_on: [storage]
+  - name: storage
+    mac: 00:11:22:33:44:66
+    depends_on: [nas]
+`
+
+	// 定时任务的cron表达式无效
+	invalidScheduleCronConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+schedules:
+  - name: nightly
+    cron: "0 25 * * *"
+    action: wake
+    target: test-device
+`
+
+	// 定时任务的动作无效
+	invalidScheduleActionConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+schedules:
+  - name: nightly
+    cron: "0 1 * * *"
+    action: reboot
+    target: test-device
+`
+
+	// 无效的Ping次数
+	invalidPingCountConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+    ping:
+      count: -1
+`
+
+	// TCP健康检查未指定端口
+	tcpCheckWithoutPortConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+    ip: 192.168.1.100
+    checks:
+      - type: icmp
+      - type: tcp
+`
+
+	// 无效的监控间隔
+	invalidMonitorIntervalConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+monitor:
+  enabled: true
+  interval: -1
+`
+
+	// 无效的租约文件格式
+	invalidLeasesFormatConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+resolve:
+  leases: /var/lib/misc/dnsmasq.leases
+  leases_format: kea
+`
+
+	// 设备发现的子网过大
+	largeDiscoverSubnetConfig := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+discover:
+  subnets: ["10.0.0.0/8"]
+`
+
+	// MQTT v5专用配置用于v3.1.1连接
+	mqtt5OptionsOnV4Config := `
+mode: controller
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+  session_expiry: 300
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+`
+
+	// WebSocket路径不以 "/" 开头
+	invalidWebSocketPathConfig := `
+mode: controller
+mqtt:
+  broker: wss://bemfa.com:9504
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+  websocket:
+    path: wss
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+`
+
+	// 按优先级配置多个服务器，备用服务器使用单独的认证和TLS配置
+	multipleBrokersConfig := `
+mode: controller
+mqtt:
+  brokers:
+    - url: tcp://broker1.example.com:1883
+    - url: ssl://broker2.example.com:8883
+      auth:
+        enabled: true
+        username: backup
+        password: secret
+      tls:
+        enabled: true
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+  failback_interval: 30
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+`
+
+	// 服务器列表中的地址为空
+	emptyBrokerURLConfig := `
+mode: controller
+mqtt:
+  brokers:
+    - url: tcp://broker1.example.com:1883
+    - auth:
+        enabled: true
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+devices:
+  - name: test-device
+    mac: 00:11:22:33:44:55
+`
+
+	// 消息队列的丢弃策略无效
+	invalidQueueConfig := `
+mode: controlled
+mqtt:
+  broker: tcp://test.mosquitto.org:1883
+  client_id: smartwaker-test
+  topic: smartwaker/test
+  version: 4
+  queue:
+    enabled: true
+    dir: /var/lib/smartwaker/queue
+    drop_policy: random
+`
+
 	tests := []struct {
 		name        string
 		configData  string
@@ -163,6 +468,119 @@ devices:
 			expectError: true,
 			errorMsg:    "invalid configuration: invalid QoS level: 3, must be 0, 1, or 2",
 		},
+		{
+			name:        "无效的设备检测端口",
+			configData:  invalidCheckPortConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid device \"test-device\": invalid check port",
+		},
+		{
+			name:        "无效的SecureOn密码",
+			configData:  invalidSecureOnConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid device \"test-device\": invalid secureon",
+		},
+		{
+			name:        "以太网帧方式未指定网卡",
+			configData:  ethernetWithoutInterfaceConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid device \"test-device\": interface is required for ethernet transport",
+		},
+		{
+			name:        "无效的全局唤醒端口",
+			configData:  invalidWakePortsConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid wake configuration: invalid port: 0",
+		},
+		{
+			name:        "HTTP唤醒方式未指定URL",
+			configData:  httpWakerWithoutURLConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid device \"test-device\": url is required for http waker",
+		},
+		{
+			name:        "设备组引用了不存在的设备",
+			configData:  unknownGroupMemberConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: group backup references unknown device: missing-device",
+		},
+		{
+			name:        "设备之间存在循环依赖",
+			configData:  dependencyCycleConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: dependency cycle detected: nas -> storage -> nas",
+		},
+		{
+			name:        "定时任务的cron表达式无效",
+			configData:  invalidScheduleCronConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid schedule \"nightly\": invalid cron expression",
+		},
+		{
+			name:        "定时任务的动作无效",
+			configData:  invalidScheduleActionConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid schedule \"nightly\": invalid action: reboot",
+		},
+		{
+			name:        "无效的Ping次数",
+			configData:  invalidPingCountConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid device \"test-device\": invalid ping count: -1",
+		},
+		{
+			name:        "TCP健康检查未指定端口",
+			configData:  tcpCheckWithoutPortConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid device \"test-device\": invalid check 2: port is required for tcp check",
+		},
+		{
+			name:        "无效的监控间隔",
+			configData:  invalidMonitorIntervalConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid monitor configuration: invalid interval: -1",
+		},
+		{
+			name:        "无效的租约文件格式",
+			configData:  invalidLeasesFormatConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid resolve configuration: invalid leases format: kea, must be 'dnsmasq' or 'isc'",
+		},
+		{
+			name:        "设备发现的子网过大",
+			configData:  largeDiscoverSubnetConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid discover configuration: subnet 10.0.0.0/8 is too large to scan, prefix must be at least /20",
+		},
+		{
+			name:        "MQTT v5专用配置用于v3.1.1连接",
+			configData:  mqtt5OptionsOnV4Config,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid mqtt configuration: session_expiry, message_expiry, user_properties and auth.enhanced require version 5",
+		},
+		{
+			name:        "WebSocket路径无效",
+			configData:  invalidWebSocketPathConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid mqtt configuration: websocket path must start with '/': wss",
+		},
+		{
+			name:        "多个MQTT服务器",
+			configData:  multipleBrokersConfig,
+			expectError: false,
+		},
+		{
+			name:        "MQTT服务器地址为空",
+			configData:  emptyBrokerURLConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid mqtt configuration: brokers[1].url cannot be empty",
+		},
+		{
+			name:        "消息队列丢弃策略无效",
+			configData:  invalidQueueConfig,
+			expectError: true,
+			errorMsg:    "invalid configuration: invalid mqtt configuration: invalid queue drop policy: random",
+		},
 	}
 
 	for _, tc := range tests {
@@ -191,6 +609,31 @@ devices:
 	}
 }
 
+// TestBrokerList 测试按优先级返回MQTT服务器列表
+func TestBrokerList(t *testing.T) {
+	cfg := config.MQTTConfig{Broker: "tcp://broker.example.com:1883"}
+	assert.Equal(t, []config.BrokerConfig{{URL: "tcp://broker.example.com:1883"}}, cfg.BrokerList(), "没有配置brokers时应该使用broker")
+
+	cfg.Brokers = []config.BrokerConfig{{URL: "tcp://broker1.example.com:1883"}, {URL: "tcp://broker2.example.com:1883"}}
+	assert.Equal(t, cfg.Brokers, cfg.BrokerList(), "配置brokers后应该忽略broker")
+}
+
+// TestAvailabilityTopic 测试根据程序模式生成可用性主题
+func TestAvailabilityTopic(t *testing.T) {
+	cfg := &config.Config{
+		Mode:       "controller",
+		MQTT:       config.MQTTConfig{Topic: "nas/wake"},
+		Controlled: config.ControlledConfig{StatusTopic: "nas/status"},
+	}
+	assert.Equal(t, "nas/wake/availability", cfg.AvailabilityTopic(), "控制端应该使用控制主题下的可用性主题")
+
+	cfg.Mode = "controlled"
+	assert.Equal(t, "nas/status/availability", cfg.AvailabilityTopic(), "被控端应该使用状态主题下的可用性主题")
+
+	cfg.MQTT.Availability.Topic = "nas/online"
+	assert.Equal(t, "nas/online", cfg.AvailabilityTopic(), "应该优先使用配置的可用性主题")
+}
+
 // TestLoadNonExistentConfig 测试加载不存在的配置文件
 func TestLoadNonExistentConfig(t *testing.T) {
 	_, err := config.LoadConfig("non_existent_config.yml")
@@ -0,0 +1,149 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newGroupsConfig 创建包含设备组和标签的测试配置
+func newGroupsConfig() *config.Config {
+	return &config.Config{
+		Mode: "controller",
+		Devices: []config.DeviceConfig{
+			{Name: "NAS1", MAC: "00:11:22:33:44:01", Tags: []string{"storage"}},
+			{Name: "NAS2", MAC: "00:11:22:33:44:02", Tags: []string{"storage", "backup"}},
+			{Name: "Backup1", MAC: "00:11:22:33:44:03"},
+			{Name: "Desktop", MAC: "00:11:22:33:44:04"},
+		},
+		Groups: map[string][]string{
+			"backup": {"Backup1", "NAS1"},
+		},
+	}
+}
+
+// deviceNames 提取设备名称列表
+func deviceNames(devices []*config.DeviceConfig) []string {
+	names := make([]string, 0, len(devices))
+	for _, device := range devices {
+		names = append(names, device.Name)
+	}
+	return names
+}
+
+// TestResolveDevices 测试目标解析功能
+func TestResolveDevices(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		expected    []string
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name:     "单个设备",
+			target:   "NAS2",
+			expected: []string{"NAS2"},
+		},
+		{
+			name:     "所有设备",
+			target:   "*",
+			expected: []string{"NAS1", "NAS2", "Backup1", "Desktop"},
+		},
+		{
+			name:     "设备组与同名标签合并去重",
+			target:   "@backup",
+			expected: []string{"Backup1", "NAS1", "NAS2"},
+		},
+		{
+			name:     "仅标签",
+			target:   "@storage",
+			expected: []string{"NAS1", "NAS2"},
+		},
+		{
+			name:        "不存在的设备",
+			target:      "NAS9",
+			expectError: true,
+			errorMsg:    "device not found: NAS9",
+		},
+		{
+			name:        "不存在的组",
+			target:      "@media",
+			expectError: true,
+			errorMsg:    "no devices in group or tag: media",
+		},
+	}
+
+	cfg := newGroupsConfig()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			devices, err := cfg.ResolveDevices(tc.target)
+			if tc.expectError {
+				assert.Error(t, err, "应该返回错误")
+				assert.Contains(t, err.Error(), tc.errorMsg, "错误消息不匹配")
+				return
+			}
+
+			assert.NoError(t, err, "不应该返回错误")
+			assert.Equal(t, tc.expected, deviceNames(devices), "解析结果不匹配")
+		})
+	}
+}
+
+// TestResolveDevicesReturnsConfigEntries 测试解析结果指向配置中的设备
+func TestResolveDevicesReturnsConfigEntries(t *testing.T) {
+	cfg := newGroupsConfig()
+
+	devices, err := cfg.ResolveDevices("NAS1")
+	assert.NoError(t, err, "不应该返回错误")
+	assert.Same(t, &cfg.Devices[0], devices[0], "应该返回配置中的设备")
+	assert.Same(t, &cfg.Devices[0], cfg.FindDevice("NAS1"), "应该返回配置中的设备")
+	assert.Nil(t, cfg.FindDevice("NAS9"), "不存在的设备应该返回nil")
+}
+
+// TestIsMultiTarget 测试多设备目标判断
+func TestIsMultiTarget(t *testing.T) {
+	assert.True(t, config.IsMultiTarget("*"), "*应该是多设备目标")
+	assert.True(t, config.IsMultiTarget("@backup"), "@组名应该是多设备目标")
+	assert.False(t, config.IsMultiTarget("NAS1"), "设备名称不应该是多设备目标")
+}
+
+// TestWakeOrder 测试依赖设备的唤醒顺序
+func TestWakeOrder(t *testing.T) {
+	cfg := &config.Config{
+		Mode: "controller",
+		Devices: []config.DeviceConfig{
+			{Name: "NAS", DependsOn: []string{"Storage", "Switch"}},
+			{Name: "Storage", DependsOn: []string{"Switch"}},
+			{Name: "Switch"},
+			{Name: "Desktop"},
+		},
+	}
+
+	t.Run("多级依赖", func(t *testing.T) {
+		order, err := cfg.WakeOrder("NAS")
+		assert.NoError(t, err, "不应该返回错误")
+		assert.Equal(t, []string{"Switch", "Storage", "NAS"}, deviceNames(order), "唤醒顺序不匹配")
+	})
+
+	t.Run("没有依赖", func(t *testing.T) {
+		order, err := cfg.WakeOrder("Desktop")
+		assert.NoError(t, err, "不应该返回错误")
+		assert.Equal(t, []string{"Desktop"}, deviceNames(order), "唤醒顺序不匹配")
+	})
+
+	t.Run("循环依赖", func(t *testing.T) {
+		cyclic := &config.Config{
+			Devices: []config.DeviceConfig{
+				{Name: "A", DependsOn: []string{"B"}},
+				{Name: "B", DependsOn: []string{"C"}},
+				{Name: "C", DependsOn: []string{"A"}},
+			},
+		}
+
+		_, err := cyclic.WakeOrder("A")
+		assert.Error(t, err, "应该返回错误")
+		assert.Contains(t, err.Error(), "dependency cycle detected: A -> B -> C -> A", "错误消息不匹配")
+	})
+}
@@ -0,0 +1,47 @@
+package controller_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseNeighborTable 测试解析邻居表
+func TestParseNeighborTable(t *testing.T) {
+	table := `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.100    0x1         0x2         00:11:22:33:44:55     *        eth0
+192.168.1.101    0x1         0x0         00:00:00:00:00:00     *        eth0
+10.0.0.5         0x1         0x6         aa:bb:cc:dd:ee:ff     *        wlan0
+invalid line
+`
+
+	entries, err := controller.ParseNeighborTable(strings.NewReader(table))
+	assert.NoError(t, err, "解析邻居表不应该返回错误")
+	assert.Len(t, entries, 3, "应该解析出3个条目")
+
+	assert.Equal(t, "192.168.1.100", entries[0].IP.String(), "IP地址应该正确")
+	assert.Equal(t, "00:11:22:33:44:55", entries[0].MAC.String(), "MAC地址应该正确")
+	assert.Equal(t, "eth0", entries[0].Interface, "网卡名称应该正确")
+	assert.True(t, entries[0].Complete, "已解析的条目应该标记为完成")
+
+	assert.False(t, entries[1].Complete, "未完成解析的条目不应该标记为完成")
+
+	assert.Equal(t, "wlan0", entries[2].Interface, "网卡名称应该正确")
+	assert.True(t, entries[2].Complete, "带有其他标志的已解析条目应该标记为完成")
+}
+
+// TestARPPing 测试ARP探测
+func TestARPPing(t *testing.T) {
+	t.Run("无效的IPv4地址", func(t *testing.T) {
+		_, _, err := controller.ARPPing("not-an-ip", "", time.Second)
+		assert.Error(t, err, "无效的地址应该返回错误")
+	})
+
+	t.Run("不在本地网段的地址", func(t *testing.T) {
+		_, _, err := controller.ARPPing("198.51.100.1", "", time.Second)
+		assert.Error(t, err, "不在本地网段的地址应该返回错误")
+	})
+}
@@ -0,0 +1,239 @@
+package controller_test
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	"github.com/fbigun/smartwaker/internal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRunCheck 测试执行单个健康检查
+func TestRunCheck(t *testing.T) {
+	// 模拟HTTP服务
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"status":"healthy"}`)
+	}))
+	defer httpServer.Close()
+
+	// 模拟HTTPS服务
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	tlsURL, _ := url.Parse(tlsServer.URL)
+	tlsPort, _ := strconv.Atoi(tlsURL.Port())
+
+	// 模拟SSH服务，连接后发送版本标识
+	sshListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "创建监听器失败")
+	defer sshListener.Close()
+	go func() {
+		for {
+			conn, err := sshListener.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprint(conn, "SSH-2.0-OpenSSH_9.6\r\n")
+			conn.Close()
+		}
+	}()
+	sshPort := sshListener.Addr().(*net.TCPAddr).Port
+
+	// 获取一个已关闭的端口
+	closedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "创建监听器失败")
+	closedPort := closedListener.Addr().(*net.TCPAddr).Port
+	closedListener.Close()
+
+	device := &config.DeviceConfig{Name: "NAS1", IP: "127.0.0.1"}
+
+	tests := []struct {
+		name         string
+		check        config.CheckConfig
+		expectPassed bool
+		expectName   string
+		expectMsg    string
+	}{
+		{
+			name:         "TCP端口开放",
+			check:        config.CheckConfig{Type: "tcp", Port: sshPort},
+			expectPassed: true,
+			expectName:   fmt.Sprintf("tcp:%d", sshPort),
+			expectMsg:    "open",
+		},
+		{
+			name:         "TCP端口关闭",
+			check:        config.CheckConfig{Type: "tcp", Port: closedPort, Timeout: 1},
+			expectPassed: false,
+			expectName:   fmt.Sprintf("tcp:%d", closedPort),
+			expectMsg:    "failed to connect",
+		},
+		{
+			name:         "HTTP响应包含指定内容",
+			check:        config.CheckConfig{Type: "http", Name: "api", URL: httpServer.URL, Status: 200, Contains: "healthy"},
+			expectPassed: true,
+			expectName:   "api",
+			expectMsg:    "status 200",
+		},
+		{
+			name:         "HTTP响应不包含指定内容",
+			check:        config.CheckConfig{Type: "http", URL: httpServer.URL, Contains: "degraded"},
+			expectPassed: false,
+			expectName:   "http",
+			expectMsg:    "does not contain",
+		},
+		{
+			name:         "HTTP状态码不匹配",
+			check:        config.CheckConfig{Type: "http", URL: httpServer.URL + "/fail"},
+			expectPassed: false,
+			expectName:   "http",
+			expectMsg:    "unexpected HTTP status 503",
+		},
+		{
+			name:         "TLS证书有效",
+			check:        config.CheckConfig{Type: "tls", Port: tlsPort, InsecureSkipVerify: true},
+			expectPassed: true,
+			expectName:   fmt.Sprintf("tls:%d", tlsPort),
+			expectMsg:    "certificate valid until",
+		},
+		{
+			name:         "TLS证书即将过期",
+			check:        config.CheckConfig{Type: "tls", Port: tlsPort, InsecureSkipVerify: true, ExpiryDays: 1000000},
+			expectPassed: false,
+			expectName:   fmt.Sprintf("tls:%d", tlsPort),
+			expectMsg:    "certificate expires in",
+		},
+		{
+			name:         "TLS证书不受信任",
+			check:        config.CheckConfig{Type: "tls", Port: tlsPort},
+			expectPassed: false,
+			expectName:   fmt.Sprintf("tls:%d", tlsPort),
+			expectMsg:    "TLS handshake failed",
+		},
+		{
+			name:         "SSH返回版本标识",
+			check:        config.CheckConfig{Type: "ssh", Port: sshPort},
+			expectPassed: true,
+			expectName:   fmt.Sprintf("ssh:%d", sshPort),
+			expectMsg:    "SSH-2.0-OpenSSH_9.6",
+		},
+		{
+			name:         "非SSH服务",
+			check:        config.CheckConfig{Type: "ssh", Host: httpServer.Listener.Addr().(*net.TCPAddr).IP.String(), Port: httpServer.Listener.Addr().(*net.TCPAddr).Port, Timeout: 1},
+			expectPassed: false,
+			expectName:   fmt.Sprintf("ssh:%d", httpServer.Listener.Addr().(*net.TCPAddr).Port),
+			expectMsg:    "no SSH banner received",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := controller.RunCheck(context.Background(), device, &tc.check)
+
+			assert.Equal(t, tc.expectPassed, result.Passed, "检查结果不匹配: %s", result.Message)
+			assert.Equal(t, tc.expectName, result.Name, "检查名称不匹配")
+			assert.Contains(t, result.Message, tc.expectMsg, "结果描述不匹配")
+		})
+	}
+}
+
+// TestRunChecks 测试按顺序返回所有健康检查的结果
+func TestRunChecks(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "创建监听器失败")
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	device := &config.DeviceConfig{
+		Name: "NAS1",
+		IP:   "127.0.0.1",
+		Checks: []config.CheckConfig{
+			{Type: "tcp", Name: "smb", Port: port},
+			{Type: "http", Name: "web", URL: "http://127.0.0.1:1/", Timeout: 1},
+		},
+	}
+
+	results := controller.RunChecks(context.Background(), device)
+
+	assert.Len(t, results, 2, "应该返回所有检查的结果")
+	assert.Equal(t, "smb", results[0].Name, "结果顺序应与配置一致")
+	assert.True(t, results[0].Passed, "TCP检查应该通过")
+	assert.Equal(t, "web", results[1].Name, "结果顺序应与配置一致")
+	assert.False(t, results[1].Passed, "HTTP检查应该失败")
+}
+
+// TestRunCheckCanceled 测试上下文取消后ICMP检查立即失败
+func TestRunCheckCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	device := &config.DeviceConfig{Name: "NAS1", IP: "127.0.0.1"}
+	result := controller.RunCheck(ctx, device, &config.CheckConfig{Type: "icmp"})
+
+	assert.False(t, result.Passed, "上下文取消后检查应该失败")
+	assert.Contains(t, result.Message, context.Canceled.Error(), "结果描述不匹配")
+}
+
+// TestRunCheckTLSServerName 测试TLS检查使用的服务器名称
+func TestRunCheckTLSServerName(t *testing.T) {
+	serverNames := make(chan string, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverNames <- hello.ServerName
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name     string
+		device   config.DeviceConfig
+		check    config.CheckConfig
+		expected string
+	}{
+		{
+			name:     "使用配置的server_name",
+			device:   config.DeviceConfig{Name: "NAS1", IP: "127.0.0.1", Hostname: "nas.lan"},
+			check:    config.CheckConfig{Type: "tls", Port: port, ServerName: "example.com"},
+			expected: "example.com",
+		},
+		{
+			name:     "默认使用设备的hostname",
+			device:   config.DeviceConfig{Name: "NAS1", IP: "127.0.0.1", Hostname: "nas.lan"},
+			check:    config.CheckConfig{Type: "tls", Port: port, InsecureSkipVerify: true},
+			expected: "nas.lan",
+		},
+		{
+			name:     "只有IP时不发送SNI",
+			device:   config.DeviceConfig{Name: "NAS1", IP: "127.0.0.1"},
+			check:    config.CheckConfig{Type: "tls", Port: port, InsecureSkipVerify: true},
+			expected: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			controller.RunCheck(context.Background(), &tc.device, &tc.check)
+			select {
+			case serverName := <-serverNames:
+				assert.Equal(t, tc.expected, serverName, "服务器名称不匹配")
+			default:
+				t.Fatal("TLS服务没有收到握手请求")
+			}
+		})
+	}
+}
@@ -1,11 +1,20 @@
 package controller_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/fbigun/smartwaker/internal/config"
 	"github.com/fbigun/smartwaker/internal/controller"
+	mqttClient "github.com/fbigun/smartwaker/internal/mqtt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -30,6 +39,11 @@ func (m *MockMQTTClient) Publish(topic string, qos byte, retained bool, payload
 	return args.Error(0)
 }
 
+func (m *MockMQTTClient) PublishWithProperties(topic string, qos byte, retained bool, payload interface{}, props *mqttClient.Properties) error {
+	args := m.Called(topic, qos, retained, payload, props)
+	return args.Error(0)
+}
+
 func (m *MockMQTTClient) Disconnect() {
 	m.Called()
 }
@@ -39,11 +53,26 @@ func (m *MockMQTTClient) IsConnected() bool {
 	return args.Bool(0)
 }
 
+func (m *MockMQTTClient) BrokerStatus() mqttClient.BrokerStatus {
+	args := m.Called()
+	return args.Get(0).(mqttClient.BrokerStatus)
+}
+
 // 创建MQTT消息的模拟
 type MockMQTTMessage struct {
 	mock.Mock
 }
 
+// 创建带有MQTT v5属性的消息的模拟
+type MockMQTT5Message struct {
+	MockMQTTMessage
+	properties *mqttClient.Properties
+}
+
+func (m *MockMQTT5Message) Properties() *mqttClient.Properties {
+	return m.properties
+}
+
 func (m *MockMQTTMessage) Duplicate() bool {
 	args := m.Called()
 	return args.Bool(0)
@@ -78,6 +107,41 @@ func (m *MockMQTTMessage) Ack() {
 	m.Called()
 }
 
+// newTestController 创建使用模拟MQTT客户端的控制器，发布到响应主题的消息写入返回的通道
+func newTestController(cfg *config.Config) (*controller.Controller, chan string) {
+	responses := make(chan string, 16)
+
+	mockClient := new(MockMQTTClient)
+	mockClient.On("IsConnected").Return(true)
+	mockClient.On("Publish", cfg.MQTT.Topic+"/response", mock.Anything, false, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		responses <- args.Get(3).(string)
+	})
+
+	return controller.NewController(cfg, mockClient), responses
+}
+
+// sendCommand 向控制器发送命令消息
+func sendCommand(ctrl *controller.Controller, topic, payload string) {
+	msg := new(MockMQTTMessage)
+	msg.On("Topic").Return(topic)
+	msg.On("Payload").Return([]byte(payload))
+	msg.On("Ack").Return()
+	ctrl.HandleMessage(nil, msg)
+}
+
+// receiveResponse 等待控制器发布的下一条响应
+func receiveResponse(t *testing.T, responses chan string) string {
+	t.Helper()
+
+	select {
+	case response := <-responses:
+		return response
+	case <-time.After(10 * time.Second):
+		t.Fatal("没有收到响应")
+		return ""
+	}
+}
+
 // TestControllerStart 测试控制器启动功能
 func TestControllerStart(t *testing.T) {
 	// 创建测试配置
@@ -114,15 +178,7 @@ func TestControllerStart(t *testing.T) {
 }
 
 // TestHandleMessage 测试消息处理功能
-// 注意：这个测试依赖于controller包的内部实现，可能需要调整
 func TestHandleMessage(t *testing.T) {
-	// 由于handleMessage是内部方法，我们不能直接测试
-	// 在实际项目中，应该重构代码以便于测试，例如使用依赖注入
-	// 这里提供一个示例框架，实际测试需要根据代码结构调整
-	
-	t.Skip("需要重构控制器代码以支持测试消息处理功能")
-	
-	/*
 	// 创建测试配置
 	cfg := &config.Config{
 		Mode: "controller",
@@ -141,30 +197,312 @@ func TestHandleMessage(t *testing.T) {
 			},
 		},
 	}
-	
-	// 创建模拟的MQTT客户端
-	mockClient := new(MockMQTTClient)
-	mockClient.On("IsConnected").Return(true)
-	mockClient.On("Publish", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
-	
-	// 创建模拟的MQTT消息
-	mockMsg := new(MockMQTTMessage)
-	mockMsg.On("Topic").Return("test/topic")
-	mockMsg.On("Payload").Return([]byte("wake:test-device"))
-	mockMsg.On("Ack").Return()
-	
-	// 创建控制器实例
-	// 注意：这需要控制器代码支持依赖注入
-	ctrl := controller.NewController(cfg, mockClient)
-	
-	// 调用消息处理函数
-	ctrl.HandleMessage(nil, mockMsg)
-	
-	// 验证预期的行为
-	mockClient.AssertCalled(t, "IsConnected")
-	mockClient.AssertCalled(t, "Publish", "test/topic/response", byte(1), false, mock.Anything)
-	mockMsg.AssertCalled(t, "Ack")
-	*/
+
+	// 发送命令并等待响应
+	send := func(t *testing.T, payload string) string {
+		responses := make(chan string, 1)
+
+		// 创建模拟的MQTT客户端
+		mockClient := new(MockMQTTClient)
+		mockClient.On("IsConnected").Return(true)
+		mockClient.On("BrokerStatus").Return(mqttClient.BrokerStatus{
+			Brokers:   []string{"tcp://primary:1883", "tcp://backup:1883"},
+			Active:    "tcp://backup:1883",
+			Connected: true,
+		})
+		mockClient.On("Publish", "test/topic/response", byte(1), false, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			responses <- args.Get(3).(string)
+		})
+
+		// 创建模拟的MQTT消息
+		mockMsg := new(MockMQTTMessage)
+		mockMsg.On("Topic").Return("test/topic")
+		mockMsg.On("Payload").Return([]byte(payload))
+		mockMsg.On("Ack").Return()
+
+		ctrl := controller.NewController(cfg, mockClient)
+		ctrl.HandleMessage(nil, mockMsg)
+		mockMsg.AssertCalled(t, "Ack")
+
+		select {
+		case response := <-responses:
+			return response
+		case <-time.After(5 * time.Second):
+			t.Fatal("没有收到响应")
+			return ""
+		}
+	}
+
+	// 解析JSON响应
+	decode := func(t *testing.T, payload string) controller.Response {
+		var response controller.Response
+		assert.NoError(t, json.Unmarshal([]byte(payload), &response), "响应应该是有效的JSON")
+		return response
+	}
+
+	t.Run("字符串命令返回文本响应", func(t *testing.T) {
+		response := send(t, "state:test-device")
+		assert.True(t, strings.HasPrefix(response, "Device test-device is unknown"), "应该返回设备状态文本")
+	})
+
+	t.Run("JSON命令返回请求ID和结构化结果", func(t *testing.T) {
+		response := decode(t, send(t, `{"id":"req-1","action":"state","target":"test-device"}`))
+		assert.Equal(t, "req-1", response.ID, "应该返回请求ID")
+		assert.Equal(t, "state", response.Action, "应该返回动作")
+		assert.Equal(t, "test-device", response.Target, "应该返回目标")
+		assert.Equal(t, controller.STATUS_OK, response.Status, "状态码应该是200")
+		assert.Contains(t, response.Message, "Device test-device is unknown", "应该包含状态描述")
+		assert.Equal(t, "unknown", response.Data.(map[string]interface{})["state"], "结构化结果应该包含状态")
+	})
+
+	t.Run("JSON命令列出设备", func(t *testing.T) {
+		response := decode(t, send(t, `{"id":"req-2","action":"list"}`))
+		assert.Equal(t, controller.STATUS_OK, response.Status, "状态码应该是200")
+		devices := response.Data.([]interface{})
+		assert.Len(t, devices, 1, "应该返回所有设备")
+		assert.Equal(t, "test-device", devices[0].(map[string]interface{})["name"], "应该返回设备名称")
+	})
+
+	t.Run("查询当前连接的服务器", func(t *testing.T) {
+		response := send(t, "broker")
+		assert.True(t, strings.HasPrefix(response, "Connected to MQTT broker tcp://backup:1883 (fallback)"), "应该返回当前连接的备用服务器")
+		assert.Contains(t, response, "[1] tcp://primary:1883", "应该列出首选服务器")
+
+		data := decode(t, send(t, `{"id":"req-5","action":"broker"}`)).Data.(map[string]interface{})
+		assert.Equal(t, "tcp://backup:1883", data["active"], "结构化结果应该包含当前连接的服务器")
+		assert.Equal(t, false, data["preferred"], "当前连接的不是首选服务器")
+		assert.Len(t, data["brokers"], 2, "结构化结果应该包含所有服务器")
+	})
+
+	t.Run("设备不存在", func(t *testing.T) {
+		response := decode(t, send(t, `{"id":"req-3","action":"ping","target":"missing"}`))
+		assert.Equal(t, "req-3", response.ID, "应该返回请求ID")
+		assert.Equal(t, controller.STATUS_NOT_FOUND, response.Status, "状态码应该是404")
+	})
+
+	t.Run("无效的JSON命令", func(t *testing.T) {
+		response := decode(t, send(t, `{"id":"req-4","action":"reboot","target":"test-device"}`))
+		assert.Equal(t, "req-4", response.ID, "应该返回请求ID")
+		assert.Equal(t, controller.STATUS_BAD_REQUEST, response.Status, "状态码应该是400")
+	})
+
+	t.Run("对多个设备执行时返回汇总结果", func(t *testing.T) {
+		// 模拟HTTP唤醒接口，名称以fail开头的设备唤醒失败
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/fail") {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+		defer server.Close()
+
+		device := func(name string, tags ...string) config.DeviceConfig {
+			return config.DeviceConfig{Name: name, Tags: tags, Waker: controller.WAKER_HTTP, HTTP: config.HTTPWakerConfig{URL: server.URL + "/" + name}}
+		}
+		groupCfg := &config.Config{
+			Mode: "controller",
+			MQTT: cfg.MQTT,
+			Devices: []config.DeviceConfig{
+				device("nas1", "backup"),
+				device("nas2", "backup"),
+				device("fail1", "broken"),
+				device("fail2", "broken"),
+			},
+		}
+
+		tests := []struct {
+			name           string
+			target         string
+			expectedStatus int
+			expectedText   string
+		}{
+			{name: "全部成功", target: "@backup", expectedStatus: controller.STATUS_OK, expectedText: "wake @backup: 2/2 succeeded"},
+			{name: "部分成功", target: "*", expectedStatus: controller.STATUS_PARTIAL, expectedText: "wake *: 2/4 succeeded"},
+			{name: "全部失败", target: "@broken", expectedStatus: controller.STATUS_FAILED, expectedText: "wake @broken: 0/2 succeeded"},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				ctrl, responses := newTestController(groupCfg)
+				sendCommand(ctrl, "test/topic", fmt.Sprintf(`{"id":"group-1","action":"wake","target":%q}`, tc.target))
+
+				response := decode(t, receiveResponse(t, responses))
+				assert.Equal(t, tc.expectedStatus, response.Status, "状态码不匹配")
+				assert.True(t, strings.HasPrefix(response.Message, tc.expectedText), "汇总结果不匹配: %s", response.Message)
+
+				summary := response.Data.(map[string]interface{})
+				results := summary["results"].([]interface{})
+				assert.Len(t, results, int(summary["total"].(float64)), "应该返回每个设备的结果")
+				for _, result := range results {
+					result := result.(map[string]interface{})
+					assert.Equal(t, !strings.HasPrefix(result["device"].(string), "fail"), result["ok"], "设备%s的结果不匹配", result["device"])
+				}
+			})
+		}
+
+		// 字符串命令返回文本格式的汇总结果
+		ctrl, responses := newTestController(groupCfg)
+		sendCommand(ctrl, "test/topic", "wake:*")
+		response := receiveResponse(t, responses)
+		assert.True(t, strings.HasPrefix(response, "wake *: 2/4 succeeded"), "汇总结果不匹配: %s", response)
+		assert.Contains(t, response, "[OK] nas1: ", "应该列出成功的设备")
+		assert.Contains(t, response, "[FAILED] fail1: ", "应该列出失败的设备")
+	})
+
+	t.Run("MQTT v5请求发布到响应主题", func(t *testing.T) {
+		responses := make(chan *mqttClient.Properties, 1)
+
+		mockClient := new(MockMQTTClient)
+		mockClient.On("IsConnected").Return(true)
+		mockClient.On("PublishWithProperties", "clients/app-1/reply", byte(1), false, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			responses <- args.Get(4).(*mqttClient.Properties)
+		})
+
+		mockMsg := &MockMQTT5Message{properties: &mqttClient.Properties{
+			ResponseTopic:   "clients/app-1/reply",
+			CorrelationData: []byte("corr-1"),
+		}}
+		mockMsg.On("Topic").Return("test/topic")
+		mockMsg.On("Payload").Return([]byte("state:test-device"))
+		mockMsg.On("Ack").Return()
+
+		ctrl := controller.NewController(cfg, mockClient)
+		ctrl.HandleMessage(nil, mockMsg)
+
+		select {
+		case props := <-responses:
+			assert.Equal(t, []byte("corr-1"), props.CorrelationData, "响应应该附带请求的关联数据")
+		case <-time.After(5 * time.Second):
+			t.Fatal("没有收到响应")
+		}
+		mockClient.AssertNotCalled(t, "Publish", "test/topic/response", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+// TestWakeDependencies 测试按依赖顺序唤醒设备
+func TestWakeDependencies(t *testing.T) {
+	// freePort 返回一个当前未被占用的端口
+	freePort := func(t *testing.T) int {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err, "创建监听器失败")
+		defer listener.Close()
+		return listener.Addr().(*net.TCPAddr).Port
+	}
+
+	// wake 唤醒依赖router的nas（router依赖switch），返回最终结果和按顺序被唤醒的设备
+	// 模拟的HTTP唤醒接口唤醒设备后在设备的check_port上监听，模拟设备上线；failing设备唤醒失败
+	wake := func(t *testing.T, failing string) (controller.Response, []string) {
+		ports := map[string]int{"switch": freePort(t), "router": freePort(t)}
+		var mutex sync.Mutex
+		var woken []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := strings.TrimPrefix(r.URL.Path, "/")
+			mutex.Lock()
+			woken = append(woken, name)
+			mutex.Unlock()
+
+			if name == failing {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if port, ok := ports[name]; ok {
+				listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				t.Cleanup(func() { listener.Close() })
+			}
+		}))
+		defer server.Close()
+
+		device := func(name string, dependsOn ...string) config.DeviceConfig {
+			return config.DeviceConfig{
+				Name:        name,
+				IP:          "127.0.0.1",
+				CheckPort:   ports[name],
+				DependsOn:   dependsOn,
+				BootTimeout: 5,
+				Waker:       controller.WAKER_HTTP,
+				HTTP:        config.HTTPWakerConfig{URL: server.URL + "/" + name},
+			}
+		}
+		cfg := &config.Config{
+			Mode: "controller",
+			MQTT: config.MQTTConfig{Topic: "test/topic", QoS: 1},
+			Devices: []config.DeviceConfig{
+				device("nas", "router"),
+				device("router", "switch"),
+				device("switch"),
+			},
+		}
+
+		ctrl, responses := newTestController(cfg)
+		sendCommand(ctrl, "test/topic", `{"id":"deps-1","action":"wake","target":"nas"}`)
+
+		// 跳过中间进度，返回最终结果
+		for {
+			var response controller.Response
+			assert.NoError(t, json.Unmarshal([]byte(receiveResponse(t, responses)), &response), "响应应该是有效的JSON")
+			if response.Status != controller.STATUS_PROGRESS {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return response, woken
+			}
+		}
+	}
+
+	t.Run("按依赖顺序唤醒", func(t *testing.T) {
+		response, woken := wake(t, "")
+		assert.Equal(t, controller.STATUS_OK, response.Status, "唤醒应该成功: %s", response.Message)
+		assert.Equal(t, []string{"switch", "router", "nas"}, woken, "应该先按顺序唤醒依赖的设备")
+	})
+
+	t.Run("依赖设备唤醒失败", func(t *testing.T) {
+		response, woken := wake(t, "router")
+		assert.Equal(t, controller.STATUS_FAILED, response.Status, "依赖设备唤醒失败时应该返回失败")
+		assert.Contains(t, response.Message, "step 2/3 failed: dependency router", "应该说明失败的步骤和设备")
+		assert.Equal(t, []string{"switch", "router"}, woken, "依赖设备失败后不应该继续唤醒")
+	})
+}
+
+// TestParseCommand 测试解析命令
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		expected    controller.Command
+		isJSON      bool
+		expectError bool
+	}{
+		{name: "字符串命令", payload: "wake:nas1", expected: controller.Command{Action: "wake", Target: "nas1"}},
+		{name: "不需要目标的字符串命令", payload: "list", expected: controller.Command{Action: "list"}},
+		{name: "带子网的discover命令", payload: "discover:192.168.1.0/24", expected: controller.Command{Action: "discover", Args: map[string]interface{}{"subnet": "192.168.1.0/24"}}},
+		{name: "未知的字符串命令", payload: "reboot:nas1", expectError: true},
+		{name: "缺少目标的字符串命令", payload: "wake", expectError: true},
+		{
+			name:     "JSON命令",
+			payload:  ` {"id":"1","action":"ping","target":"@backup","args":{"count":3}}`,
+			expected: controller.Command{ID: "1", Action: "ping", Target: "@backup", Args: map[string]interface{}{"count": float64(3)}},
+			isJSON:   true,
+		},
+		{name: "无效的JSON", payload: `{"action":`, isJSON: true, expectError: true},
+		{name: "JSON命令缺少动作", payload: `{"id":"1"}`, isJSON: true, expectError: true},
+		{name: "JSON命令缺少目标", payload: `{"action":"wake"}`, isJSON: true, expectError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, isJSON, err := controller.ParseCommand([]byte(tc.payload))
+			assert.Equal(t, tc.isJSON, isJSON, "应该正确识别命令格式")
+			if tc.expectError {
+				assert.Error(t, err, "应该返回错误")
+				return
+			}
+			assert.NoError(t, err, "不应该返回错误")
+			assert.Equal(t, tc.expected, cmd, "命令应该正确")
+		})
+	}
 }
 
 // TestWakeDevice 测试唤醒设备功能
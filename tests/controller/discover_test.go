@@ -0,0 +1,102 @@
+package controller_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	"github.com/fbigun/smartwaker/internal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseOUI 测试解析OUI数据库
+func TestParseOUI(t *testing.T) {
+	data := `# Wireshark manuf
+00:11:22	Cimsys	Cimsys Inc
+AA-BB-CC	Short
+00:55:DA:00:00:00/28	Long	Longer prefix
+A4-83-E7   (hex)		Apple, Inc.
+A483E7     (base 16)		Apple, Inc.
+`
+	table, err := controller.ParseOUI(strings.NewReader(data))
+	assert.NoError(t, err, "解析OUI数据库不应该返回错误")
+	assert.Len(t, table, 3, "应该跳过更长前缀和base 16的条目")
+	assert.Equal(t, "Cimsys Inc", table["001122"], "manuf格式应该使用完整名称")
+	assert.Equal(t, "Short", table["AABBCC"], "没有完整名称时应该使用简称")
+	assert.Equal(t, "Apple, Inc.", table["A483E7"], "应该解析IEEE格式")
+}
+
+// TestOUILookup 测试查询MAC地址厂商
+func TestOUILookup(t *testing.T) {
+	table, err := controller.LoadOUITable("")
+	assert.NoError(t, err, "加载内置OUI表不应该返回错误")
+
+	tests := []struct {
+		name   string
+		mac    string
+		vendor string
+	}{
+		{name: "内置厂商", mac: "00:11:32:aa:bb:cc", vendor: "Synology Incorporated"},
+		{name: "不同的分隔符", mac: "b8-27-eb-00-00-01", vendor: "Raspberry Pi Foundation"},
+		{name: "本地管理的地址", mac: "02:42:ac:11:00:02", vendor: "Locally administered"},
+		{name: "未知厂商", mac: "00:00:5e:00:53:01", vendor: ""},
+		{name: "无效的MAC地址", mac: "invalid", vendor: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.vendor, table.Lookup(tc.mac), "厂商名称应该正确")
+		})
+	}
+}
+
+// TestFormatDeviceEntries 测试生成候选的设备配置
+func TestFormatDeviceEntries(t *testing.T) {
+	hosts := []controller.DiscoveredHost{
+		{IP: "192.168.1.10", MAC: "00:11:22:33:44:55", Method: "arp", RTT: time.Millisecond},
+		{IP: "192.168.1.23", MAC: "00:11:32:aa:bb:cc", Hostname: "nas.lan", Vendor: "Synology Incorporated", Method: "arp", RTT: time.Millisecond},
+		{IP: "192.168.1.24", MAC: "00:11:32:aa:bb:cd", Hostname: "nas.home", Method: "arp", RTT: time.Millisecond},
+		{IP: "10.0.0.5", Method: "icmp", RTT: time.Millisecond},
+	}
+	known := []config.DeviceConfig{{Name: "NAS1", MAC: "00-11-22-33-44-55"}}
+
+	entries := controller.FormatDeviceEntries(hosts, known)
+
+	assert.True(t, strings.HasPrefix(entries, "devices:\n"), "应该以devices开头")
+	assert.Contains(t, entries, "# 192.168.1.10 (00:11:22:33:44:55) is already configured as NAS1", "已配置的设备只输出注释")
+	assert.NotContains(t, entries, `ip: "192.168.1.10"`, "已配置的设备不应该输出配置")
+	assert.Contains(t, entries, "# 192.168.1.23 Synology Incorporated, arp reply in 1ms", "应该包含厂商和发现方式")
+	assert.Contains(t, entries, `  - name: "nas"
+    mac: "00:11:32:aa:bb:cc"
+    ip: "192.168.1.23"
+    hostname: "nas.lan"`, "应该使用主机名的第一段作为设备名称")
+	assert.Contains(t, entries, `name: "nas-2"`, "重复的名称应该添加后缀")
+	assert.Contains(t, entries, "MAC unknown", "没有MAC地址的主机应该说明")
+	assert.Contains(t, entries, `name: "host-10-0-0-5"`, "没有主机名时应该使用IP地址作为名称")
+	assert.Contains(t, entries, `    # mac: "" # TODO: MAC address unknown`, "MAC地址未知时应该注释掉mac配置")
+	assert.NotContains(t, entries, "\n    mac: \"\"", "不应该输出空的mac配置")
+}
+
+// TestDiscover 测试扫描子网
+func TestDiscover(t *testing.T) {
+	t.Run("无效的子网", func(t *testing.T) {
+		_, err := controller.Discover(context.Background(), []string{"192.168.1.0"}, controller.DiscoverOptions{})
+		assert.Error(t, err, "无效的子网应该返回错误")
+	})
+
+	t.Run("子网过大", func(t *testing.T) {
+		_, err := controller.Discover(context.Background(), []string{"10.0.0.0/8"}, controller.DiscoverOptions{})
+		assert.Error(t, err, "过大的子网应该返回错误")
+	})
+
+	t.Run("扫描本地回环地址", func(t *testing.T) {
+		hosts, err := controller.Discover(context.Background(), []string{"127.0.0.1/32"}, controller.DiscoverOptions{Timeout: time.Second})
+		assert.NoError(t, err, "扫描不应该返回错误")
+		if assert.Len(t, hosts, 1, "应该发现本地回环地址") {
+			assert.Equal(t, "127.0.0.1", hosts[0].IP, "IP地址应该正确")
+			assert.Equal(t, "icmp", hosts[0].Method, "回环地址应该通过ICMP发现")
+		}
+	})
+}
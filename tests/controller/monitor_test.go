@@ -0,0 +1,135 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	"github.com/fbigun/smartwaker/internal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+// publishedMessage 记录发布的消息
+type publishedMessage struct {
+	topic    string
+	retained bool
+	payload  []byte
+}
+
+// recordingPublisher 记录所有发布消息的模拟发布者
+type recordingPublisher struct {
+	mu       sync.Mutex
+	messages []publishedMessage
+}
+
+// Publish 记录发布的消息
+func (p *recordingPublisher) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, publishedMessage{topic: topic, retained: retained, payload: payload.([]byte)})
+	return nil
+}
+
+// snapshot 返回已发布消息的副本
+func (p *recordingPublisher) snapshot() []publishedMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]publishedMessage(nil), p.messages...)
+}
+
+// TestPresence 测试设备在线状态机
+func TestPresence(t *testing.T) {
+	start := time.Now()
+
+	t.Run("第一次检测决定初始状态", func(t *testing.T) {
+		presence := controller.NewPresence(1, 3, 0)
+		assert.Equal(t, controller.PRESENCE_UNKNOWN, presence.State, "初始状态应该是unknown")
+
+		previous, changed := presence.Observe(true, start)
+		assert.True(t, changed, "状态应该变化")
+		assert.Equal(t, controller.PRESENCE_UNKNOWN, previous, "变化前的状态不匹配")
+		assert.Equal(t, controller.PRESENCE_ONLINE, presence.State, "设备应该在线")
+	})
+
+	t.Run("连续失败达到阈值后才离线", func(t *testing.T) {
+		presence := controller.NewPresence(1, 3, 0)
+		presence.Observe(true, start)
+
+		for i := 1; i <= 2; i++ {
+			_, changed := presence.Observe(false, start.Add(time.Duration(i)*time.Second))
+			assert.False(t, changed, "未达到阈值时状态不应该变化")
+		}
+
+		// 中间一次成功会重置失败计数
+		presence.Observe(true, start.Add(3*time.Second))
+		for i := 4; i <= 5; i++ {
+			_, changed := presence.Observe(false, start.Add(time.Duration(i)*time.Second))
+			assert.False(t, changed, "失败计数应该已被重置")
+		}
+
+		previous, changed := presence.Observe(false, start.Add(6*time.Second))
+		assert.True(t, changed, "达到阈值后状态应该变化")
+		assert.Equal(t, controller.PRESENCE_ONLINE, previous, "变化前的状态不匹配")
+		assert.Equal(t, controller.PRESENCE_OFFLINE, presence.State, "设备应该离线")
+	})
+
+	t.Run("保持时间内抑制状态切换", func(t *testing.T) {
+		presence := controller.NewPresence(1, 1, time.Minute)
+		presence.Observe(false, start)
+
+		_, changed := presence.Observe(true, start.Add(10*time.Second))
+		assert.False(t, changed, "保持时间内状态不应该变化")
+		assert.Equal(t, controller.PRESENCE_OFFLINE, presence.State, "设备应该仍然离线")
+
+		_, changed = presence.Observe(true, start.Add(2*time.Minute))
+		assert.True(t, changed, "超过保持时间后状态应该变化")
+		assert.Equal(t, controller.PRESENCE_ONLINE, presence.State, "设备应该在线")
+		assert.Equal(t, start.Add(2*time.Minute), presence.Since, "状态变化时间不匹配")
+	})
+}
+
+// TestMonitor 测试后台监控发布设备状态和事件
+func TestMonitor(t *testing.T) {
+	cfg := &config.Config{
+		MQTT: config.MQTTConfig{Topic: "smartwaker/test", QoS: 1},
+		Devices: []config.DeviceConfig{
+			{Name: "NAS1", IP: "192.168.1.100"},
+			{Name: "NoIP"},
+		},
+		Monitor: config.MonitorConfig{Enabled: true, Interval: 60},
+	}
+
+	publisher := &recordingPublisher{}
+	monitor := controller.NewMonitor(cfg, publisher)
+	monitor.Probe = func(device *config.DeviceConfig) bool { return true }
+
+	monitor.Start()
+	assert.Eventually(t, func() bool { return len(publisher.snapshot()) >= 2 }, 2*time.Second, 10*time.Millisecond, "应该发布状态和事件")
+	monitor.Stop()
+
+	messages := publisher.snapshot()
+	assert.Len(t, messages, 2, "只有可以检测的设备会发布消息")
+
+	assert.Equal(t, "smartwaker/test/devices/NAS1/state", messages[0].topic, "状态主题不匹配")
+	assert.True(t, messages[0].retained, "状态消息应该是保留消息")
+	var state controller.DeviceStateMessage
+	assert.NoError(t, json.Unmarshal(messages[0].payload, &state), "解析状态消息失败")
+	assert.Equal(t, "NAS1", state.Device, "设备名称不匹配")
+	assert.Equal(t, controller.PRESENCE_ONLINE, state.State, "设备状态不匹配")
+
+	assert.Equal(t, "smartwaker/test/devices/NAS1/events", messages[1].topic, "事件主题不匹配")
+	assert.False(t, messages[1].retained, "事件消息不应该是保留消息")
+	var event controller.DeviceEventMessage
+	assert.NoError(t, json.Unmarshal(messages[1].payload, &event), "解析事件消息失败")
+	assert.Equal(t, controller.PRESENCE_UNKNOWN, event.From, "变化前的状态不匹配")
+	assert.Equal(t, controller.PRESENCE_ONLINE, event.To, "变化后的状态不匹配")
+
+	presence, ok := monitor.State("NAS1")
+	assert.True(t, ok, "应该能获取设备状态")
+	assert.Equal(t, controller.PRESENCE_ONLINE, presence.State, "设备状态不匹配")
+
+	presence, _ = monitor.State("NoIP")
+	assert.Equal(t, controller.PRESENCE_UNKNOWN, presence.State, "未监控的设备状态应该是unknown")
+}
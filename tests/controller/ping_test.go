@@ -1,6 +1,7 @@
 package controller_test
 
 import (
+	"net"
 	"testing"
 	"time"
 
@@ -91,3 +92,67 @@ func TestIsPortOpen(t *testing.T) {
 		})
 	}
 }
+
+// TestIsPortOpenIPv6 测试IPv6地址的端口检查
+func TestIsPortOpenIPv6(t *testing.T) {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("当前环境不支持IPv6")
+	}
+	defer listener.Close()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	isOpen, err := controller.IsPortOpen("::1", port)
+
+	assert.NoError(t, err, "不应该返回错误")
+	assert.True(t, isOpen, "端口应该开放")
+}
+
+// TestPing 测试发送多个ICMP回显请求并统计结果
+func TestPing(t *testing.T) {
+	t.Run("Ping本地主机多次", func(t *testing.T) {
+		stats, err := controller.Ping("127.0.0.1", controller.PingOptions{
+			Count:    3,
+			Interval: 100 * time.Millisecond,
+			Timeout:  time.Second,
+		})
+		if err != nil {
+			t.Skipf("当前环境无法Ping: %v", err)
+		}
+
+		assert.Equal(t, 3, stats.Sent, "发送数量不匹配")
+		assert.Equal(t, 3, stats.Received, "接收数量不匹配")
+		assert.Equal(t, float64(0), stats.PacketLoss, "不应该丢包")
+		assert.Len(t, stats.RTTs, 3, "应该记录每个应答的往返时间")
+		assert.LessOrEqual(t, stats.MinRTT, stats.AvgRTT, "最小往返时间应该不大于平均值")
+		assert.LessOrEqual(t, stats.AvgRTT, stats.MaxRTT, "平均往返时间应该不大于最大值")
+		assert.True(t, stats.Reachable(), "本地主机应该可达")
+	})
+
+	t.Run("Ping不可达主机", func(t *testing.T) {
+		// 198.51.100.0/24 为文档保留地址，不会有应答
+		stats, err := controller.Ping("198.51.100.1", controller.PingOptions{
+			Count:    2,
+			Interval: 100 * time.Millisecond,
+			Timeout:  300 * time.Millisecond,
+		})
+		if err != nil {
+			t.Skipf("当前环境无法Ping: %v", err)
+		}
+
+		assert.Equal(t, 2, stats.Sent, "发送数量不匹配")
+		assert.Equal(t, 0, stats.Received, "不应该收到应答")
+		assert.Equal(t, float64(100), stats.PacketLoss, "应该全部丢包")
+		assert.False(t, stats.Reachable(), "主机不应该可达")
+	})
+
+	t.Run("Ping IPv6本地主机", func(t *testing.T) {
+		stats, err := controller.Ping("::1", controller.PingOptions{Timeout: time.Second})
+		if err != nil {
+			t.Skipf("当前环境无法Ping IPv6: %v", err)
+		}
+
+		assert.Equal(t, 1, stats.Received, "应该收到应答")
+		assert.Greater(t, stats.AvgRTT, time.Duration(0), "往返时间应该大于0")
+	})
+}
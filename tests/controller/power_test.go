@@ -0,0 +1,134 @@
+package controller_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	"github.com/fbigun/smartwaker/internal/controller"
+	"github.com/fbigun/smartwaker/tests/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPowerTracker 测试设备电源状态机
+func TestPowerTracker(t *testing.T) {
+	devices := []config.DeviceConfig{{Name: "NAS1"}}
+
+	t.Run("初始状态为unknown", func(t *testing.T) {
+		tracker := controller.NewPowerTracker(devices)
+		defer tracker.Stop()
+
+		assert.Equal(t, controller.POWER_UNKNOWN, tracker.Get("NAS1").State, "初始状态不匹配")
+	})
+
+	t.Run("唤醒中不能重复唤醒或关机", func(t *testing.T) {
+		tracker := controller.NewPowerTracker(devices)
+		defer tracker.Stop()
+
+		state, ok := tracker.BeginWake("NAS1")
+		assert.True(t, ok, "第一次唤醒应该成功")
+		assert.Equal(t, controller.POWER_WAKING, state.State, "状态应该是waking")
+
+		state, ok = tracker.BeginWake("NAS1")
+		assert.False(t, ok, "唤醒中不应该重复唤醒")
+		assert.Equal(t, controller.POWER_WAKING, state.State, "应该返回当前状态")
+
+		tracker.Set("NAS1", controller.POWER_BOOTING, "")
+		_, ok = tracker.BeginShutdown("NAS1")
+		assert.False(t, ok, "启动中不应该关机")
+
+		tracker.Observe("NAS1", true)
+		assert.Equal(t, controller.POWER_ONLINE, tracker.Get("NAS1").State, "检测到设备在线后应该是online")
+
+		_, ok = tracker.BeginShutdown("NAS1")
+		assert.True(t, ok, "在线的设备应该可以关机")
+	})
+
+	t.Run("可达性检测结果驱动状态", func(t *testing.T) {
+		tracker := controller.NewPowerTracker(devices)
+		defer tracker.Stop()
+
+		tracker.Observe("NAS1", false)
+		assert.Equal(t, controller.POWER_OFF, tracker.Get("NAS1").State, "不可达的设备应该是off")
+
+		tracker.BeginWake("NAS1")
+		tracker.Observe("NAS1", false)
+		assert.Equal(t, controller.POWER_WAKING, tracker.Get("NAS1").State, "唤醒中的设备不可达时状态不应该变化")
+
+		tracker.Set("NAS1", controller.POWER_SHUTTING_DOWN, "")
+		tracker.Observe("NAS1", true)
+		assert.Equal(t, controller.POWER_SHUTTING_DOWN, tracker.Get("NAS1").State, "关机中的设备可达时状态不应该变化")
+		tracker.Observe("NAS1", false)
+		assert.Equal(t, controller.POWER_OFF, tracker.Get("NAS1").State, "关机中的设备不可达后应该是off")
+
+		tracker.Set("NAS1", controller.POWER_FAILED, "did not come up")
+		tracker.Observe("NAS1", false)
+		state := tracker.Get("NAS1")
+		assert.Equal(t, controller.POWER_FAILED, state.State, "失败的设备不可达时应该保留失败状态")
+		assert.Equal(t, "did not come up", state.Reason, "应该保留失败原因")
+	})
+
+	t.Run("超时后转为失败", func(t *testing.T) {
+		tracker := controller.NewPowerTracker(devices)
+		defer tracker.Stop()
+
+		tracker.SetWithTimeout("NAS1", controller.POWER_BOOTING, "", 50*time.Millisecond, func() (string, string) {
+			return controller.POWER_FAILED, "did not come up within 50ms"
+		})
+		assert.Equal(t, controller.POWER_BOOTING, tracker.Get("NAS1").State, "状态应该是booting")
+
+		assert.Eventually(t, func() bool {
+			return tracker.Get("NAS1").State == controller.POWER_FAILED
+		}, time.Second, 10*time.Millisecond, "超时后应该转为failed")
+		assert.Equal(t, "did not come up within 50ms", tracker.Get("NAS1").Reason, "失败原因不匹配")
+	})
+
+	t.Run("状态变化后取消超时", func(t *testing.T) {
+		tracker := controller.NewPowerTracker(devices)
+		defer tracker.Stop()
+
+		tracker.SetWithTimeout("NAS1", controller.POWER_BOOTING, "", 50*time.Millisecond, func() (string, string) {
+			return controller.POWER_FAILED, "did not come up within 50ms"
+		})
+		tracker.Observe("NAS1", true)
+
+		time.Sleep(150 * time.Millisecond)
+		assert.Equal(t, controller.POWER_ONLINE, tracker.Get("NAS1").State, "已上线的设备不应该因超时转为failed")
+	})
+}
+
+// TestConcurrentWake 测试同时发送两次唤醒同一设备的命令时只唤醒一次
+func TestConcurrentWake(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	server := mock.NewWakeServer(t, func(device string) int {
+		close(entered)
+		<-release
+		return http.StatusOK
+	})
+
+	cfg := &config.Config{
+		Mode: "controller",
+		MQTT: config.MQTTConfig{Topic: "test/topic", QoS: 1},
+		Devices: []config.DeviceConfig{
+			{Name: "NAS1", Waker: controller.WAKER_HTTP, HTTP: config.HTTPWakerConfig{URL: server.URL("NAS1")}},
+		},
+	}
+	ctrl, responses := newTestController(cfg)
+
+	sendCommand(ctrl, "test/topic", "wake:NAS1")
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("没有发送唤醒请求")
+	}
+
+	// 第一次唤醒仍在进行时再次唤醒
+	sendCommand(ctrl, "test/topic", "wake:NAS1")
+	assert.Contains(t, receiveResponse(t, responses), "Device NAS1 is already waking", "第二次唤醒应该报告设备正在唤醒")
+
+	close(release)
+	assert.Contains(t, receiveResponse(t, responses), "HTTP wake request sent to NAS1", "第一次唤醒应该发送唤醒请求")
+	assert.Equal(t, []string{"NAS1"}, server.Devices(), "应该只发送一次唤醒请求")
+}
@@ -0,0 +1,137 @@
+package controller_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	"github.com/fbigun/smartwaker/internal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseLeases 测试解析DHCP租约文件
+func TestParseLeases(t *testing.T) {
+	t.Run("dnsmasq格式", func(t *testing.T) {
+		leases := `1717711200 00:11:22:33:44:55 192.168.1.23 nas 01:00:11:22:33:44:55
+0 aa:bb:cc:dd:ee:ff 192.168.1.24 * *
+duid 00:01:00:01:2c:4f:8e:11:00:11:22:33:44:55
+1717711200 12345678 fd00::23 nas6 00:01:00:01
+`
+		entries, err := controller.ParseLeases(strings.NewReader(leases), "")
+		assert.NoError(t, err, "解析租约文件不应该返回错误")
+		assert.Len(t, entries, 2, "应该只解析出IPv4租约")
+
+		assert.Equal(t, "192.168.1.23", entries[0].IP.String(), "IP地址应该正确")
+		assert.Equal(t, "00:11:22:33:44:55", entries[0].MAC.String(), "MAC地址应该正确")
+		assert.Equal(t, "nas", entries[0].Hostname, "主机名应该正确")
+		assert.Equal(t, int64(1717711200), entries[0].Expires.Unix(), "到期时间应该正确")
+
+		assert.Empty(t, entries[1].Hostname, "没有主机名的租约应该为空")
+		assert.True(t, entries[1].Expires.IsZero(), "到期时间为0的租约应该永不过期")
+		assert.True(t, entries[1].Active(time.Now()), "永不过期的租约应该有效")
+	})
+
+	t.Run("ISC格式", func(t *testing.T) {
+		leases := `# The format of this file is documented in the dhcpd.leases(5) manual page.
+lease 192.168.1.23 {
+  starts 4 2024/06/06 10:00:00;
+  ends 4 2024/06/06 22:00:00;
+  binding state active;
+  next binding state free;
+  hardware ethernet 00:11:22:33:44:55;
+  client-hostname "nas";
+}
+lease 192.168.1.30 {
+  ends never;
+  binding state free;
+  hardware ethernet aa:bb:cc:dd:ee:ff;
+}
+lease 192.168.1.31 {
+  ends epoch 1717711200;
+  binding state active;
+  hardware ethernet aa:bb:cc:dd:ee:ff;
+}
+`
+		entries, err := controller.ParseLeases(strings.NewReader(leases), "")
+		assert.NoError(t, err, "解析租约文件不应该返回错误")
+		assert.Len(t, entries, 2, "应该跳过非active状态的租约")
+
+		assert.Equal(t, "192.168.1.23", entries[0].IP.String(), "IP地址应该正确")
+		assert.Equal(t, "00:11:22:33:44:55", entries[0].MAC.String(), "MAC地址应该正确")
+		assert.Equal(t, "nas", entries[0].Hostname, "主机名应该去掉引号")
+		assert.Equal(t, time.Date(2024, 6, 6, 22, 0, 0, 0, time.UTC), entries[0].Expires, "到期时间应该按UTC解析")
+
+		assert.Equal(t, "192.168.1.31", entries[1].IP.String(), "IP地址应该正确")
+		assert.Equal(t, int64(1717711200), entries[1].Expires.Unix(), "epoch格式的到期时间应该正确")
+	})
+
+	t.Run("不支持的格式", func(t *testing.T) {
+		_, err := controller.ParseLeases(strings.NewReader(""), "unknown")
+		assert.Error(t, err, "不支持的格式应该返回错误")
+	})
+}
+
+// TestResolver 测试设备地址解析
+func TestResolver(t *testing.T) {
+	leasesFile := filepath.Join(t.TempDir(), "dnsmasq.leases")
+	writeLeases := func(ip string) {
+		content := "0 00:11:22:33:44:55 " + ip + " nas *\n"
+		assert.NoError(t, os.WriteFile(leasesFile, []byte(content), 0644), "写入租约文件不应该返回错误")
+	}
+	writeLeases("192.168.1.23")
+
+	resolver := controller.NewResolver(config.ResolveConfig{Leases: leasesFile, TTL: 60})
+
+	t.Run("静态ip", func(t *testing.T) {
+		address, err := resolver.Resolve(&config.DeviceConfig{Name: "static", IP: "192.168.1.100"})
+		assert.NoError(t, err, "静态ip不应该返回错误")
+		assert.Equal(t, "192.168.1.100", address.IP, "应该使用配置的ip")
+		assert.Equal(t, controller.RESOLVE_STATIC, address.Source, "解析方式应该是static")
+		assert.Equal(t, "192.168.1.100", address.String(), "静态ip不应该附带解析方式")
+	})
+
+	t.Run("解析主机名", func(t *testing.T) {
+		address, err := resolver.Resolve(&config.DeviceConfig{Name: "host", Hostname: "localhost"})
+		assert.NoError(t, err, "解析localhost不应该返回错误")
+		assert.Equal(t, "127.0.0.1", address.IP, "localhost应该解析为127.0.0.1")
+		assert.Equal(t, controller.RESOLVE_DNS, address.Source, "解析方式应该是dns")
+	})
+
+	t.Run("主机名解析失败时使用静态ip", func(t *testing.T) {
+		device := &config.DeviceConfig{Name: "fallback", Hostname: "invalid.host.name.that.does.not.exist", IP: "192.168.1.100"}
+		address, err := resolver.Resolve(device)
+		assert.NoError(t, err, "配置了静态ip时不应该返回错误")
+		assert.Equal(t, "192.168.1.100", address.IP, "应该使用配置的ip")
+		assert.Equal(t, controller.RESOLVE_STATIC, address.Source, "解析方式应该是static")
+	})
+
+	t.Run("从租约文件查找并缓存", func(t *testing.T) {
+		device := &config.DeviceConfig{Name: "nas", MAC: "00-11-22-33-44-55"}
+
+		address, err := resolver.Resolve(device)
+		assert.NoError(t, err, "从租约文件查找不应该返回错误")
+		assert.Equal(t, "192.168.1.23", address.IP, "应该使用租约中的ip")
+		assert.Equal(t, controller.RESOLVE_LEASES, address.Source, "解析方式应该是dhcp")
+		assert.Equal(t, "192.168.1.23 via dhcp", address.String(), "应该附带解析方式")
+
+		// 租约变化后在缓存有效期内仍然使用缓存的结果
+		writeLeases("192.168.1.42")
+		address, err = resolver.Resolve(device)
+		assert.NoError(t, err, "使用缓存不应该返回错误")
+		assert.Equal(t, "192.168.1.23", address.IP, "应该使用缓存的ip")
+
+		// 清除缓存后重新查找
+		resolver.Forget(device.Name)
+		address, err = resolver.Resolve(device)
+		assert.NoError(t, err, "重新查找不应该返回错误")
+		assert.Equal(t, "192.168.1.42", address.IP, "应该使用新的租约")
+	})
+
+	t.Run("无法解析", func(t *testing.T) {
+		_, err := resolver.Resolve(&config.DeviceConfig{Name: "unknown", MAC: "aa:bb:cc:dd:ee:ff"})
+		assert.ErrorIs(t, err, controller.ErrAddressNotResolved, "无法解析时应该返回ErrAddressNotResolved")
+	})
+}
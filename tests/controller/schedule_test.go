@@ -0,0 +1,113 @@
+package controller_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	"github.com/fbigun/smartwaker/internal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNewScheduler 测试创建调度器
+func TestNewScheduler(t *testing.T) {
+	t.Run("无效的cron表达式", func(t *testing.T) {
+		schedules := []config.ScheduleConfig{
+			{Name: "invalid", Cron: "not a cron", Action: "wake", Target: "nas"},
+		}
+
+		_, err := controller.NewScheduler(schedules, func(context.Context, config.ScheduleConfig) {})
+		assert.Error(t, err, "应该返回错误")
+	})
+
+	t.Run("按时区计算下一次执行时间", func(t *testing.T) {
+		schedules := []config.ScheduleConfig{
+			{Name: "nightly", Cron: "0 1 * * *", Timezone: "Asia/Shanghai", Action: "wake", Target: "nas"},
+			{Name: "hourly", Cron: "0 * * * *", Action: "ping", Target: "@backup"},
+		}
+
+		scheduler, err := controller.NewScheduler(schedules, func(context.Context, config.ScheduleConfig) {})
+		assert.NoError(t, err, "创建调度器失败")
+
+		runs := scheduler.NextRuns()
+		assert.Len(t, runs, 2, "应该返回所有定时任务")
+
+		location, err := time.LoadLocation("Asia/Shanghai")
+		assert.NoError(t, err, "加载时区失败")
+
+		for _, run := range runs {
+			assert.True(t, run.Next.After(time.Now()), "下一次执行时间应该在当前时间之后")
+			if run.Name == "nightly" {
+				next := run.Next.In(location)
+				assert.Equal(t, 1, next.Hour(), "应该在指定时区的1点执行")
+				assert.Equal(t, 0, next.Minute(), "应该在整点执行")
+				assert.Equal(t, "wake", run.Action, "动作不匹配")
+				assert.Equal(t, "nas", run.Target, "目标不匹配")
+			}
+		}
+		assert.False(t, runs[1].Next.Before(runs[0].Next), "应该按执行时间排序")
+	})
+
+	t.Run("到达执行时间时执行任务", func(t *testing.T) {
+		schedules := []config.ScheduleConfig{
+			{Name: "frequent", Cron: "@every 1s", Action: "ping", Target: "nas"},
+		}
+
+		executed := make(chan config.ScheduleConfig, 1)
+		scheduler, err := controller.NewScheduler(schedules, func(ctx context.Context, schedule config.ScheduleConfig) {
+			select {
+			case executed <- schedule:
+			default:
+			}
+		})
+		assert.NoError(t, err, "创建调度器失败")
+
+		scheduler.Start()
+		defer scheduler.Stop()
+
+		select {
+		case schedule := <-executed:
+			assert.Equal(t, "frequent", schedule.Name, "执行的任务不匹配")
+		case <-time.After(3 * time.Second):
+			t.Fatal("定时任务未在预期时间内执行")
+		}
+	})
+	t.Run("停止时取消执行中的任务", func(t *testing.T) {
+		schedules := []config.ScheduleConfig{
+			{Name: "frequent", Cron: "@every 1s", Action: "wake", Target: "nas"},
+		}
+
+		started := make(chan struct{}, 1)
+		scheduler, err := controller.NewScheduler(schedules, func(ctx context.Context, schedule config.ScheduleConfig) {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			// 模拟等待设备上线的长时间任务
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Minute):
+			}
+		})
+		assert.NoError(t, err, "创建调度器失败")
+
+		scheduler.Start()
+		select {
+		case <-started:
+		case <-time.After(3 * time.Second):
+			t.Fatal("定时任务未在预期时间内执行")
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			scheduler.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(3 * time.Second):
+			t.Fatal("停止调度器时应该取消执行中的任务")
+		}
+	})
+}
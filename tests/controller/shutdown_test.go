@@ -0,0 +1,42 @@
+package controller_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	"github.com/fbigun/smartwaker/internal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestShutdownDevice 测试关闭设备
+func TestShutdownDevice(t *testing.T) {
+	t.Run("未配置关机方式", func(t *testing.T) {
+		device := &config.DeviceConfig{Name: "NAS1"}
+
+		_, err := controller.ShutdownDevice(context.Background(), device)
+		assert.ErrorIs(t, err, controller.ErrShutdownNotConfigured, "应该返回未配置错误")
+	})
+
+	t.Run("执行关机命令", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("测试依赖sh命令")
+		}
+
+		device := &config.DeviceConfig{
+			Name: "NAS1",
+			Shutdown: config.ShutdownConfig{
+				Method: "exec",
+				Exec: config.ExecWakerConfig{
+					Command: "sh",
+					Args:    []string{"-c", "echo shutting down $0", "{{.Name}}"},
+				},
+			},
+		}
+
+		message, err := controller.ShutdownDevice(context.Background(), device)
+		assert.NoError(t, err, "不应该返回错误")
+		assert.Contains(t, message, "shutting down NAS1", "响应消息应包含命令输出")
+	})
+}
@@ -0,0 +1,65 @@
+package controller_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fbigun/smartwaker/internal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWaitForDevice 测试等待设备上线功能
+func TestWaitForDevice(t *testing.T) {
+	t.Run("端口已开放", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err, "创建监听器失败")
+		defer listener.Close()
+
+		port := listener.Addr().(*net.TCPAddr).Port
+		elapsed, online := controller.WaitForDevice("127.0.0.1", port, 5*time.Second, nil)
+
+		assert.True(t, online, "设备应该已上线")
+		assert.Less(t, elapsed, 5*time.Second, "等待时间应该小于超时时间")
+	})
+
+	t.Run("端口未开放", func(t *testing.T) {
+		// 获取一个空闲端口后立即关闭，确保连接会被拒绝
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err, "创建监听器失败")
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+
+		elapsed, online := controller.WaitForDevice("127.0.0.1", port, 2*time.Second, nil)
+
+		assert.False(t, online, "设备不应该上线")
+		assert.GreaterOrEqual(t, elapsed, 2*time.Second, "应该等待到超时")
+	})
+
+	t.Run("等待期间端口开放", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err, "创建监听器失败")
+		addr := listener.Addr().String()
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+
+		// 模拟设备在2秒后启动完成
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			time.Sleep(2 * time.Second)
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				return
+			}
+			time.Sleep(3 * time.Second)
+			l.Close()
+		}()
+
+		elapsed, online := controller.WaitForDevice("127.0.0.1", port, 10*time.Second, nil)
+		<-done
+
+		assert.True(t, online, "设备应该已上线")
+		assert.GreaterOrEqual(t, elapsed, 2*time.Second, "应该等待设备启动")
+	})
+}
@@ -1,7 +1,12 @@
 package controller_test
 
 import (
+	"errors"
+	"net"
+	"os"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/fbigun/smartwaker/internal/controller"
 	"github.com/stretchr/testify/assert"
@@ -107,3 +112,246 @@ func TestWakeOnLANNetworkError(t *testing.T) {
 	assert.Error(t, err, "应该返回错误")
 	assert.Contains(t, err.Error(), "failed to resolve target address", "错误消息不匹配")
 }
+
+// receiveMagicPacket 在本地监听UDP端口，使用指定选项发送Magic Packet并返回收到的数据
+func receiveMagicPacket(t *testing.T, macAddr string, opts controller.WakeOptions) ([]byte, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("创建UDP监听失败: %v", err)
+	}
+	defer conn.Close()
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	if _, err := controller.WakeOnLANWithOptions(macAddr, "127.0.0.1", port, opts); err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatalf("接收Magic Packet失败: %v", err)
+	}
+
+	return buffer[:n], nil
+}
+
+// TestWakeOnLANSecureOn 测试带SecureOn密码的Magic Packet
+func TestWakeOnLANSecureOn(t *testing.T) {
+	tests := []struct {
+		name           string
+		secureOn       string
+		expectedLength int
+		expectedSuffix []byte
+		expectError    bool
+	}{
+		{
+			name:           "不带密码",
+			secureOn:       "",
+			expectedLength: 102,
+		},
+		{
+			name:           "6字节MAC格式密码",
+			secureOn:       "aa:bb:cc:dd:ee:ff",
+			expectedLength: 108,
+			expectedSuffix: []byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF},
+		},
+		{
+			name:           "4字节十六进制密码",
+			secureOn:       "01020304",
+			expectedLength: 106,
+			expectedSuffix: []byte{0x01, 0x02, 0x03, 0x04},
+		},
+		{
+			name:           "4字节连字符分隔密码",
+			secureOn:       "0a-0b-0c-0d",
+			expectedLength: 106,
+			expectedSuffix: []byte{0x0A, 0x0B, 0x0C, 0x0D},
+		},
+		{
+			name:        "长度无效的密码",
+			secureOn:    "010203",
+			expectError: true,
+		},
+		{
+			name:        "包含无效字符的密码",
+			secureOn:    "zz:zz:zz:zz",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			packet, err := receiveMagicPacket(t, "00:11:22:33:44:55", controller.WakeOptions{SecureOn: tc.secureOn})
+
+			if tc.expectError {
+				assert.Error(t, err, "应该返回错误")
+				assert.Contains(t, err.Error(), "invalid SecureOn password", "错误消息不匹配")
+				return
+			}
+
+			assert.NoError(t, err, "不应该返回错误")
+			assert.Equal(t, tc.expectedLength, len(packet), "Magic Packet长度不匹配")
+			assert.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, packet[:6], "同步头不匹配")
+			assert.Equal(t, []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, packet[96:102], "最后一次重复的MAC地址不匹配")
+			if tc.expectedSuffix != nil {
+				assert.Equal(t, tc.expectedSuffix, packet[102:], "SecureOn密码不匹配")
+			}
+		})
+	}
+}
+
+// TestWakeOnLANEthernet 测试以太网帧方式发送Magic Packet
+func TestWakeOnLANEthernet(t *testing.T) {
+	t.Run("未指定网卡", func(t *testing.T) {
+		_, err := controller.WakeOnLANWithOptions("00:11:22:33:44:55", "", 0, controller.WakeOptions{
+			Transport: controller.TRANSPORT_ETHERNET,
+		})
+		assert.Error(t, err, "应该返回错误")
+		assert.Contains(t, err.Error(), "interface is required", "错误消息不匹配")
+	})
+
+	t.Run("不存在的网卡", func(t *testing.T) {
+		_, err := controller.WakeOnLANWithOptions("00:11:22:33:44:55", "", 0, controller.WakeOptions{
+			Transport: controller.TRANSPORT_ETHERNET,
+			Interface: "smartwaker-nonexistent0",
+		})
+		assert.Error(t, err, "应该返回错误")
+		if runtime.GOOS == "linux" {
+			assert.Contains(t, err.Error(), "failed to find interface", "错误消息不匹配")
+		} else {
+			assert.ErrorIs(t, err, controller.ErrEthernetUnsupported, "非Linux平台应该返回不支持错误")
+		}
+	})
+
+	t.Run("通过以太网卡发送", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("以太网帧方式仅支持Linux")
+		}
+
+		// 会在局域网中真实广播唤醒帧，只在指定了网卡时执行
+		ifaceName := os.Getenv("SMARTWAKER_TEST_WOL_INTERFACE")
+		if ifaceName == "" {
+			t.Skip("设置SMARTWAKER_TEST_WOL_INTERFACE为网卡名称以测试发送以太网帧")
+		}
+
+		_, err := controller.WakeOnLANWithOptions("00:11:22:33:44:55", "", 0, controller.WakeOptions{
+			Transport: controller.TRANSPORT_ETHERNET,
+			Interface: ifaceName,
+		})
+
+		// 没有CAP_NET_RAW权限时应该返回明确的权限错误
+		if err != nil && !errors.Is(err, controller.ErrRawSocketPermission) {
+			t.Errorf("发送失败: %v", err)
+		}
+	})
+}
+
+// TestWakeOnLANDirectedBroadcast 测试基于网卡和子网的定向广播
+func TestWakeOnLANDirectedBroadcast(t *testing.T) {
+	t.Run("无效的子网", func(t *testing.T) {
+		_, err := controller.WakeOnLANWithOptions("00:11:22:33:44:55", "", 9, controller.WakeOptions{
+			Subnet: "192.168.10.0/33",
+		})
+		assert.Error(t, err, "应该返回错误")
+		assert.Contains(t, err.Error(), "invalid subnet", "错误消息不匹配")
+	})
+
+	t.Run("不存在的网卡", func(t *testing.T) {
+		_, err := controller.WakeOnLANWithOptions("00:11:22:33:44:55", "", 9, controller.WakeOptions{
+			Interface: "smartwaker-nonexistent0",
+		})
+		assert.Error(t, err, "应该返回错误")
+		assert.Contains(t, err.Error(), "failed to find interface", "错误消息不匹配")
+	})
+
+	t.Run("绑定回环网卡发送", func(t *testing.T) {
+		// 查找带有IPv4地址的回环网卡
+		var ifaceName string
+		ifaces, _ := net.Interfaces()
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagLoopback != 0 {
+				ifaceName = iface.Name
+				break
+			}
+		}
+		if ifaceName == "" {
+			t.Skip("没有可用的回环网卡")
+		}
+
+		packet, err := receiveMagicPacket(t, "00:11:22:33:44:55", controller.WakeOptions{Interface: ifaceName})
+		assert.NoError(t, err, "不应该返回错误")
+		assert.Equal(t, 102, len(packet), "Magic Packet长度不匹配")
+	})
+}
+
+// TestWakeOnLANRepeat 测试重复发送和多端口发送
+func TestWakeOnLANRepeat(t *testing.T) {
+	// 创建两个UDP监听模拟不同端口
+	var conns []*net.UDPConn
+	var ports []int
+	for i := 0; i < 2; i++ {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("创建UDP监听失败: %v", err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+		ports = append(ports, conn.LocalAddr().(*net.UDPAddr).Port)
+	}
+
+	start := time.Now()
+	sent, err := controller.WakeOnLANWithOptions("00:11:22:33:44:55", "127.0.0.1", 0, controller.WakeOptions{
+		Repeat:         3,
+		RepeatInterval: 50 * time.Millisecond,
+		Ports:          ports,
+	})
+
+	assert.NoError(t, err, "不应该返回错误")
+	assert.Equal(t, 6, sent, "发送数量不匹配")
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "每轮发送之间应该等待间隔时间")
+
+	// 每个端口应该收到3个Magic Packet
+	buffer := make([]byte, 1024)
+	for i, conn := range conns {
+		received := 0
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			n, _, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				break
+			}
+			assert.Equal(t, 102, n, "Magic Packet长度不匹配")
+			received++
+		}
+		assert.Equal(t, 3, received, "端口%d收到的Magic Packet数量不匹配", ports[i])
+	}
+}
+
+// TestWakeOnLANIPv6 测试IPv6方式发送Magic Packet
+func TestWakeOnLANIPv6(t *testing.T) {
+	t.Run("组播未指定网卡", func(t *testing.T) {
+		_, err := controller.WakeOnLANWithOptions("00:11:22:33:44:55", "", 9, controller.WakeOptions{IPv6: true})
+		assert.Error(t, err, "应该返回错误")
+		assert.Contains(t, err.Error(), "interface is required for IPv6 multicast", "错误消息不匹配")
+	})
+
+	t.Run("发送到IPv6地址", func(t *testing.T) {
+		conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+		if err != nil {
+			t.Skip("当前环境不支持IPv6")
+		}
+		defer conn.Close()
+
+		port := conn.LocalAddr().(*net.UDPAddr).Port
+		sent, err := controller.WakeOnLANWithOptions("00:11:22:33:44:55", "::1", port, controller.WakeOptions{})
+		assert.NoError(t, err, "不应该返回错误")
+		assert.Equal(t, 1, sent, "发送数量不匹配")
+
+		buffer := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := conn.ReadFromUDP(buffer)
+		assert.NoError(t, err, "接收Magic Packet失败")
+		assert.Equal(t, 102, n, "Magic Packet长度不匹配")
+	})
+}
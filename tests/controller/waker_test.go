@@ -0,0 +1,174 @@
+package controller_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/fbigun/smartwaker/internal/config"
+	"github.com/fbigun/smartwaker/internal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNewWaker 测试根据配置创建唤醒方式
+func TestNewWaker(t *testing.T) {
+	tests := []struct {
+		name        string
+		waker       string
+		expected    controller.Waker
+		expectError bool
+	}{
+		{
+			name:     "默认使用WOL",
+			waker:    "",
+			expected: &controller.WOLWaker{},
+		},
+		{
+			name:     "WOL方式",
+			waker:    "wol",
+			expected: &controller.WOLWaker{},
+		},
+		{
+			name:     "HTTP方式",
+			waker:    "http",
+			expected: &controller.HTTPWaker{},
+		},
+		{
+			name:     "命令方式",
+			waker:    "exec",
+			expected: &controller.ExecWaker{},
+		},
+		{
+			name:        "未知方式",
+			waker:       "smoke-signal",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			waker, err := controller.NewWaker(&config.DeviceConfig{Name: "test-device", Waker: tc.waker}, config.WakeConfig{})
+			if tc.expectError {
+				assert.Error(t, err, "应该返回错误")
+				return
+			}
+
+			assert.NoError(t, err, "不应该返回错误")
+			assert.IsType(t, tc.expected, waker, "唤醒方式类型不匹配")
+		})
+	}
+}
+
+// TestHTTPWaker 测试通过HTTP请求唤醒设备
+func TestHTTPWaker(t *testing.T) {
+	var received struct {
+		method string
+		path   string
+		header string
+		body   string
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.method = r.Method
+		received.path = r.URL.Path
+		received.header = r.Header.Get("X-Device")
+		received.body = string(body)
+
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("plug offline"))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	device := &config.DeviceConfig{
+		Name:  "NAS1",
+		MAC:   "00:11:22:33:44:55",
+		IP:    "192.168.1.100",
+		Waker: "http",
+		HTTP: config.HTTPWakerConfig{
+			Method:  "put",
+			URL:     server.URL + "/plugs/{{.Name}}/on",
+			Headers: map[string]string{"X-Device": "{{.MAC}}"},
+			Body:    `{"ip":"{{.IP}}"}`,
+		},
+	}
+
+	t.Run("请求成功", func(t *testing.T) {
+		waker := &controller.HTTPWaker{Client: server.Client()}
+		message, err := waker.Wake(context.Background(), device)
+
+		assert.NoError(t, err, "不应该返回错误")
+		assert.Contains(t, message, "status 202", "响应消息应包含状态码")
+		assert.Equal(t, http.MethodPut, received.method, "请求方法不匹配")
+		assert.Equal(t, "/plugs/NAS1/on", received.path, "请求路径不匹配")
+		assert.Equal(t, "00:11:22:33:44:55", received.header, "请求头不匹配")
+		assert.Equal(t, `{"ip":"192.168.1.100"}`, received.body, "请求体不匹配")
+	})
+
+	t.Run("状态码不在成功列表中", func(t *testing.T) {
+		restricted := *device
+		restricted.HTTP.StatusCodes = []int{200}
+
+		waker := &controller.HTTPWaker{Client: server.Client()}
+		_, err := waker.Wake(context.Background(), &restricted)
+
+		assert.Error(t, err, "应该返回错误")
+		assert.Contains(t, err.Error(), "unexpected HTTP status 202", "错误消息不匹配")
+	})
+
+	t.Run("服务端返回错误", func(t *testing.T) {
+		failing := *device
+		failing.HTTP.URL = server.URL + "/fail"
+
+		waker := &controller.HTTPWaker{Client: server.Client()}
+		_, err := waker.Wake(context.Background(), &failing)
+
+		assert.Error(t, err, "应该返回错误")
+		assert.Contains(t, err.Error(), "unexpected HTTP status 500: plug offline", "错误消息不匹配")
+	})
+}
+
+// TestExecWaker 测试通过执行命令唤醒设备
+func TestExecWaker(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("测试依赖sh命令")
+	}
+
+	t.Run("命令执行成功", func(t *testing.T) {
+		device := &config.DeviceConfig{
+			Name:  "NAS1",
+			MAC:   "00:11:22:33:44:55",
+			Waker: "exec",
+			Exec: config.ExecWakerConfig{
+				Command: "sh",
+				Args:    []string{"-c", "echo powering on $0 $1", "{{.Name}}", "{{.MAC}}"},
+			},
+		}
+
+		message, err := (&controller.ExecWaker{}).Wake(context.Background(), device)
+		assert.NoError(t, err, "不应该返回错误")
+		assert.Contains(t, message, "powering on NAS1 00:11:22:33:44:55", "响应消息应包含命令输出")
+	})
+
+	t.Run("命令执行失败", func(t *testing.T) {
+		device := &config.DeviceConfig{
+			Name:  "NAS1",
+			Waker: "exec",
+			Exec: config.ExecWakerConfig{
+				Command: "sh",
+				Args:    []string{"-c", "echo ipmi error; exit 3"},
+			},
+		}
+
+		_, err := (&controller.ExecWaker{}).Wake(context.Background(), device)
+		assert.Error(t, err, "应该返回错误")
+		assert.Contains(t, err.Error(), "ipmi error", "错误消息应包含命令输出")
+	})
+}
@@ -0,0 +1,130 @@
+package mock
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// Broker 是一个进程内的完整MQTT服务器，支持MQTT 3.1、3.1.1和5.0
+// 与MQTTServer不同，Broker会真正转发消息，用于测试客户端之间的通信
+type Broker struct {
+	server    *mochi.Server
+	listener  *listeners.TCP
+	websocket *listeners.Websocket
+	stopOnce  sync.Once
+}
+
+// NewBroker 在随机端口上启动进程内MQTT服务器，同时提供TCP和WebSocket监听器，测试结束时自动关闭
+// hooks为空时允许所有客户端连接
+func NewBroker(t *testing.T, hooks ...mochi.Hook) *Broker {
+	t.Helper()
+
+	server := mochi.New(&mochi.Options{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+
+	if len(hooks) == 0 {
+		hooks = append(hooks, new(auth.AllowHook))
+	}
+	for _, hook := range hooks {
+		if err := server.AddHook(hook, nil); err != nil {
+			t.Fatalf("添加MQTT服务器钩子失败: %v", err)
+		}
+	}
+
+	listener := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	if err := server.AddListener(listener); err != nil {
+		t.Fatalf("创建MQTT服务器监听器失败: %v", err)
+	}
+	websocket := listeners.NewWebsocket(listeners.Config{ID: "ws", Address: freeAddress(t)})
+	if err := server.AddListener(websocket); err != nil {
+		t.Fatalf("创建MQTT服务器WebSocket监听器失败: %v", err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatalf("启动MQTT服务器失败: %v", err)
+	}
+
+	waitForListener(t, websocket.Address())
+
+	broker := &Broker{server: server, listener: listener, websocket: websocket}
+	t.Cleanup(broker.Stop)
+	return broker
+}
+
+// Address 返回服务器地址，如 "tcp://127.0.0.1:34567"
+func (b *Broker) Address() string {
+	return "tcp://" + b.listener.Address()
+}
+
+// WebSocketAddress 返回WebSocket监听器的地址，如 "ws://127.0.0.1:34568/mqtt"
+// 服务器接受任意路径的WebSocket连接
+func (b *Broker) WebSocketAddress(path string) string {
+	return "ws://" + b.websocket.Address() + path
+}
+
+// Stop 关闭服务器
+func (b *Broker) Stop() {
+	b.stopOnce.Do(func() {
+		b.server.Close()
+	})
+}
+
+// SessionExpiry 返回客户端在CONNECT报文中请求的会话过期时间(秒)
+func (b *Broker) SessionExpiry(clientID string) (uint32, bool) {
+	cl, ok := b.server.Clients.Get(clientID)
+	if !ok {
+		return 0, false
+	}
+	return cl.Properties.Props.SessionExpiryInterval, true
+}
+
+// DisconnectClient 断开指定客户端的连接，模拟网络中断，返回客户端是否存在
+func (b *Broker) DisconnectClient(clientID string) bool {
+	cl, ok := b.server.Clients.Get(clientID)
+	if !ok {
+		return false
+	}
+	b.server.DisconnectClient(cl, packets.ErrServerShuttingDown)
+	return true
+}
+
+// freeAddress 返回本机一个空闲的TCP地址
+// WebSocket监听器不会报告实际监听的端口，需要预先选定端口
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("查找空闲端口失败: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// waitForListener 等待监听器开始接受连接
+// WebSocket监听器在后台协程中开始监听，Serve返回时可能还不能连接
+func waitForListener(t *testing.T, address string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("等待监听器 %s 启动超时: %v", address, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,80 @@
+package mock
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// HTTPProxy 是一个只支持CONNECT方法的HTTP代理，用于测试通过代理建立的连接
+type HTTPProxy struct {
+	server  *httptest.Server
+	tunnels atomic.Int32
+}
+
+// NewHTTPProxy 启动HTTP代理，测试结束时自动关闭
+func NewHTTPProxy(t *testing.T) *HTTPProxy {
+	t.Helper()
+
+	proxy := &HTTPProxy{}
+	proxy.server = httptest.NewServer(http.HandlerFunc(proxy.handle))
+	t.Cleanup(proxy.server.Close)
+	return proxy
+}
+
+// URL 返回代理地址，如 "http://127.0.0.1:34567"
+func (p *HTTPProxy) URL() string {
+	return p.server.URL
+}
+
+// Tunnels 返回代理建立过的隧道数量
+func (p *HTTPProxy) Tunnels() int {
+	return int(p.tunnels.Load())
+}
+
+// handle 处理CONNECT请求，在客户端和目标地址之间转发数据
+func (p *HTTPProxy) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", r.Host, 5*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		upstream.Close()
+		client.Close()
+		return
+	}
+	p.tunnels.Add(1)
+
+	go func() {
+		defer upstream.Close()
+		defer client.Close()
+		io.Copy(upstream, client)
+	}()
+	go func() {
+		defer upstream.Close()
+		defer client.Close()
+		io.Copy(client, upstream)
+	}()
+}
@@ -0,0 +1,139 @@
+package mock
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+const (
+	// scramMethod ScramHook支持的认证方法
+	scramMethod = "SCRAM-SHA-256"
+	// scramIterations 计算加盐密码的迭代次数
+	scramIterations = 4096
+)
+
+// ScramHook 是MQTT服务器的SCRAM-SHA-256增强认证钩子，允许认证通过的客户端访问所有主题
+// mochi不支持在CONNACK中携带认证数据，服务器的最终消息在第二个AUTH报文中发送
+type ScramHook struct {
+	mochi.HookBase
+	Username string
+	Password string
+}
+
+// ID 返回钩子名称
+func (h *ScramHook) ID() string {
+	return "scram-auth"
+}
+
+// Provides 声明钩子处理连接认证和访问控制
+func (h *ScramHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{mochi.OnConnectAuthenticate, mochi.OnACLCheck}, []byte{b})
+}
+
+// OnACLCheck 允许访问所有主题
+func (h *ScramHook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	return true
+}
+
+// OnConnectAuthenticate 在发送CONNACK之前通过AUTH报文完成SCRAM认证
+func (h *ScramHook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	if pk.Properties.AuthenticationMethod != scramMethod {
+		return false
+	}
+
+	clientFirstBare, ok := strings.CutPrefix(string(pk.Properties.AuthenticationData), "n,,")
+	if !ok {
+		return false
+	}
+	attrs := scramFields(clientFirstBare)
+	if attrs["n"] != h.Username || attrs["r"] == "" {
+		return false
+	}
+
+	salt := make([]byte, 16)
+	serverNonce := make([]byte, 18)
+	rand.Read(salt)
+	rand.Read(serverNonce)
+	nonce := attrs["r"] + base64.RawStdEncoding.EncodeToString(serverNonce)
+	serverFirst := "r=" + nonce + ",s=" + base64.StdEncoding.EncodeToString(salt) + ",i=4096"
+
+	clientFinal, ok := exchangeAuth(cl, serverFirst)
+	if !ok {
+		return false
+	}
+	clientFinalBare, proofField, ok := strings.Cut(clientFinal, ",p=")
+	if !ok || clientFinalBare != "c=biws,r="+nonce {
+		return false
+	}
+	proof, err := base64.StdEncoding.DecodeString(proofField)
+	if err != nil || len(proof) != sha256.Size {
+		return false
+	}
+
+	saltedPassword, _ := pbkdf2.Key(sha256.New, h.Password, salt, scramIterations, sha256.Size)
+	authMessage := clientFirstBare + "," + serverFirst + "," + clientFinalBare
+	storedKey := sha256.Sum256(scramHMAC(saltedPassword, "Client Key"))
+	clientSignature := scramHMAC(storedKey[:], authMessage)
+	clientKey := make([]byte, len(proof))
+	for i := range proof {
+		clientKey[i] = proof[i] ^ clientSignature[i]
+	}
+	if computed := sha256.Sum256(clientKey); !hmac.Equal(computed[:], storedKey[:]) {
+		return false
+	}
+
+	serverSignature := scramHMAC(scramHMAC(saltedPassword, "Server Key"), authMessage)
+	_, ok = exchangeAuth(cl, "v="+base64.StdEncoding.EncodeToString(serverSignature))
+	return ok
+}
+
+// exchangeAuth 向客户端发送AUTH报文并读取客户端回应的认证数据
+func exchangeAuth(cl *mochi.Client, data string) (string, bool) {
+	err := cl.WritePacket(packets.Packet{
+		FixedHeader: packets.FixedHeader{Type: packets.Auth},
+		ReasonCode:  packets.CodeContinueAuthentication.Code,
+		Properties: packets.Properties{
+			AuthenticationMethod: scramMethod,
+			AuthenticationData:   []byte(data),
+		},
+	})
+	if err != nil {
+		return "", false
+	}
+
+	fh := new(packets.FixedHeader)
+	if err := cl.ReadFixedHeader(fh); err != nil || fh.Type != packets.Auth {
+		return "", false
+	}
+	pk, err := cl.ReadPacket(fh)
+	if err != nil {
+		return "", false
+	}
+	return string(pk.Properties.AuthenticationData), true
+}
+
+// scramHMAC 计算HMAC-SHA-256
+func scramHMAC(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// scramFields 解析SCRAM消息中逗号分隔的 "名称=值" 属性
+func scramFields(msg string) map[string]string {
+	fields := make(map[string]string)
+	for _, field := range strings.Split(msg, ",") {
+		if name, value, ok := strings.Cut(field, "="); ok {
+			fields[name] = value
+		}
+	}
+	return fields
+}
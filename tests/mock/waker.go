@@ -0,0 +1,55 @@
+package mock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// WakeServer 模拟设备的HTTP唤醒接口，按请求顺序记录被唤醒的设备
+type WakeServer struct {
+	server  *httptest.Server
+	handler func(device string) int
+	devices []string
+	mutex   sync.Mutex
+}
+
+// NewWakeServer 启动模拟的HTTP唤醒接口，测试结束时自动关闭
+// 收到唤醒请求时调用handler，返回值作为响应的状态码；handler为nil时总是返回200
+func NewWakeServer(t *testing.T, handler func(device string) int) *WakeServer {
+	t.Helper()
+
+	s := &WakeServer{handler: handler}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// URL 返回唤醒设备使用的地址，如 "http://127.0.0.1:34567/wake/NAS1"
+func (s *WakeServer) URL(device string) string {
+	return s.server.URL + "/wake/" + device
+}
+
+// Devices 返回按请求顺序被唤醒的设备
+func (s *WakeServer) Devices() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.devices...)
+}
+
+// handle 记录唤醒请求并返回handler指定的状态码
+func (s *WakeServer) handle(w http.ResponseWriter, r *http.Request) {
+	device := strings.TrimPrefix(r.URL.Path, "/wake/")
+
+	s.mutex.Lock()
+	s.devices = append(s.devices, device)
+	s.mutex.Unlock()
+
+	status := http.StatusOK
+	if s.handler != nil {
+		status = s.handler(device)
+	}
+	w.WriteHeader(status)
+}
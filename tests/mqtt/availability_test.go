@@ -0,0 +1,91 @@
+package mqtt_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fbigun/smartwaker/internal/config"
+	mqttClient "github.com/fbigun/smartwaker/internal/mqtt"
+	"github.com/fbigun/smartwaker/tests/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAvailability 测试连接后发布上线消息，正常退出前发布下线消息，异常断开时由服务器发布遗嘱消息
+func TestAvailability(t *testing.T) {
+	for _, version := range []int{4, 5} {
+		t.Run(fmt.Sprintf("MQTT版本%d", version), func(t *testing.T) {
+			broker := mock.NewBroker(t)
+			topic := fmt.Sprintf("test/availability/v%d", version)
+
+			// receive 订阅可用性主题并返回收到的消息
+			receive := func(t *testing.T, clientID string) chan paho.Message {
+				messages := make(chan paho.Message, 4)
+				watcher := connectClient(t, broker, clientID, version)
+				err := watcher.Subscribe(topic, 1, func(c paho.Client, msg paho.Message) {
+					messages <- msg
+				})
+				assert.NoError(t, err, "订阅不应该返回错误")
+				return messages
+			}
+			// expect 检查收到的可用性消息
+			expect := func(t *testing.T, messages chan paho.Message, payload string) paho.Message {
+				select {
+				case msg := <-messages:
+					assert.Equal(t, payload, string(msg.Payload()), "应该收到可用性消息")
+					return msg
+				case <-time.After(5 * time.Second):
+					t.Fatalf("没有收到可用性消息 %s", payload)
+					return nil
+				}
+			}
+			// connect 连接设置了可用性主题的客户端
+			connect := func(t *testing.T, clientID string) *mqttClient.Client {
+				client := mqttClient.NewClient(&config.MQTTConfig{
+					Broker:       broker.Address(),
+					ClientID:     clientID,
+					QoS:          1,
+					KeepAlive:    30,
+					CleanSession: true,
+					Version:      version,
+					// 重连间隔足够长，断开后不会立即重新发布上线消息
+					ReconnectInterval: 60,
+				}, nil)
+				client.SetAvailability(topic)
+				if err := client.Connect(); err != nil {
+					t.Fatalf("连接到测试MQTT服务器失败: %v", err)
+				}
+				t.Cleanup(client.Disconnect)
+				return client
+			}
+
+			messages := receive(t, fmt.Sprintf("availability-watcher-v%d", version))
+
+			t.Run("异常断开时发布遗嘱消息", func(t *testing.T) {
+				clientID := fmt.Sprintf("availability-crash-v%d", version)
+				connect(t, clientID)
+				expect(t, messages, "online")
+
+				assert.True(t, broker.DisconnectClient(clientID), "服务器应该记录客户端")
+				expect(t, messages, "offline")
+			})
+
+			t.Run("正常退出前发布下线消息", func(t *testing.T) {
+				client := connect(t, fmt.Sprintf("availability-graceful-v%d", version))
+				expect(t, messages, "online")
+
+				// 新订阅者应该收到保留的上线消息
+				msg := expect(t, receive(t, fmt.Sprintf("availability-late-v%d", version)), "online")
+				assert.True(t, msg.Retained(), "上线消息应该是保留消息")
+
+				assert.NoError(t, client.PublishOffline(), "发布下线消息不应该返回错误")
+				client.Disconnect()
+				expect(t, messages, "offline")
+
+				msg = expect(t, receive(t, fmt.Sprintf("availability-after-v%d", version)), "offline")
+				assert.True(t, msg.Retained(), "下线消息应该是保留消息")
+			})
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package mqtt_test
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fbigun/smartwaker/internal/config"
+	mqttClient "github.com/fbigun/smartwaker/internal/mqtt"
+	"github.com/fbigun/smartwaker/tests/mock"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+)
+
+// outageHook 模拟服务器故障，down为true时拒绝所有连接，否则只允许指定用户名连接
+type outageHook struct {
+	mochi.HookBase
+	username string
+	down     atomic.Bool
+}
+
+func (h *outageHook) ID() string { return "outage" }
+
+func (h *outageHook) Provides(b byte) bool {
+	return b == mochi.OnConnectAuthenticate || b == mochi.OnACLCheck
+}
+
+func (h *outageHook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	return !h.down.Load() && string(pk.Connect.Username) == h.username
+}
+
+func (h *outageHook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	return true
+}
+
+// TestFailover 测试首选服务器不可用时连接备用服务器，首选服务器恢复后切换回来
+func TestFailover(t *testing.T) {
+	for _, version := range []int{4, 5} {
+		t.Run(fmt.Sprintf("MQTT版本%d", version), func(t *testing.T) {
+			outage := &outageHook{username: "primary"}
+			outage.down.Store(true)
+			primary := mock.NewBroker(t, outage)
+			backup := mock.NewBroker(t)
+			clientID := fmt.Sprintf("failover-v%d", version)
+
+			client := mqttClient.NewClient(&config.MQTTConfig{
+				Brokers: []config.BrokerConfig{
+					// 首选服务器使用单独的认证信息
+					{URL: primary.Address(), Auth: &config.AuthConfig{Enabled: true, Username: "primary", Password: "secret"}},
+					{URL: backup.Address()},
+				},
+				ClientID:          clientID,
+				Topic:             "test/topic",
+				QoS:               1,
+				KeepAlive:         30,
+				CleanSession:      true,
+				Version:           version,
+				ReconnectInterval: 1,
+				FailbackInterval:  1,
+			}, nil)
+
+			connected := make(chan bool, 4)
+			client.SetOnConnect(func(reconnected bool) { connected <- reconnected })
+
+			if err := client.Connect(); err != nil {
+				t.Fatalf("连接到备用MQTT服务器失败: %v", err)
+			}
+			defer client.Disconnect()
+			assert.False(t, <-connected, "首次连接不是重新连接")
+
+			status := client.BrokerStatus()
+			assert.Equal(t, []string{primary.Address(), backup.Address()}, status.Brokers, "应该按优先级返回服务器列表")
+			assert.Equal(t, backup.Address(), status.Active, "首选服务器不可用时应该连接备用服务器")
+			assert.False(t, status.Preferred, "连接的不是首选服务器")
+
+			received := make(chan string, 1)
+			err := client.Subscribe("test/failover", 1, func(c paho.Client, msg paho.Message) {
+				received <- string(msg.Payload())
+			})
+			assert.NoError(t, err, "订阅不应该返回错误")
+
+			// 首选服务器恢复后切换回首选服务器
+			outage.down.Store(false)
+			select {
+			case reconnected := <-connected:
+				assert.True(t, reconnected, "切换服务器应该报告重新连接")
+			case <-time.After(5 * time.Second):
+				t.Fatal("首选服务器恢复后没有切换回来")
+			}
+			status = client.BrokerStatus()
+			assert.Equal(t, primary.Address(), status.Active, "应该切换回首选服务器")
+			assert.True(t, status.Preferred, "连接的应该是首选服务器")
+
+			assert.NoError(t, client.Publish("test/failover", 1, false, "primary"), "切换后发布不应该返回错误")
+			select {
+			case payload := <-received:
+				assert.Equal(t, "primary", payload, "应该在首选服务器上恢复订阅")
+			case <-time.After(5 * time.Second):
+				t.Fatal("切换服务器后没有恢复订阅")
+			}
+
+			// 首选服务器故障后重新连接到备用服务器
+			outage.down.Store(true)
+			assert.True(t, primary.DisconnectClient(clientID), "首选服务器应该记录客户端")
+			select {
+			case reconnected := <-connected:
+				assert.True(t, reconnected, "应该报告重新连接")
+			case <-time.After(5 * time.Second):
+				t.Fatal("首选服务器故障后没有连接备用服务器")
+			}
+			assert.Equal(t, backup.Address(), client.BrokerStatus().Active, "应该重新连接到备用服务器")
+		})
+	}
+}
+
+// TestFailoverAllUnavailable 测试所有服务器都不可用时返回每个服务器的错误
+func TestFailoverAllUnavailable(t *testing.T) {
+	primary := mock.NewBroker(t)
+	backup := mock.NewBroker(t)
+	primary.Stop()
+	backup.Stop()
+
+	client := mqttClient.NewClient(&config.MQTTConfig{
+		Brokers:   []config.BrokerConfig{{URL: primary.Address()}, {URL: backup.Address()}},
+		ClientID:  "failover-unavailable",
+		KeepAlive: 30,
+		Version:   5,
+	}, nil)
+
+	err := client.Connect()
+	assert.Error(t, err, "所有服务器都不可用时连接应该失败")
+	assert.Contains(t, err.Error(), primary.Address(), "错误应该包含首选服务器")
+	assert.Contains(t, err.Error(), backup.Address(), "错误应该包含备用服务器")
+	assert.False(t, client.BrokerStatus().Connected, "客户端应该处于未连接状态")
+}
@@ -0,0 +1,304 @@
+package mqtt_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fbigun/smartwaker/internal/config"
+	mqttClient "github.com/fbigun/smartwaker/internal/mqtt"
+	"github.com/fbigun/smartwaker/tests/mock"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+)
+
+// drainTopics 按顺序取出队列中的所有消息，返回消息的主题
+func drainTopics(queue *mqttClient.Queue) []string {
+	var topics []string
+	for msg := queue.Front(); msg != nil; msg = queue.Front() {
+		topics = append(topics, msg.Topic)
+		queue.Remove(msg)
+	}
+	return topics
+}
+
+// TestQueue 测试消息队列的丢弃策略、过期时间和持久化
+func TestQueue(t *testing.T) {
+	t.Run("队列满时丢弃最早的消息", func(t *testing.T) {
+		queue, err := mqttClient.NewQueue(config.QueueConfig{Size: 2})
+		assert.NoError(t, err, "创建队列不应该返回错误")
+
+		for _, topic := range []string{"a", "b", "c"} {
+			assert.NoError(t, queue.Push(&mqttClient.QueuedMessage{Topic: topic}), "加入队列不应该返回错误")
+		}
+		assert.Equal(t, []string{"b", "c"}, drainTopics(queue), "应该丢弃最早的消息")
+	})
+
+	t.Run("队列满时丢弃新消息", func(t *testing.T) {
+		queue, err := mqttClient.NewQueue(config.QueueConfig{Size: 2, DropPolicy: "newest"})
+		assert.NoError(t, err, "创建队列不应该返回错误")
+
+		assert.NoError(t, queue.Push(&mqttClient.QueuedMessage{Topic: "a"}), "加入队列不应该返回错误")
+		assert.NoError(t, queue.Push(&mqttClient.QueuedMessage{Topic: "b"}), "加入队列不应该返回错误")
+		assert.ErrorIs(t, queue.Push(&mqttClient.QueuedMessage{Topic: "c"}), mqttClient.ErrQueueFull, "队列满时应该拒绝新消息")
+		assert.Equal(t, []string{"a", "b"}, drainTopics(queue), "应该保留最早的消息")
+	})
+
+	t.Run("丢弃过期的消息", func(t *testing.T) {
+		queue, err := mqttClient.NewQueue(config.QueueConfig{TTL: 60})
+		assert.NoError(t, err, "创建队列不应该返回错误")
+
+		assert.NoError(t, queue.Push(&mqttClient.QueuedMessage{Topic: "old", Queued: time.Now().Add(-2 * time.Minute)}), "加入队列不应该返回错误")
+		assert.NoError(t, queue.Push(&mqttClient.QueuedMessage{Topic: "new"}), "加入队列不应该返回错误")
+		assert.Equal(t, []string{"new"}, drainTopics(queue), "应该丢弃超过ttl的消息")
+	})
+
+	t.Run("重启后从目录恢复消息", func(t *testing.T) {
+		dir := t.TempDir()
+		queue, err := mqttClient.NewQueue(config.QueueConfig{Dir: dir})
+		assert.NoError(t, err, "创建队列不应该返回错误")
+		for _, topic := range []string{"a", "b", "c"} {
+			assert.NoError(t, queue.Push(&mqttClient.QueuedMessage{Topic: topic, Payload: []byte(topic)}), "加入队列不应该返回错误")
+		}
+		queue.Remove(queue.Front())
+
+		restored, err := mqttClient.NewQueue(config.QueueConfig{Dir: dir})
+		assert.NoError(t, err, "加载队列不应该返回错误")
+		assert.Equal(t, 2, restored.Len(), "应该恢复未发布的消息")
+		assert.Equal(t, []byte("b"), restored.Front().Payload, "应该恢复消息内容")
+
+		assert.NoError(t, restored.Push(&mqttClient.QueuedMessage{Topic: "d"}), "加入队列不应该返回错误")
+		assert.Equal(t, []string{"b", "c", "d"}, drainTopics(restored), "恢复的消息应该保持原顺序")
+
+		files, err := os.ReadDir(dir)
+		assert.NoError(t, err, "读取队列目录不应该返回错误")
+		assert.Empty(t, files, "发布后应该删除持久化文件")
+	})
+}
+
+// TestOfflineQueue 测试断线期间发布的消息在重新连接后按原顺序发布
+func TestOfflineQueue(t *testing.T) {
+	broker := mock.NewBroker(t)
+
+	received := make(chan string, 10)
+	subscriber := connectClient(t, broker, "queue-subscriber", 4)
+	err := subscriber.Subscribe("test/queue", 1, func(c paho.Client, msg paho.Message) {
+		received <- string(msg.Payload())
+	})
+	assert.NoError(t, err, "订阅不应该返回错误")
+
+	// expect 检查按顺序收到的消息
+	expect := func(t *testing.T, payloads ...string) {
+		for _, payload := range payloads {
+			select {
+			case got := <-received:
+				assert.Equal(t, payload, got, "应该按原顺序收到队列中的消息")
+			case <-time.After(5 * time.Second):
+				t.Fatalf("没有收到消息 %s", payload)
+			}
+		}
+	}
+
+	// offline 连接后断开，返回断线的客户端
+	dir := t.TempDir()
+	offline := func(t *testing.T, clientID string, reconnectInterval int) *mqttClient.Client {
+		client := mqttClient.NewClient(&config.MQTTConfig{
+			Broker:            broker.Address(),
+			ClientID:          clientID,
+			QoS:               1,
+			KeepAlive:         30,
+			CleanSession:      true,
+			Version:           5,
+			ReconnectInterval: reconnectInterval,
+			Queue:             config.QueueConfig{Enabled: true, Dir: dir},
+		}, nil)
+		lost := make(chan error, 1)
+		client.SetOnConnectionLost(func(err error) { lost <- err })
+		if err := client.Connect(); err != nil {
+			t.Fatalf("连接到测试MQTT服务器失败: %v", err)
+		}
+
+		assert.True(t, broker.DisconnectClient(clientID), "服务器应该记录客户端")
+		select {
+		case <-lost:
+		case <-time.After(5 * time.Second):
+			t.Fatal("没有报告连接断开")
+		}
+		return client
+	}
+
+	t.Run("重新连接后发布", func(t *testing.T) {
+		client := offline(t, "queue-publisher", 1)
+		defer client.Disconnect()
+
+		for _, payload := range []string{"1", "2", "3"} {
+			assert.NoError(t, client.Publish("test/queue", 1, false, payload), "断线期间发布应该进入队列")
+		}
+		expect(t, "1", "2", "3")
+	})
+
+	t.Run("重启后发布", func(t *testing.T) {
+		// 重连间隔足够长，在重新连接前退出
+		client := offline(t, "queue-restart", 60)
+		for _, payload := range []string{"4", "5"} {
+			assert.NoError(t, client.Publish("test/queue", 1, false, payload), "断线期间发布应该进入队列")
+		}
+		client.Disconnect()
+
+		restarted := mqttClient.NewClient(&config.MQTTConfig{
+			Broker:       broker.Address(),
+			ClientID:     "queue-restart",
+			QoS:          1,
+			KeepAlive:    30,
+			CleanSession: true,
+			Version:      5,
+			Queue:        config.QueueConfig{Enabled: true, Dir: dir},
+		}, nil)
+		if err := restarted.Connect(); err != nil {
+			t.Fatalf("连接到测试MQTT服务器失败: %v", err)
+		}
+		defer restarted.Disconnect()
+		expect(t, "4", "5")
+	})
+}
+
+// dropOnceHook 收到指定主题的第一条消息时断开发布者的连接，模拟发布过程中连接断开
+type dropOnceHook struct {
+	mochi.HookBase
+	topic   string
+	payload string // 为空时匹配主题的任意消息
+	dropped atomic.Bool
+}
+
+func (h *dropOnceHook) ID() string { return "drop-once" }
+
+func (h *dropOnceHook) Provides(b byte) bool {
+	return b == mochi.OnConnectAuthenticate || b == mochi.OnACLCheck || b == mochi.OnPublish
+}
+
+func (h *dropOnceHook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	return true
+}
+
+func (h *dropOnceHook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	return true
+}
+
+func (h *dropOnceHook) OnPublish(cl *mochi.Client, pk packets.Packet) (packets.Packet, error) {
+	if pk.TopicName != h.topic || (h.payload != "" && string(pk.Payload) != h.payload) {
+		return pk, nil
+	}
+	if h.dropped.CompareAndSwap(false, true) {
+		// 丢弃消息并在应答前断开连接
+		cl.Stop(errors.New("dropping publisher"))
+		return pk, packets.ErrRejectPacket
+	}
+	return pk, nil
+}
+
+// TestQueueOnPublishFailure 测试发布过程中连接断开时消息进入队列，重新连接后发布
+func TestQueueOnPublishFailure(t *testing.T) {
+	for _, version := range []int{4, 5} {
+		t.Run(fmt.Sprintf("MQTT版本%d", version), func(t *testing.T) {
+			topic := fmt.Sprintf("test/queue/drop/v%d", version)
+			broker := mock.NewBroker(t, &dropOnceHook{topic: topic})
+
+			received := make(chan string, 1)
+			subscriber := connectClient(t, broker, fmt.Sprintf("drop-subscriber-v%d", version), version)
+			err := subscriber.Subscribe(topic, 1, func(c paho.Client, msg paho.Message) {
+				received <- string(msg.Payload())
+			})
+			assert.NoError(t, err, "订阅不应该返回错误")
+
+			client := mqttClient.NewClient(&config.MQTTConfig{
+				Broker:            broker.Address(),
+				ClientID:          fmt.Sprintf("drop-publisher-v%d", version),
+				QoS:               1,
+				KeepAlive:         30,
+				CleanSession:      true,
+				Version:           version,
+				ReconnectInterval: 1,
+				Queue:             config.QueueConfig{Enabled: true},
+			}, nil)
+			if err := client.Connect(); err != nil {
+				t.Fatalf("连接到测试MQTT服务器失败: %v", err)
+			}
+			defer client.Disconnect()
+
+			assert.NoError(t, client.Publish(topic, 1, false, "queued"), "发布时连接断开应该将消息加入队列")
+			select {
+			case payload := <-received:
+				assert.Equal(t, "queued", payload, "重新连接后应该发布队列中的消息")
+			case <-time.After(10 * time.Second):
+				t.Fatal("没有收到队列中的消息")
+			}
+		})
+	}
+}
+
+// TestQueueReplayInterrupted 测试发布队列中的消息时连接断开，重新连接后继续按原顺序发布且不重复
+func TestQueueReplayInterrupted(t *testing.T) {
+	for _, version := range []int{4, 5} {
+		t.Run(fmt.Sprintf("MQTT版本%d", version), func(t *testing.T) {
+			topic := fmt.Sprintf("test/queue/replay/v%d", version)
+			broker := mock.NewBroker(t, &dropOnceHook{topic: topic, payload: "3"})
+
+			received := make(chan string, 10)
+			subscriber := connectClient(t, broker, fmt.Sprintf("replay-subscriber-v%d", version), version)
+			err := subscriber.Subscribe(topic, 1, func(c paho.Client, msg paho.Message) {
+				received <- string(msg.Payload())
+			})
+			assert.NoError(t, err, "订阅不应该返回错误")
+
+			clientID := fmt.Sprintf("replay-publisher-v%d", version)
+			client := mqttClient.NewClient(&config.MQTTConfig{
+				Broker:            broker.Address(),
+				ClientID:          clientID,
+				QoS:               1,
+				KeepAlive:         30,
+				CleanSession:      true,
+				Version:           version,
+				ReconnectInterval: 1,
+				Queue:             config.QueueConfig{Enabled: true},
+			}, nil)
+			lost := make(chan error, 2)
+			client.SetOnConnectionLost(func(err error) { lost <- err })
+			if err := client.Connect(); err != nil {
+				t.Fatalf("连接到测试MQTT服务器失败: %v", err)
+			}
+			defer client.Disconnect()
+
+			assert.True(t, broker.DisconnectClient(clientID), "服务器应该记录客户端")
+			select {
+			case <-lost:
+			case <-time.After(5 * time.Second):
+				t.Fatal("没有报告连接断开")
+			}
+
+			// 重新连接后发布到第3条消息时连接再次断开
+			payloads := []string{"1", "2", "3", "4", "5"}
+			for _, payload := range payloads {
+				assert.NoError(t, client.Publish(topic, 1, false, payload), "断线期间发布应该进入队列")
+			}
+
+			for _, payload := range payloads {
+				select {
+				case got := <-received:
+					assert.Equal(t, payload, got, "应该按原顺序收到队列中的消息")
+				case <-time.After(10 * time.Second):
+					t.Fatalf("没有收到消息 %s", payload)
+				}
+			}
+			select {
+			case got := <-received:
+				t.Errorf("不应该重复发布队列中的消息: %s", got)
+			case <-time.After(500 * time.Millisecond):
+			}
+		})
+	}
+}
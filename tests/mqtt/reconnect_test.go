@@ -0,0 +1,114 @@
+package mqtt_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fbigun/smartwaker/internal/config"
+	mqttClient "github.com/fbigun/smartwaker/internal/mqtt"
+	"github.com/fbigun/smartwaker/tests/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReconnect 测试连接断开后自动重连并恢复订阅
+func TestReconnect(t *testing.T) {
+	for _, version := range []int{4, 5} {
+		t.Run(fmt.Sprintf("MQTT版本%d", version), func(t *testing.T) {
+			broker := mock.NewBroker(t)
+			clientID := fmt.Sprintf("reconnect-v%d", version)
+
+			client := mqttClient.NewClient(&config.MQTTConfig{
+				Broker:            broker.Address(),
+				ClientID:          clientID,
+				Topic:             "test/topic",
+				QoS:               1,
+				KeepAlive:         30,
+				CleanSession:      true,
+				Version:           version,
+				ReconnectInterval: 1,
+			}, nil)
+
+			connected := make(chan bool, 2)
+			lost := make(chan error, 1)
+			client.SetOnConnect(func(reconnected bool) { connected <- reconnected })
+			client.SetOnConnectionLost(func(err error) { lost <- err })
+
+			if err := client.Connect(); err != nil {
+				t.Fatalf("连接到测试MQTT服务器失败: %v", err)
+			}
+			defer client.Disconnect()
+			assert.False(t, <-connected, "首次连接不是重新连接")
+
+			received := make(chan string, 1)
+			err := client.Subscribe("test/reconnect", 1, func(c paho.Client, msg paho.Message) {
+				received <- string(msg.Payload())
+			})
+			assert.NoError(t, err, "订阅不应该返回错误")
+
+			assert.True(t, broker.DisconnectClient(clientID), "服务器应该记录客户端")
+
+			select {
+			case err := <-lost:
+				assert.Error(t, err, "连接断开回调应该带有原因")
+			case <-time.After(5 * time.Second):
+				t.Fatal("没有报告连接断开")
+			}
+			assert.False(t, client.IsConnected(), "连接断开后客户端应该处于未连接状态")
+			assert.Error(t, client.Publish("test/topic", 1, false, "offline"), "未连接时发布应该返回错误")
+
+			select {
+			case reconnected := <-connected:
+				assert.True(t, reconnected, "应该报告重新连接")
+			case <-time.After(5 * time.Second):
+				t.Fatal("客户端没有重新连接")
+			}
+			assert.True(t, client.IsConnected(), "重新连接后客户端应该处于已连接状态")
+
+			// 重新连接后发布的消息应该由恢复的订阅收到
+			assert.NoError(t, client.Publish("test/reconnect", 1, false, "back"), "重新连接后发布不应该返回错误")
+			select {
+			case payload := <-received:
+				assert.Equal(t, "back", payload, "应该通过恢复的订阅收到消息")
+			case <-time.After(5 * time.Second):
+				t.Fatal("重新连接后没有恢复订阅")
+			}
+		})
+	}
+}
+
+// TestDisconnectStopsReconnect 测试主动断开连接后不再重连
+func TestDisconnectStopsReconnect(t *testing.T) {
+	broker := mock.NewBroker(t)
+
+	client := mqttClient.NewClient(&config.MQTTConfig{
+		Broker:            broker.Address(),
+		ClientID:          "no-reconnect",
+		QoS:               1,
+		KeepAlive:         30,
+		CleanSession:      true,
+		Version:           5,
+		ReconnectInterval: 1,
+	}, nil)
+
+	reconnected := make(chan bool, 1)
+	client.SetOnConnect(func(again bool) {
+		if again {
+			reconnected <- again
+		}
+	})
+	if err := client.Connect(); err != nil {
+		t.Fatalf("连接到测试MQTT服务器失败: %v", err)
+	}
+
+	assert.True(t, broker.DisconnectClient("no-reconnect"), "服务器应该记录客户端")
+	client.Disconnect()
+
+	select {
+	case <-reconnected:
+		t.Fatal("主动断开连接后不应该重新连接")
+	case <-time.After(2 * time.Second):
+	}
+	assert.False(t, client.IsConnected(), "客户端应该处于未连接状态")
+}
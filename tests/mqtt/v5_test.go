@@ -0,0 +1,240 @@
+package mqtt_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fbigun/smartwaker/internal/config"
+	mqttClient "github.com/fbigun/smartwaker/internal/mqtt"
+	"github.com/fbigun/smartwaker/tests/mock"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+)
+
+// connectClient 创建并连接到测试服务器的MQTT客户端
+func connectClient(t *testing.T, broker *mock.Broker, clientID string, version int) *mqttClient.Client {
+	t.Helper()
+
+	client := mqttClient.NewClient(&config.MQTTConfig{
+		Broker:       broker.Address(),
+		ClientID:     clientID,
+		Topic:        "test/topic",
+		QoS:          1,
+		KeepAlive:    30,
+		CleanSession: true,
+		Version:      version,
+	}, nil)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("连接到测试MQTT服务器失败: %v", err)
+	}
+	t.Cleanup(client.Disconnect)
+	return client
+}
+
+// TestMQTT5ResponseTopic 测试MQTT v5的响应主题和关联数据
+func TestMQTT5ResponseTopic(t *testing.T) {
+	broker := mock.NewBroker(t)
+
+	// 响应方收到请求后发布到请求的响应主题
+	requests := make(chan *mqttClient.Properties, 1)
+	responder := connectClient(t, broker, "responder", 5)
+	assert.True(t, responder.IsConnected(), "客户端应该已连接")
+	err := responder.Subscribe("test/topic", 1, func(client paho.Client, msg paho.Message) {
+		props := mqttClient.PropertiesOf(msg)
+		requests <- props
+		if props != nil && props.ResponseTopic != "" {
+			reply := &mqttClient.Properties{CorrelationData: props.CorrelationData}
+			assert.NoError(t, responder.PublishWithProperties(props.ResponseTopic, 1, false, "pong", reply), "发布响应不应该返回错误")
+		}
+	})
+	assert.NoError(t, err, "订阅不应该返回错误")
+
+	t.Run("v5请求方收到关联的响应", func(t *testing.T) {
+		replies := make(chan paho.Message, 1)
+		requester := connectClient(t, broker, "requester-v5", 5)
+		err := requester.Subscribe("clients/requester-v5/reply", 1, func(client paho.Client, msg paho.Message) {
+			replies <- msg
+		})
+		assert.NoError(t, err, "订阅响应主题不应该返回错误")
+
+		props := &mqttClient.Properties{ResponseTopic: "clients/requester-v5/reply", CorrelationData: []byte("req-42")}
+		assert.NoError(t, requester.PublishWithProperties("test/topic", 1, false, "ping", props), "发布请求不应该返回错误")
+
+		select {
+		case request := <-requests:
+			assert.Equal(t, "clients/requester-v5/reply", request.ResponseTopic, "应该收到请求的响应主题")
+		case <-time.After(5 * time.Second):
+			t.Fatal("响应方没有收到请求")
+		}
+
+		select {
+		case reply := <-replies:
+			assert.Equal(t, "pong", string(reply.Payload()), "响应内容应该正确")
+			assert.Equal(t, []byte("req-42"), mqttClient.PropertiesOf(reply).CorrelationData, "响应应该附带请求的关联数据")
+		case <-time.After(5 * time.Second):
+			t.Fatal("请求方没有收到响应")
+		}
+	})
+
+	t.Run("v3.1.1请求方没有响应主题", func(t *testing.T) {
+		requester := connectClient(t, broker, "requester-v4", 4)
+		props := &mqttClient.Properties{ResponseTopic: "clients/requester-v4/reply"}
+		assert.NoError(t, requester.PublishWithProperties("test/topic", 1, false, "ping", props), "v3.1.1连接应该忽略属性")
+
+		select {
+		case request := <-requests:
+			assert.Empty(t, request.ResponseTopic, "v3.1.1请求不应该带有响应主题")
+		case <-time.After(5 * time.Second):
+			t.Fatal("响应方没有收到请求")
+		}
+	})
+}
+
+// denyHook 允许客户端连接，但拒绝访问 "denied/" 开头的主题
+type denyHook struct {
+	mochi.HookBase
+}
+
+func (h *denyHook) ID() string { return "deny" }
+
+func (h *denyHook) Provides(b byte) bool {
+	return b == mochi.OnConnectAuthenticate || b == mochi.OnACLCheck
+}
+
+func (h *denyHook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	return string(pk.Connect.Username) != "banned"
+}
+
+func (h *denyHook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	return !strings.HasPrefix(topic, "denied/")
+}
+
+// v5Config 返回连接到测试服务器的MQTT v5配置
+func v5Config(broker *mock.Broker, clientID string) *config.MQTTConfig {
+	return &config.MQTTConfig{
+		Broker:       broker.Address(),
+		ClientID:     clientID,
+		Topic:        "test/topic",
+		QoS:          1,
+		KeepAlive:    30,
+		CleanSession: true,
+		Version:      5,
+	}
+}
+
+// TestMQTT5Properties 测试发布消息时附带用户属性和消息过期时间，以及连接的会话过期时间
+func TestMQTT5Properties(t *testing.T) {
+	broker := mock.NewBroker(t)
+
+	received := make(chan paho.Message, 1)
+	subscriber := connectClient(t, broker, "subscriber", 5)
+	err := subscriber.Subscribe("test/props", 1, func(client paho.Client, msg paho.Message) {
+		received <- msg
+	})
+	assert.NoError(t, err, "订阅不应该返回错误")
+
+	cfg := v5Config(broker, "publisher")
+	cfg.SessionExpiry = 300
+	cfg.MessageExpiry = 60
+	cfg.UserProperties = map[string]string{"site": "home", "role": "controller"}
+	publisher := mqttClient.NewClient(cfg, nil)
+	if err := publisher.Connect(); err != nil {
+		t.Fatalf("连接到测试MQTT服务器失败: %v", err)
+	}
+	defer publisher.Disconnect()
+
+	expiry, ok := broker.SessionExpiry("publisher")
+	assert.True(t, ok, "服务器应该记录客户端")
+	assert.Equal(t, uint32(300), expiry, "会话过期时间应该在CONNECT报文中发送")
+
+	props := &mqttClient.Properties{UserProperties: map[string]string{"role": "responder"}}
+	assert.NoError(t, publisher.PublishWithProperties("test/props", 1, false, "hello", props), "发布不应该返回错误")
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, map[string]string{"site": "home", "role": "responder"}, mqttClient.PropertiesOf(msg).UserProperties, "消息的用户属性应该覆盖配置中的同名属性")
+	case <-time.After(5 * time.Second):
+		t.Fatal("没有收到消息")
+	}
+}
+
+// TestMQTT5ReasonCodes 测试服务器返回的原因码出现在错误中
+func TestMQTT5ReasonCodes(t *testing.T) {
+	broker := mock.NewBroker(t, new(denyHook))
+
+	t.Run("连接被拒绝", func(t *testing.T) {
+		cfg := v5Config(broker, "banned-client")
+		cfg.Auth = config.AuthConfig{Enabled: true, Username: "banned", Password: "secret"}
+		err := mqttClient.NewClient(cfg, nil).Connect()
+
+		var reasonErr *mqttClient.ReasonCodeError
+		if assert.ErrorAs(t, err, &reasonErr, "连接错误应该包含原因码") {
+			assert.Equal(t, byte(0x86), reasonErr.Code, "原因码应该是用户名或密码错误")
+		}
+		assert.Contains(t, err.Error(), "reason code 0x86", "错误信息应该包含原因码")
+	})
+
+	client := connectClient(t, broker, "limited-client", 5)
+
+	t.Run("订阅被拒绝", func(t *testing.T) {
+		err := client.Subscribe("denied/topic", 1, nil)
+
+		var reasonErr *mqttClient.ReasonCodeError
+		if assert.ErrorAs(t, err, &reasonErr, "订阅错误应该包含原因码") {
+			assert.Equal(t, byte(0x87), reasonErr.Code, "原因码应该是未授权")
+		}
+	})
+
+	t.Run("发布被拒绝", func(t *testing.T) {
+		err := client.Publish("denied/topic", 1, false, "hello")
+
+		var reasonErr *mqttClient.ReasonCodeError
+		if assert.ErrorAs(t, err, &reasonErr, "发布错误应该包含原因码") {
+			assert.Equal(t, byte(0x87), reasonErr.Code, "原因码应该是未授权")
+		}
+	})
+}
+
+// TestMQTT5EnhancedAuth 测试通过AUTH报文完成SCRAM-SHA-256增强认证
+func TestMQTT5EnhancedAuth(t *testing.T) {
+	broker := mock.NewBroker(t, &mock.ScramHook{Username: "waker", Password: "s3cret"})
+
+	scramConfig := func(clientID, password string) *config.MQTTConfig {
+		cfg := v5Config(broker, clientID)
+		cfg.Auth = config.AuthConfig{
+			Username: "waker",
+			Password: password,
+			Enhanced: config.EnhancedAuth{Enabled: true, AuthMethod: "SCRAM-SHA-256"},
+		}
+		return cfg
+	}
+
+	t.Run("密码正确", func(t *testing.T) {
+		client := mqttClient.NewClient(scramConfig("scram-ok", "s3cret"), nil)
+		assert.NoError(t, client.Connect(), "增强认证应该成功")
+		defer client.Disconnect()
+
+		assert.True(t, client.IsConnected(), "客户端应该已连接")
+		assert.NoError(t, client.Publish("test/topic", 1, false, "hello"), "认证后发布不应该返回错误")
+	})
+
+	t.Run("密码错误", func(t *testing.T) {
+		err := mqttClient.NewClient(scramConfig("scram-bad", "wrong"), nil).Connect()
+
+		var reasonErr *mqttClient.ReasonCodeError
+		if assert.ErrorAs(t, err, &reasonErr, "认证失败应该返回原因码") {
+			assert.Equal(t, byte(0x86), reasonErr.Code, "原因码应该是用户名或密码错误")
+		}
+	})
+
+	t.Run("服务器不支持的认证方法", func(t *testing.T) {
+		// 自定义认证方法替代配置中的SCRAM-SHA-256，服务器拒绝未知的认证方法
+		client := mqttClient.NewClient(scramConfig("scram-method", "s3cret"), nil)
+		client.SetAuthenticator(&mqttClient.StaticAuthenticator{AuthMethod: "TOKEN", AuthData: []byte("abc")})
+
+		assert.Error(t, client.Connect(), "服务器不支持的认证方法应该连接失败")
+	})
+}
@@ -0,0 +1,74 @@
+package mqtt_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fbigun/smartwaker/internal/config"
+	mqttClient "github.com/fbigun/smartwaker/internal/mqtt"
+	"github.com/fbigun/smartwaker/tests/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWebSocket 测试通过WebSocket连接MQTT服务器，以及通过HTTP代理建立WebSocket连接
+func TestWebSocket(t *testing.T) {
+	broker := mock.NewBroker(t)
+	proxy := mock.NewHTTPProxy(t)
+
+	tests := []struct {
+		name    string
+		version int
+		proxy   string
+	}{
+		{name: "MQTT 3.1.1", version: 4},
+		{name: "MQTT 5.0", version: 5},
+		{name: "MQTT 3.1.1通过代理", version: 4, proxy: proxy.URL()},
+		{name: "MQTT 5.0通过代理", version: 5, proxy: proxy.URL()},
+	}
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tunnels := proxy.Tunnels()
+			client := mqttClient.NewClient(&config.MQTTConfig{
+				Broker:       broker.WebSocketAddress(""),
+				ClientID:     fmt.Sprintf("ws-client-%d", i),
+				QoS:          1,
+				KeepAlive:    30,
+				CleanSession: true,
+				Version:      tc.version,
+				WebSocket: config.WebSocketConfig{
+					Path:    "/mqtt",
+					Headers: map[string]string{"Authorization": "Bearer token"},
+					Proxy:   tc.proxy,
+				},
+			}, nil)
+			if err := client.Connect(); err != nil {
+				t.Fatalf("通过WebSocket连接到测试MQTT服务器失败: %v", err)
+			}
+			defer client.Disconnect()
+
+			received := make(chan string, 1)
+			topic := fmt.Sprintf("test/ws/%d", i)
+			err := client.Subscribe(topic, 1, func(c paho.Client, msg paho.Message) {
+				received <- string(msg.Payload())
+			})
+			assert.NoError(t, err, "订阅不应该返回错误")
+			assert.NoError(t, client.Publish(topic, 1, false, "over websocket"), "发布不应该返回错误")
+
+			select {
+			case payload := <-received:
+				assert.Equal(t, "over websocket", payload, "应该收到通过WebSocket发布的消息")
+			case <-time.After(5 * time.Second):
+				t.Fatal("没有收到消息")
+			}
+
+			if tc.proxy != "" {
+				assert.Equal(t, tunnels+1, proxy.Tunnels(), "连接应该经过HTTP代理")
+			} else {
+				assert.Equal(t, tunnels, proxy.Tunnels(), "没有配置代理时不应该经过HTTP代理")
+			}
+		})
+	}
+}
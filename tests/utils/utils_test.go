@@ -0,0 +1,140 @@
+package utils_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/fbigun/smartwaker/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBroadcastAddress 测试定向广播地址计算功能
+func TestBroadcastAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		cidr        string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "24位掩码",
+			cidr:     "192.168.10.0/24",
+			expected: "192.168.10.255",
+		},
+		{
+			name:     "主机地址所在网络",
+			cidr:     "192.168.10.37/24",
+			expected: "192.168.10.255",
+		},
+		{
+			name:     "20位掩码",
+			cidr:     "10.1.16.0/20",
+			expected: "10.1.31.255",
+		},
+		{
+			name:     "32位掩码",
+			cidr:     "172.16.0.1/32",
+			expected: "172.16.0.1",
+		},
+		{
+			name:        "IPv6网络",
+			cidr:        "fd00::/64",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ip, network, err := net.ParseCIDR(tc.cidr)
+			assert.NoError(t, err, "解析CIDR失败")
+			network.IP = ip
+
+			broadcast, err := utils.BroadcastAddress(network)
+			if tc.expectError {
+				assert.Error(t, err, "应该返回错误")
+				return
+			}
+
+			assert.NoError(t, err, "不应该返回错误")
+			assert.Equal(t, tc.expected, broadcast.String(), "广播地址不匹配")
+		})
+	}
+}
+
+// TestInterfaceIPv4Networks 测试获取网卡IPv4网络功能
+func TestInterfaceIPv4Networks(t *testing.T) {
+	t.Run("不存在的网卡", func(t *testing.T) {
+		_, err := utils.InterfaceIPv4Networks("smartwaker-nonexistent0")
+		assert.Error(t, err, "应该返回错误")
+		assert.Contains(t, err.Error(), "failed to find interface", "错误消息不匹配")
+	})
+
+	t.Run("回环网卡", func(t *testing.T) {
+		ifaces, err := net.Interfaces()
+		assert.NoError(t, err, "获取网卡列表失败")
+
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagLoopback == 0 {
+				continue
+			}
+
+			networks, err := utils.InterfaceIPv4Networks(iface.Name)
+			assert.NoError(t, err, "不应该返回错误")
+			for _, network := range networks {
+				assert.NotNil(t, network.IP.To4(), "应该只返回IPv4网络")
+			}
+			return
+		}
+
+		t.Skip("没有可用的回环网卡")
+	})
+}
+
+// TestParseSecureOnPassword 测试SecureOn密码解析功能
+func TestParseSecureOnPassword(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		expected    []byte
+		expectError bool
+	}{
+		{
+			name:     "6字节MAC格式",
+			password: "00:11:22:33:44:55",
+			expected: []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		},
+		{
+			name:     "4字节十六进制",
+			password: "DEADBEEF",
+			expected: []byte{0xDE, 0xAD, 0xBE, 0xEF},
+		},
+		{
+			name:     "带0x前缀的十六进制",
+			password: "0x01020304",
+			expected: []byte{0x01, 0x02, 0x03, 0x04},
+		},
+		{
+			name:        "长度无效",
+			password:    "0102030405",
+			expectError: true,
+		},
+		{
+			name:        "无效字符",
+			password:    "GG:11:22:33",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := utils.ParseSecureOnPassword(tc.password)
+			if tc.expectError {
+				assert.Error(t, err, "应该返回错误")
+				return
+			}
+
+			assert.NoError(t, err, "不应该返回错误")
+			assert.Equal(t, tc.expected, data, "解析结果不匹配")
+		})
+	}
+}